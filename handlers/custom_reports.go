@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"sending-stocks/models"
+	"sending-stocks/processors"
+	"sending-stocks/services"
+)
+
+// HandleCustomReports список (GET) и сохранение (POST: password, report) пользовательских отчетов
+func (h *UploadHandler) HandleCustomReports(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if r.URL.Query().Get("password") != h.adminPassword {
+			sendJSON(w, r, false, "Неверный пароль", nil, http.StatusUnauthorized)
+			return
+		}
+		reports, err := h.customReports.List()
+		if err != nil {
+			log.Printf("Ошибка чтения пользовательских отчетов: %v", err)
+			sendJSON(w, r, false, "Ошибка чтения пользовательских отчетов", nil, http.StatusInternalServerError)
+			return
+		}
+		sendJSON(w, r, true, "", reports, http.StatusOK)
+
+	case http.MethodPost:
+		var req struct {
+			Password string              `json:"password"`
+			Report   models.CustomReport `json:"report"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendJSON(w, r, false, "Ошибка парсинга запроса", nil, http.StatusBadRequest)
+			return
+		}
+		if req.Password != h.adminPassword {
+			log.Println("Ошибка сохранения пользовательского отчета: неверный пароль")
+			sendJSON(w, r, false, "Неверный пароль", nil, http.StatusUnauthorized)
+			return
+		}
+
+		if err := h.customReports.Save(&req.Report); err != nil {
+			if err == services.ErrUnknownID {
+				sendJSON(w, r, false, "Отчет не найден", nil, http.StatusNotFound)
+				return
+			}
+			sendJSON(w, r, false, err.Error(), nil, http.StatusBadRequest)
+			return
+		}
+		log.Printf("Сохранен пользовательский отчет %s (%s)", req.Report.Name, req.Report.ID)
+		sendJSON(w, r, true, "Отчет сохранен", req.Report, http.StatusOK)
+
+	default:
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleCustomReport выполняет (GET) или удаляет (DELETE) пользовательский отчет /api/custom-reports/{id}.
+// Параметры GET: result - результат обработки или date - последний снимок на дату остатков,
+// format=json - строки отчета в JSON вместо файла
+func (h *UploadHandler) HandleCustomReport(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("password") != h.adminPassword {
+		log.Println("Ошибка пользовательского отчета: неверный пароль")
+		http.Error(w, "Неверный пароль", http.StatusUnauthorized)
+		return
+	}
+
+	id := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		if err := h.customReports.Delete(id); err != nil {
+			if err == services.ErrUnknownID {
+				sendJSON(w, r, false, "Отчет не найден", nil, http.StatusNotFound)
+				return
+			}
+			sendJSON(w, r, false, "Ошибка удаления отчета: "+err.Error(), nil, http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Удален пользовательский отчет %s", id)
+		sendJSON(w, r, true, "Отчет удален", nil, http.StatusOK)
+		return
+	default:
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+
+	def, err := h.customReports.Get(id)
+	if err != nil {
+		http.Error(w, "Отчет не найден", http.StatusNotFound)
+		return
+	}
+
+	processed, err := h.snapshot(r.URL.Query().Get("result"), r.URL.Query().Get("date"))
+	if err != nil {
+		log.Printf("Снимок остатков для отчета %s не найден: %v", def.Name, err)
+		if errors.Is(err, services.ErrUnknownID) {
+			http.Error(w, "Результат обработки не найден", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	asOf, err := h.reportDate(processed, r.URL.Query().Get("date"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		table, err := processors.BuildCustomReport(*def, processed.AllItems)
+		if err != nil {
+			sendJSON(w, r, false, err.Error(), nil, http.StatusBadRequest)
+			return
+		}
+		sendJSON(w, r, true, "", table, http.StatusOK)
+		return
+	}
+
+	file, err := processors.RenderCustomReport(*def, processed.AllItems, asOf)
+	if err != nil {
+		log.Printf("Ошибка формирования отчета %s: %v", def.Name, err)
+		http.Error(w, "Ошибка формирования отчета", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", file.ContentType)
+	w.Header().Set("Content-Disposition", contentDisposition(file.Filename))
+	w.Write(file.Data)
+
+	log.Printf("Скачан пользовательский отчет %s: %s", def.Name, file.Filename)
+}
+
+// HandleSendCustomReport отправляет пользовательский отчет по email (POST /api/custom-reports/{id}/send)
+func (h *UploadHandler) HandleSendCustomReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Password   string `json:"password"`
+		ID         string `json:"id"`          // идентификатор результата обработки
+		ReportDate string `json:"report_date"` // дата остатков (без id - последний снимок на эту дату)
+		Emails     string `json:"emails"`      // пусто - получатели из определения отчета
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSON(w, r, false, "Ошибка парсинга запроса", nil, http.StatusBadRequest)
+		return
+	}
+	if req.Password != h.adminPassword {
+		log.Println("Ошибка отправки пользовательского отчета: неверный пароль")
+		sendJSON(w, r, false, "Неверный пароль", nil, http.StatusUnauthorized)
+		return
+	}
+
+	if h.smtpService == nil {
+		sendJSON(w, r, false, "SMTP сервис не настроен", nil, http.StatusInternalServerError)
+		return
+	}
+
+	def, err := h.customReports.Get(r.PathValue("id"))
+	if err != nil {
+		sendJSON(w, r, false, "Отчет не найден", nil, http.StatusNotFound)
+		return
+	}
+
+	emailList := parseEmailList(req.Emails)
+	if len(emailList) == 0 {
+		emailList = def.Emails
+	}
+	if len(emailList) == 0 {
+		sendJSON(w, r, false, "Не указаны email-адреса получателей", nil, http.StatusBadRequest)
+		return
+	}
+
+	processed, err := h.snapshot(req.ID, req.ReportDate)
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownID) {
+			sendJSON(w, r, false, "Результат обработки не найден", nil, http.StatusNotFound)
+		} else {
+			sendJSON(w, r, false, err.Error(), nil, http.StatusBadRequest)
+		}
+		return
+	}
+	asOf, err := h.reportDate(processed, req.ReportDate)
+	if err != nil {
+		sendJSON(w, r, false, err.Error(), nil, http.StatusBadRequest)
+		return
+	}
+
+	file, err := processors.RenderCustomReport(*def, processed.AllItems, asOf)
+	if err != nil {
+		log.Printf("Ошибка формирования отчета %s: %v", def.Name, err)
+		sendJSON(w, r, false, err.Error(), nil, http.StatusBadRequest)
+		return
+	}
+	if file.Count == 0 {
+		sendJSON(w, r, false, "Нет данных для отчета "+def.Name, nil, http.StatusBadRequest)
+		return
+	}
+
+	// Ключ отчета тот же, что у выкладки на SFTP
+	report := "custom:" + def.ID
+	if h.rejectIfBlocked(w, r, processed, stockRows(file.Items), report) {
+		return
+	}
+
+	delivery := &models.Delivery{
+		Report:    report,
+		Channel:   services.DeliveryEmail,
+		StockDate: asOf.Format(processors.ReportDateLayout),
+		ResultID:  processed.ID,
+		Filename:  file.Filename,
+		Items:     file.Count,
+	}
+
+	if err := h.emailCustomReport(*def, file, asOf, emailList); err != nil {
+		log.Printf("Ошибка отправки отчета %s: %v", def.Name, err)
+		delivery.Message = err.Error()
+		h.recordDelivery(delivery)
+		sendJSON(w, r, false, "Ошибка отправки email: "+err.Error(), nil, http.StatusInternalServerError)
+		return
+	}
+
+	delivery.Success = true
+	delivery.Message = strings.Join(emailList, ", ")
+	h.recordDelivery(delivery)
+
+	sendJSON(w, r, true, fmt.Sprintf("Отчет отправлен на %d адресов", len(emailList)), map[string]interface{}{
+		"emails":     emailList,
+		"count":      file.Count,
+		"correction": delivery.Correction,
+	}, http.StatusOK)
+}
+
+// emailCustomReport отправляет сформированный пользовательский отчет по email
+func (h *UploadHandler) emailCustomReport(def models.CustomReport, file *processors.CustomReportFile, asOf time.Time, emails []string) error {
+	subject := fmt.Sprintf("Отчет %s на %s", def.Name, asOf.Format("02.01.2006"))
+	body := fmt.Sprintf("Отчет %s на %s сформирован %s.\nПозиций: %d, общий остаток: %d",
+		def.Name,
+		asOf.Format("02.01.2006"),
+		h.clock.Now().Format("02.01.2006 15:04:05"),
+		file.Count, file.Total)
+
+	return h.smtpService.SendEmail(emails, subject, body, file.Data, file.Filename)
+}
+
+// contentDisposition заголовок скачивания; имя с кириллицей передается в filename* (RFC 5987)
+func contentDisposition(filename string) string {
+	ascii := strings.Map(func(r rune) rune {
+		if r > 127 {
+			return '_'
+		}
+		return r
+	}, filename)
+	return fmt.Sprintf("attachment; filename=%s; filename*=UTF-8''%s", ascii, url.PathEscape(filename))
+}
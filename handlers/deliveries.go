@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+)
+
+// HandleDeliveries возвращает журнал отправок отчетов (параметр report - фильтр по отчету)
+func (h *UploadHandler) HandleDeliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Query().Get("password") != h.adminPassword {
+		log.Println("Ошибка чтения журнала отправок: неверный пароль")
+		sendJSON(w, r, false, "Неверный пароль", nil, http.StatusUnauthorized)
+		return
+	}
+
+	if h.deliveries == nil {
+		sendJSON(w, r, false, "Журнал отправок не настроен", nil, http.StatusInternalServerError)
+		return
+	}
+
+	deliveries, err := h.deliveries.Deliveries(r.URL.Query().Get("report"))
+	if err != nil {
+		log.Printf("Ошибка чтения журнала отправок: %v", err)
+		sendJSON(w, r, false, "Ошибка чтения журнала отправок", nil, http.StatusInternalServerError)
+		return
+	}
+
+	sendJSON(w, r, true, "", deliveries, http.StatusOK)
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"sending-stocks/models"
+	"sending-stocks/processors"
+	"sending-stocks/services"
+)
+
+// HandleDownloadInvrpt скачивает остатки отчета в формате EDIFACT INVRPT (report, id или date)
+func (h *UploadHandler) HandleDownloadInvrpt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Query().Get("password") != h.adminPassword {
+		log.Println("Ошибка скачивания INVRPT: неверный пароль")
+		http.Error(w, "Неверный пароль", http.StatusUnauthorized)
+		return
+	}
+
+	date := r.URL.Query().Get("date")
+	processed, err := h.snapshot(r.URL.Query().Get("id"), date)
+	if err != nil {
+		log.Printf("Снимок остатков %s на %s не найден: %v", r.URL.Query().Get("id"), date, err)
+		if errors.Is(err, services.ErrUnknownID) {
+			http.Error(w, "Результат обработки не найден", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	asOf, err := h.reportDate(processed, date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.applyAgedPolicy(processed)
+
+	file, err := h.invrptFile(r.URL.Query().Get("report"), processed, asOf)
+	if err != nil {
+		log.Printf("Ошибка формирования INVRPT: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/edifact")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", file.Filename))
+	w.Write(file.Data)
+
+	log.Printf("Скачан файл INVRPT: %s, позиций: %d", file.Filename, file.Items)
+}
+
+// HandleSendInvrpt отправляет INVRPT по email (POST: password, report, id, report_date, emails -
+// по умолчанию из настроек INVRPT отчета)
+func (h *UploadHandler) HandleSendInvrpt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Password   string `json:"password"`
+		Report     string `json:"report"`      // pirelli, cordiant, hankook, ikon или all
+		ID         string `json:"id"`          // идентификатор результата обработки
+		ReportDate string `json:"report_date"` // дата остатков (без id - последний снимок на эту дату)
+		Emails     string `json:"emails"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSON(w, r, false, "Ошибка парсинга запроса", nil, http.StatusBadRequest)
+		return
+	}
+	if req.Password != h.adminPassword {
+		log.Println("Ошибка отправки INVRPT: неверный пароль")
+		sendJSON(w, r, false, "Неверный пароль", nil, http.StatusUnauthorized)
+		return
+	}
+
+	if h.smtpService == nil {
+		sendJSON(w, r, false, "SMTP сервис не настроен", nil, http.StatusInternalServerError)
+		return
+	}
+	if h.invrptProcessor == nil || h.invrptProcessor.Config(req.Report) == nil {
+		sendJSON(w, r, false, fmt.Sprintf("INVRPT для отчета %q не настроен", req.Report), nil, http.StatusBadRequest)
+		return
+	}
+
+	emailList := parseEmailList(req.Emails)
+	if len(emailList) == 0 {
+		emailList = h.invrptProcessor.Config(req.Report).Emails
+	}
+	if len(emailList) == 0 {
+		sendJSON(w, r, false, "Не указаны email-адреса получателей", nil, http.StatusBadRequest)
+		return
+	}
+
+	processed, err := h.snapshot(req.ID, req.ReportDate)
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownID) {
+			sendJSON(w, r, false, "Результат обработки не найден", nil, http.StatusNotFound)
+		} else {
+			sendJSON(w, r, false, err.Error(), nil, http.StatusBadRequest)
+		}
+		return
+	}
+	asOf, err := h.reportDate(processed, req.ReportDate)
+	if err != nil {
+		sendJSON(w, r, false, err.Error(), nil, http.StatusBadRequest)
+		return
+	}
+
+	h.applyAgedPolicy(processed)
+
+	file, err := h.invrptFile(req.Report, processed, asOf)
+	if err != nil {
+		log.Printf("Ошибка формирования INVRPT: %v", err)
+		sendJSON(w, r, false, err.Error(), nil, http.StatusBadRequest)
+		return
+	}
+	if file.Items == 0 {
+		sendJSON(w, r, false, "Нет данных для INVRPT "+req.Report, nil, http.StatusBadRequest)
+		return
+	}
+	if h.rejectIfBlocked(w, r, processed, file.Rows, "INVRPT "+req.Report) {
+		return
+	}
+
+	subject := fmt.Sprintf("INVRPT %s на %s", req.Report, asOf.Format("02.01.2006"))
+	body := fmt.Sprintf("Отчет об остатках INVRPT (%s) на %s сформирован %s.\nСтрок: %d",
+		req.Report,
+		asOf.Format("02.01.2006"),
+		h.clock.Now().Format("02.01.2006 15:04:05"),
+		file.Items)
+
+	// Ключ отчета тот же, что у выкладки на SFTP
+	delivery := &models.Delivery{
+		Report:    "invrpt:" + req.Report,
+		Channel:   services.DeliveryEmail,
+		StockDate: asOf.Format(processors.ReportDateLayout),
+		ResultID:  processed.ID,
+		Filename:  file.Filename,
+		Items:     file.Items,
+	}
+
+	if err := h.smtpService.SendEmail(emailList, subject, body, file.Data, file.Filename); err != nil {
+		log.Printf("Ошибка отправки email: %v", err)
+		delivery.Message = err.Error()
+		h.recordDelivery(delivery)
+		sendJSON(w, r, false, "Ошибка отправки email: "+err.Error(), nil, http.StatusInternalServerError)
+		return
+	}
+
+	delivery.Success = true
+	delivery.Message = strings.Join(emailList, ", ")
+	h.recordDelivery(delivery)
+
+	sendJSON(w, r, true, fmt.Sprintf("INVRPT отправлен на %d адресов", len(emailList)), map[string]interface{}{
+		"emails":     emailList,
+		"lines":      file.Items,
+		"correction": delivery.Correction,
+	}, http.StatusOK)
+}
+
+// invrptFile формирует INVRPT по позициям отчета производителя; Items - количество строк LIN
+func (h *UploadHandler) invrptFile(report string, processed *models.ProcessedFile, asOf time.Time) (*reportFile, error) {
+	if h.invrptProcessor == nil {
+		return nil, fmt.Errorf("INVRPT не настроен")
+	}
+	config := h.invrptProcessor.Config(report)
+	if config == nil {
+		return nil, fmt.Errorf("INVRPT для отчета %q не настроен", report)
+	}
+
+	items, err := h.invrptItems(report, processed)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := h.invrptProcessor.CreateMessage(config, items, asOf)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Skipped > 0 {
+		log.Printf("INVRPT %s: пропущено позиций без кода производителя: %d", report, msg.Skipped)
+	}
+
+	return &reportFile{
+		Data:     msg.Data,
+		Filename: h.invrptProcessor.GenerateFilename(report, asOf),
+		Items:    msg.Lines,
+		Rows:     stockRows(items),
+	}, nil
+}
+
+// invrptItems позиции, которые попадают в отчет производителя
+func (h *UploadHandler) invrptItems(report string, processed *models.ProcessedFile) ([]models.StockItem, error) {
+	switch {
+	case report == "pirelli":
+		return processed.PirelliItems, nil
+	case report == "hankook" && h.hankookProcessor != nil:
+		return h.hankookProcessor.FilterItems(processed.AllItems), nil
+	case report == "cordiant" && h.cordiantProcessor != nil:
+		cordiantItems := h.cordiantProcessor.FilterItems(processed.AllItems)
+		keys := make(map[string]bool, len(cordiantItems))
+		for _, item := range cordiantItems {
+			keys[models.RowKey(item.Source, item.Sheet, item.RowNum)] = true
+		}
+		items := make([]models.StockItem, 0, len(cordiantItems))
+		for _, item := range processed.AllItems {
+			if keys[models.RowKey(item.Source, item.Sheet, item.RowNum)] {
+				items = append(items, item)
+			}
+		}
+		return items, nil
+	case report == "ikon", report == "all":
+		return processed.AllItems, nil
+	}
+	return nil, fmt.Errorf("отчет %s не поддерживается или не настроен", report)
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// HandleDownloadQualityReport скачивает исходную ведомость с подсвеченными проблемными строками
+func (h *UploadHandler) HandleDownloadQualityReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+
+	password := r.URL.Query().Get("password")
+	id := r.URL.Query().Get("id")
+
+	if password != h.adminPassword {
+		log.Println("Ошибка скачивания отчета о качестве: неверный пароль")
+		http.Error(w, "Неверный пароль", http.StatusUnauthorized)
+		return
+	}
+
+	processed, err := h.results.Load(id)
+	if err != nil {
+		log.Printf("Результат обработки %s не найден: %v", id, err)
+		http.Error(w, "Результат обработки не найден", http.StatusNotFound)
+		return
+	}
+
+	// Для объединенного снимка размечается один из исходных файлов
+	// (параметр source - идентификатор загрузки, по умолчанию первый)
+	uploadID := processed.UploadID
+	source := ""
+	if len(processed.SourceIDs) > 0 {
+		uploadID = r.URL.Query().Get("source")
+		if uploadID == "" {
+			uploadID = processed.SourceIDs[0]
+		}
+		index := -1
+		for i, sourceID := range processed.SourceIDs {
+			if sourceID == uploadID {
+				index = i
+				break
+			}
+		}
+		if index < 0 || index >= len(processed.SourceFiles) {
+			http.Error(w, "Файл не входит в объединенный снимок", http.StatusBadRequest)
+			return
+		}
+		source = processed.SourceFiles[index]
+	}
+
+	// Открываем исходный файл из 1С
+	_, originalPath, err := h.uploadStore.Resolve(uploadID)
+	if err != nil {
+		log.Printf("Исходный файл %s не найден: %v", uploadID, err)
+		http.Error(w, "Исходный файл не найден", http.StatusNotFound)
+		return
+	}
+
+	f, err := excelize.OpenFile(originalPath)
+	if err != nil {
+		log.Printf("Ошибка открытия исходного файла %s: %v", originalPath, err)
+		http.Error(w, "Исходный файл не найден", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	if err := h.qualityProcessor.Annotate(f, processed, source); err != nil {
+		log.Printf("Ошибка создания отчета о качестве: %v", err)
+		http.Error(w, "Ошибка создания отчета", http.StatusInternalServerError)
+		return
+	}
+
+	h.serveExcel(w, r, f, h.qualityProcessor.GenerateFilename())
+	log.Println("Скачан отчет о качестве данных")
+}
+
+// HandleDownloadAgedReport скачивает внутренний отчет по залежалому товару
+func (h *UploadHandler) HandleDownloadAgedReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+
+	password := r.URL.Query().Get("password")
+	id := r.URL.Query().Get("id")
+
+	if password != h.adminPassword {
+		log.Println("Ошибка скачивания отчета по залежалому товару: неверный пароль")
+		http.Error(w, "Неверный пароль", http.StatusUnauthorized)
+		return
+	}
+
+	if h.agedProcessor == nil {
+		log.Println("Ошибка: процессор залежалого товара не инициализирован")
+		http.Error(w, "Процессор залежалого товара не настроен", http.StatusInternalServerError)
+		return
+	}
+
+	processed, err := h.results.Load(id)
+	if err != nil {
+		log.Printf("Результат обработки %s не найден: %v", id, err)
+		http.Error(w, "Результат обработки не найден", http.StatusNotFound)
+		return
+	}
+
+	f, err := h.agedProcessor.CreateReport(processed.AllItems)
+	if err != nil {
+		log.Printf("Ошибка создания отчета по залежалому товару: %v", err)
+		http.Error(w, "Ошибка создания отчета", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	h.serveExcel(w, r, f, h.agedProcessor.GenerateFilename())
+	log.Println("Скачан отчет по залежалому товару")
+}
+
+// serveExcel сохраняет книгу во временный файл и отдает ее на скачивание
+func (h *UploadHandler) serveExcel(w http.ResponseWriter, r *http.Request, f *excelize.File, downloadFilename string) {
+	tmpFile, err := os.CreateTemp("", "report-*.xlsx")
+	if err != nil {
+		log.Printf("Ошибка создания временного файла: %v", err)
+		http.Error(w, "Ошибка создания файла", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	if err := f.SaveAs(tmpFile.Name()); err != nil {
+		log.Printf("Ошибка сохранения Excel: %v", err)
+		http.Error(w, "Ошибка сохранения файла", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=%s", downloadFilename))
+
+	http.ServeFile(w, r, tmpFile.Name())
+}
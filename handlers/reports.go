@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"sending-stocks/models"
+	"sending-stocks/services"
+)
+
+// HandleValuationReport отчет о стоимости остатков по цене из ведомости (id или date):
+// Excel, а с format=json - данные для дашбордов
+func (h *UploadHandler) HandleValuationReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Query().Get("password") != h.adminPassword {
+		log.Println("Ошибка отчета о стоимости остатков: неверный пароль")
+		http.Error(w, "Неверный пароль", http.StatusUnauthorized)
+		return
+	}
+
+	date := r.URL.Query().Get("date")
+	processed, err := h.snapshot(r.URL.Query().Get("id"), date)
+	if err != nil {
+		log.Printf("Снимок остатков %s на %s не найден: %v", r.URL.Query().Get("id"), date, err)
+		if errors.Is(err, services.ErrUnknownID) {
+			http.Error(w, "Результат обработки не найден", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	asOf, err := h.reportDate(processed, date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	valuation := h.valuationProcessor.Calculate(h.valuationItems(processed), asOf)
+
+	if r.URL.Query().Get("format") == "json" {
+		sendJSON(w, r, true, "", valuation, http.StatusOK)
+		return
+	}
+
+	f, err := h.valuationProcessor.CreateReport(valuation)
+	if err != nil {
+		log.Printf("Ошибка создания отчета о стоимости остатков: %v", err)
+		http.Error(w, "Ошибка создания отчета", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	h.serveExcel(w, r, f, h.valuationProcessor.GenerateFilename(asOf))
+	log.Printf("Скачан отчет о стоимости остатков на %s", valuation.StockDate)
+}
+
+// valuationItems позиции для оценки по складам. Источник позиции - имя файла у пользователя, но в объединенных
+// снимках, сохраненных раньше, там имя загрузки на диске (с датой и временем); его заменяем именем файла
+// у пользователя, повторяющиеся имена - с номером, как при объединении
+func (h *UploadHandler) valuationItems(processed *models.ProcessedFile) []models.StockItem {
+	names := make(map[string]string)
+	used := make(map[string]bool)
+	for i, stored := range processed.SourceFiles {
+		name := stored
+		if i < len(processed.SourceIDs) {
+			if record, _, err := h.uploadStore.Resolve(processed.SourceIDs[i]); err == nil && record.Filename == stored {
+				name = record.OriginalName
+				for n := 2; used[name]; n++ {
+					name = fmt.Sprintf("%s (%d)", record.OriginalName, n)
+				}
+				names[stored] = name
+			}
+		}
+		used[name] = true
+	}
+	if len(names) == 0 {
+		return processed.AllItems
+	}
+
+	items := slices.Clone(processed.AllItems)
+	for i := range items {
+		if name, ok := names[items[i].Source]; ok {
+			items[i].Source = name
+		}
+		if len(items[i].Sources) > 0 {
+			items[i].Sources = slices.Clone(items[i].Sources)
+			for j := range items[i].Sources {
+				if name, ok := names[items[i].Sources[j].Source]; ok {
+					items[i].Sources[j].Source = name
+				}
+			}
+		}
+	}
+	return items
+}
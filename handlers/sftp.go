@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"sending-stocks/models"
+	"sending-stocks/processors"
+	"sending-stocks/services"
+)
+
+// reportFile готовый файл отчета для выкладки
+type reportFile struct {
+	Data     []byte
+	Filename string
+	Items    int
+	Rows     map[string]bool // строки ведомости в отчете (для блокировки по ошибкам валидации)
+}
+
+// HandleSendSFTP выкладывает отчет на SFTP сервер получателя (POST: password, target, id, report_date)
+func (h *UploadHandler) HandleSendSFTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Password   string `json:"password"`
+		Target     string `json:"target"`      // получатель из SFTP_TARGETS_FILE
+		ID         string `json:"id"`          // идентификатор результата обработки
+		ReportDate string `json:"report_date"` // дата остатков (без id - последний снимок на эту дату)
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSON(w, r, false, "Ошибка парсинга запроса", nil, http.StatusBadRequest)
+		return
+	}
+	if req.Password != h.adminPassword {
+		log.Println("Ошибка выкладки на SFTP: неверный пароль")
+		sendJSON(w, r, false, "Неверный пароль", nil, http.StatusUnauthorized)
+		return
+	}
+
+	if h.sftpService == nil {
+		sendJSON(w, r, false, "SFTP получатели не настроены", nil, http.StatusInternalServerError)
+		return
+	}
+	target, err := h.sftpService.Target(req.Target)
+	if err != nil {
+		sendJSON(w, r, false, fmt.Sprintf("SFTP получатель %q не найден", req.Target), nil, http.StatusNotFound)
+		return
+	}
+
+	processed, err := h.snapshot(req.ID, req.ReportDate)
+	if err != nil {
+		log.Printf("Снимок остатков %s на %s не найден: %v", req.ID, req.ReportDate, err)
+		if errors.Is(err, services.ErrUnknownID) {
+			sendJSON(w, r, false, "Результат обработки не найден", nil, http.StatusNotFound)
+		} else {
+			sendJSON(w, r, false, err.Error(), nil, http.StatusBadRequest)
+		}
+		return
+	}
+	asOf, err := h.reportDate(processed, req.ReportDate)
+	if err != nil {
+		sendJSON(w, r, false, err.Error(), nil, http.StatusBadRequest)
+		return
+	}
+
+	h.applyAgedPolicy(processed)
+
+	file, err := h.reportFile(target.Report, processed, asOf)
+	if err != nil {
+		log.Printf("Ошибка формирования отчета %s для SFTP %s: %v", target.Report, target.Name, err)
+		sendJSON(w, r, false, err.Error(), nil, http.StatusBadRequest)
+		return
+	}
+	if file.Items == 0 {
+		sendJSON(w, r, false, "Нет данных для отчета "+target.Report, nil, http.StatusBadRequest)
+		return
+	}
+	if h.rejectIfBlocked(w, r, processed, file.Rows, target.Report) {
+		return
+	}
+
+	delivery := &models.Delivery{
+		Report:    target.Report,
+		Channel:   services.DeliverySFTP,
+		StockDate: asOf.Format(processors.ReportDateLayout),
+		ResultID:  processed.ID,
+		Filename:  file.Filename,
+		Items:     file.Items,
+	}
+
+	upload, err := h.sftpService.Upload(target.Name, file.Data, file.Filename, asOf)
+	if err != nil {
+		log.Printf("Ошибка выкладки %s на SFTP %s: %v", file.Filename, target.Name, err)
+		delivery.Message = fmt.Sprintf("%s: %v", target.Name, err)
+		h.recordDelivery(delivery)
+		sendJSON(w, r, false, "Ошибка выкладки на SFTP: "+err.Error(), nil, http.StatusBadGateway)
+		return
+	}
+
+	delivery.Success = true
+	delivery.Filename = upload.RemotePath
+	delivery.Message = fmt.Sprintf("%s: %d байт, SHA-256 %s", target.Name, upload.Size, upload.SHA256)
+	h.recordDelivery(delivery)
+
+	log.Printf("Отчет %s выложен на SFTP %s: %s", target.Report, target.Name, upload.RemotePath)
+	sendJSON(w, r, true, fmt.Sprintf("Файл выложен: %s", upload.RemotePath), map[string]interface{}{
+		"upload":     upload,
+		"items":      file.Items,
+		"correction": delivery.Correction,
+	}, http.StatusOK)
+}
+
+// reportFile формирует файл отчета по его ключу: pirelli_csv, pirelli_excel, ikon, hankook,
+// cordiant_csv, invrpt:<отчет> (EDIFACT INVRPT) или custom:<id> (пользовательский отчет)
+func (h *UploadHandler) reportFile(report string, processed *models.ProcessedFile, asOf time.Time) (*reportFile, error) {
+	switch {
+	case report == "pirelli_csv":
+		var buf bytes.Buffer
+		if err := h.pirelliProcessor.CreateCSV(processed.PirelliItems, &buf, asOf); err != nil {
+			return nil, err
+		}
+		return &reportFile{
+			Data:     buf.Bytes(),
+			Filename: h.pirelliProcessor.GenerateFilename(asOf),
+			Items:    len(processed.PirelliItems),
+			Rows:     stockRows(processed.PirelliItems),
+		}, nil
+
+	case report == "pirelli_excel" && h.pirelliExcelProcessor != nil:
+		items := h.pirelliExcelProcessor.FilterItems(processed.AllItems)
+		data, err := h.excelBytes("pirelli", processed, asOf, func() (*excelize.File, error) {
+			return h.pirelliExcelProcessor.CreateExcelReport(processed.AllItems)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &reportFile{
+			Data:     data,
+			Filename: h.pirelliExcelProcessor.GenerateFilename(asOf),
+			Items:    len(items),
+			Rows:     stockRows(items),
+		}, nil
+
+	case report == "ikon" && h.ikonProcessor != nil:
+		data, err := h.excelBytes("ikon", processed, asOf, func() (*excelize.File, error) {
+			return h.ikonProcessor.CreateReport(ikonItems(processed))
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &reportFile{
+			Data:     data,
+			Filename: h.ikonProcessor.GenerateFilename(asOf),
+			Items:    len(processed.AllItems),
+			Rows:     stockRows(processed.AllItems),
+		}, nil
+
+	case report == "hankook" && h.hankookProcessor != nil:
+		items := h.hankookProcessor.FilterItems(processed.AllItems)
+		data, err := h.excelBytes("hankook", processed, asOf, func() (*excelize.File, error) {
+			return h.hankookProcessor.CreateExcelReport(processed.AllItems)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &reportFile{
+			Data:     data,
+			Filename: h.hankookProcessor.GenerateFilename(asOf),
+			Items:    len(items),
+			Rows:     stockRows(items),
+		}, nil
+
+	case report == "cordiant_csv" && h.cordiantProcessor != nil:
+		items := h.cordiantProcessor.FilterItems(processed.AllItems)
+		data, err := h.cordiantProcessor.CreateCSVWithEncoding(items, "windows-1251")
+		if err != nil {
+			return nil, err
+		}
+		rows := make(map[string]bool, len(items))
+		for _, item := range items {
+			rows[models.RowKey(item.Source, item.Sheet, item.RowNum)] = true
+		}
+		return &reportFile{
+			Data:     data,
+			Filename: h.cordiantProcessor.GenerateFilename(asOf),
+			Items:    len(items),
+			Rows:     rows,
+		}, nil
+
+	case strings.HasPrefix(report, "invrpt:"):
+		return h.invrptFile(strings.TrimPrefix(report, "invrpt:"), processed, asOf)
+
+	case strings.HasPrefix(report, "custom:"):
+		def, err := h.customReports.Get(strings.TrimPrefix(report, "custom:"))
+		if err != nil {
+			return nil, fmt.Errorf("пользовательский отчет %s не найден", strings.TrimPrefix(report, "custom:"))
+		}
+		file, err := processors.RenderCustomReport(*def, processed.AllItems, asOf)
+		if err != nil {
+			return nil, err
+		}
+		return &reportFile{
+			Data:     file.Data,
+			Filename: file.Filename,
+			Items:    file.Count,
+			Rows:     stockRows(file.Items),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("отчет %s не поддерживается или не настроен", report)
+}
+
+// excelBytes формирует книгу отчета (с учетом загруженного шаблона) и возвращает ее содержимое
+func (h *UploadHandler) excelBytes(report string, processed *models.ProcessedFile, asOf time.Time, build func() (*excelize.File, error)) ([]byte, error) {
+	f, err := h.buildReport(report, processed, asOf, build)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+)
+
+// HandleStatus возвращает состояние интеграций; для Cordiant выполняется реальная проверка
+// подключения и учетных данных (параметр check=cordiant), остальные только показывают настройку
+func (h *UploadHandler) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Query().Get("password") != h.adminPassword {
+		log.Println("Ошибка получения статуса: неверный пароль")
+		sendJSON(w, r, false, "Неверный пароль", nil, http.StatusUnauthorized)
+		return
+	}
+
+	data := map[string]interface{}{
+		"smtp":     h.smtpService != nil,
+		"pirelli":  h.pirelliAPI != nil,
+		"cordiant": h.cordiantAPI != nil,
+	}
+	if h.sftpService != nil {
+		targets := make([]string, 0, len(h.sftpService.Targets))
+		for _, target := range h.sftpService.Targets {
+			targets = append(targets, target.Name)
+		}
+		data["sftp"] = targets
+	}
+
+	if r.URL.Query().Get("check") == "cordiant" {
+		if h.cordiantAPI == nil {
+			sendJSON(w, r, false, "API Cordiant не настроен", data, http.StatusOK)
+			return
+		}
+		status := h.cordiantAPI.CheckConnection()
+		data["cordiant_status"] = status
+		log.Printf("Проверка Cordiant: %s", status.Message)
+		sendJSON(w, r, status.Reachable && (status.Authenticated || status.TokenSource == "static"), status.Message, data, http.StatusOK)
+		return
+	}
+
+	sendJSON(w, r, true, "", data, http.StatusOK)
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"sending-stocks/models"
+	"sending-stocks/processors"
+	"sending-stocks/services"
+)
+
+// TemplateReports отчеты, которые можно формировать по Excel шаблону производителя
+var TemplateReports = []string{"pirelli", "ikon", "hankook"}
+
+// maxTemplateSize максимальный размер файла шаблона
+const maxTemplateSize = 10 << 20
+
+// HandleReportTemplates список (GET), загрузка (POST, multipart: report, file) и удаление (DELETE ?report=)
+// Excel шаблонов отчетов
+func (h *UploadHandler) HandleReportTemplates(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if r.URL.Query().Get("password") != h.adminPassword {
+			http.Error(w, "Неверный пароль", http.StatusUnauthorized)
+			return
+		}
+		sendJSON(w, r, true, "", map[string]interface{}{
+			"reports":   TemplateReports,
+			"templates": h.templates.List(),
+		}, http.StatusOK)
+
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, maxTemplateSize+1<<20)
+		if err := r.ParseMultipartForm(maxTemplateSize); err != nil {
+			sendJSON(w, r, false, "Ошибка чтения формы: "+err.Error(), nil, http.StatusBadRequest)
+			return
+		}
+		if r.FormValue("password") != h.adminPassword {
+			log.Println("Ошибка загрузки шаблона: неверный пароль")
+			sendJSON(w, r, false, "Неверный пароль", nil, http.StatusUnauthorized)
+			return
+		}
+
+		report := r.FormValue("report")
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			sendJSON(w, r, false, "Файл шаблона не передан", nil, http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			sendJSON(w, r, false, "Ошибка чтения файла", nil, http.StatusBadRequest)
+			return
+		}
+		if err := h.templates.Save(report, data); err != nil {
+			log.Printf("Шаблон %s (%s) отклонен: %v", report, header.Filename, err)
+			sendJSON(w, r, false, err.Error(), nil, http.StatusBadRequest)
+			return
+		}
+
+		log.Printf("Загружен шаблон отчета %s: %s", report, header.Filename)
+		sendJSON(w, r, true, fmt.Sprintf("Шаблон отчета %s загружен", report), nil, http.StatusOK)
+
+	case http.MethodDelete:
+		if r.URL.Query().Get("password") != h.adminPassword {
+			http.Error(w, "Неверный пароль", http.StatusUnauthorized)
+			return
+		}
+		report := r.URL.Query().Get("report")
+		if err := h.templates.Delete(report); err != nil {
+			if err == services.ErrUnknownID {
+				sendJSON(w, r, false, "Шаблон не найден", nil, http.StatusNotFound)
+				return
+			}
+			sendJSON(w, r, false, "Ошибка удаления шаблона: "+err.Error(), nil, http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Удален шаблон отчета %s", report)
+		sendJSON(w, r, true, fmt.Sprintf("Шаблон отчета %s удален", report), nil, http.StatusOK)
+
+	default:
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+	}
+}
+
+// buildReport формирует книгу отчета по загруженному шаблону, а если шаблона нет - функцией build
+func (h *UploadHandler) buildReport(report string, processed *models.ProcessedFile, asOf time.Time, build func() (*excelize.File, error)) (*excelize.File, error) {
+	if h.templates == nil {
+		return build()
+	}
+	f, err := h.templates.Open(report)
+	if err != nil {
+		return nil, err
+	}
+	if f == nil {
+		return build()
+	}
+
+	var (
+		items  []models.StockItem
+		values map[string]int
+	)
+	company := processed.Organization
+	switch report {
+	case "pirelli":
+		items = h.pirelliExcelProcessor.FilterItems(processed.AllItems)
+	case "hankook":
+		items = h.hankookProcessor.FilterItems(processed.AllItems)
+	case "ikon":
+		for _, detail := range h.ikonProcessor.Details(ikonItems(processed)) {
+			items = append(items, detail.Item)
+		}
+		values = h.ikonProcessor.Values(ikonItems(processed))
+		company = h.ikonProcessor.CompanyName
+	}
+
+	if err := processors.RenderTemplate(f, processors.NewTemplateData(report, asOf, company, items, values)); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("ошибка заполнения шаблона: %v", err)
+	}
+	log.Printf("Отчет %s сформирован по шаблону", report)
+	return f, nil
+}
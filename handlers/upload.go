@@ -2,12 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -40,6 +41,18 @@ type UploadHandler struct {
 	pirelliExcelProcessor *processors.PirelliExcelProcessor
 	cordiantProcessor     *processors.CordiantProcessor
 	hankookProcessor      *processors.HankookProcessor
+	agedProcessor         *processors.AgedStockProcessor
+	invrptProcessor       *processors.InvrptProcessor
+	valuationProcessor    *processors.ValuationProcessor
+	qualityProcessor      *processors.QualityReportProcessor
+	combiner              *processors.StockCombiner
+	uploadStore           *services.UploadStore
+	results               *services.ResultStore
+	deliveries            *services.DeliveryLog
+	templates             *services.TemplateStore
+	customReports         *services.CustomReportStore
+	sftpService           *services.SFTPService
+	clock                 models.Clock
 }
 
 // NewUploadHandler создает новый обработчик
@@ -63,8 +76,18 @@ func NewUploadHandler(
 	pirelliExcelProc *processors.PirelliExcelProcessor,
 	cordiantProc *processors.CordiantProcessor,
 	hankookProc *processors.HankookProcessor,
+	agedProc *processors.AgedStockProcessor,
+	invrptProc *processors.InvrptProcessor,
+	valuationProc *processors.ValuationProcessor,
+	combiner *processors.StockCombiner,
+	uploadStore *services.UploadStore,
+	deliveries *services.DeliveryLog,
+	templates *services.TemplateStore,
+	customReports *services.CustomReportStore,
+	sftpService *services.SFTPService,
+	clock models.Clock,
 ) *UploadHandler {
-	return &UploadHandler{
+	h := &UploadHandler{
 		adminPassword:         adminPassword,
 		uploadDir:             uploadDir,
 		processedDir:          processedDir,
@@ -80,12 +103,46 @@ func NewUploadHandler(
 		pirelliAPI:            pirelliAPI,
 		cordiantAPI:           cordiantAPI,
 		smtpService:           smtpService,
-		pirelliProcessor:      processors.NewPirelliProcessor(customerCode),
+		pirelliProcessor:      processors.NewPirelliProcessor(customerCode, clock),
 		ikonProcessor:         ikonProc,
 		pirelliExcelProcessor: pirelliExcelProc,
 		cordiantProcessor:     cordiantProc,
 		hankookProcessor:      hankookProc,
+		agedProcessor:         agedProc,
+		invrptProcessor:       invrptProc,
+		valuationProcessor:    valuationProc,
+		combiner:              combiner,
+		uploadStore:           uploadStore,
+		results:               services.NewResultStore(processedDir),
+		deliveries:            deliveries,
+		templates:             templates,
+		customReports:         customReports,
+		sftpService:           sftpService,
+		clock:                 clock,
 	}
+
+	// Отчеты, для которых показываются исключенные строки в отчете о качестве данных
+	checkers := []processors.ExclusionChecker{
+		{Report: "Pirelli CSV", Reason: h.pirelliProcessor.ExclusionReason},
+	}
+	if pirelliExcelProc != nil {
+		checkers = append(checkers, processors.ExclusionChecker{Report: "Pirelli Excel", Reason: pirelliExcelProc.ExclusionReason})
+	}
+	if ikonProc != nil {
+		checkers = append(checkers, processors.ExclusionChecker{Report: "Ikon", Reason: ikonProc.ExclusionReason})
+	}
+	if cordiantProc != nil {
+		checkers = append(checkers, processors.ExclusionChecker{Report: "Cordiant", Reason: cordiantProc.ExclusionReason})
+	}
+	if hankookProc != nil {
+		checkers = append(checkers, processors.ExclusionChecker{Report: "Hankook", Reason: hankookProc.ExclusionReason})
+	}
+	if agedProc != nil {
+		checkers = append(checkers, processors.ExclusionChecker{Report: "Отчеты производителей", Reason: agedProc.ExclusionReason})
+	}
+	h.qualityProcessor = processors.NewQualityReportProcessor(checkers, clock)
+
+	return h
 }
 
 // HandleCheckPassword проверяет пароль
@@ -120,6 +177,21 @@ func (h *UploadHandler) HandleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Ограничиваем размер запроса (файл + поля формы)
+	r.Body = http.MaxBytesReader(w, r.Body, h.uploadStore.MaxSize+1<<20)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			log.Printf("Ошибка загрузки: превышен размер запроса (%d байт)", maxBytesErr.Limit)
+			sendJSON(w, r, false, fmt.Sprintf("Файл слишком большой (максимум %d МБ)", h.uploadStore.MaxSize>>20), nil, http.StatusRequestEntityTooLarge)
+			return
+		}
+		log.Printf("Ошибка чтения формы загрузки: %v", err)
+		sendJSON(w, r, false, "Ошибка чтения файла: "+err.Error(), nil, http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
 	password := r.FormValue("password")
 
 	if password != h.adminPassword {
@@ -142,29 +214,53 @@ func (h *UploadHandler) HandleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	filename := fmt.Sprintf("%s_%s", time.Now().Format("20060102_150405"), header.Filename)
-	filepath := filepath.Join(h.uploadDir, filename)
-
-	dst, err := os.Create(filepath)
+	// Сохраняем под безопасным именем с проверкой содержимого и контрольной суммой
+	record, previous, err := h.uploadStore.Save(header.Filename, file)
 	if err != nil {
-		log.Printf("Ошибка создания файла: %v", err)
-		sendJSON(w, r, false, "Ошибка сохранения файла", nil, http.StatusInternalServerError)
+		log.Printf("Файл %s отклонен: %v", header.Filename, err)
+		switch {
+		case errors.Is(err, services.ErrUploadTooLarge):
+			sendJSON(w, r, false, err.Error(), nil, http.StatusRequestEntityTooLarge)
+		case errors.Is(err, services.ErrUploadInvalid):
+			sendJSON(w, r, false, err.Error(), nil, http.StatusBadRequest)
+		default:
+			sendJSON(w, r, false, "Ошибка сохранения файла", nil, http.StatusInternalServerError)
+		}
 		return
 	}
-	defer dst.Close()
 
-	bytesWritten, err := io.Copy(dst, file)
-	if err != nil {
-		log.Printf("Ошибка копирования файла: %v", err)
-		sendJSON(w, r, false, "Ошибка сохранения файла", nil, http.StatusInternalServerError)
-		return
-	}
+	log.Printf("Файл загружен: %s (размер: %d байт, SHA-256: %s)", record.Filename, record.Size, record.SHA256)
 
-	log.Printf("Файл загружен: %s (размер: %d байт)", filename, bytesWritten)
+	// Список листов для выбора перед обработкой
+	sheets := make([]string, 0)
+	if xf, err := excelize.OpenFile(filepath.Join(h.uploadDir, record.Filename)); err == nil {
+		sheets = xf.GetSheetList()
+		xf.Close()
+	} else {
+		log.Printf("Ошибка чтения листов файла %s: %v", record.Filename, err)
+	}
+
+	data := map[string]interface{}{
+		"id":       record.ID,
+		"filename": record.OriginalName,
+		"sha256":   record.SHA256,
+		"size":     record.Size,
+		"sheets":   sheets,
+	}
+
+	// Такой же файл уже загружался
+	if previous != nil {
+		warning := fmt.Sprintf("Файл с таким же содержимым уже загружен %s (%s)", previous.UploadedAt, previous.OriginalName)
+		log.Printf("Повторная загрузка %s: совпадает с %s", record.Filename, previous.Filename)
+		data["warning"] = warning
+		data["duplicate_of"] = map[string]string{
+			"id":            previous.ID,
+			"original_name": previous.OriginalName,
+			"uploaded_at":   previous.UploadedAt,
+		}
+	}
 
-	sendJSON(w, r, true, "Файл загружен", map[string]string{
-		"filename": filename,
-	}, http.StatusOK)
+	sendJSON(w, r, true, "Файл загружен", data, http.StatusOK)
 }
 
 // HandleProcess обрабатывает файл
@@ -175,8 +271,9 @@ func (h *UploadHandler) HandleProcess(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Password string `json:"password"`
-		Filename string `json:"filename"`
+		Password string   `json:"password"`
+		UploadID string   `json:"upload_id"`
+		Sheets   []string `json:"sheets"` // листы для обработки (по умолчанию первый)
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -191,38 +288,158 @@ func (h *UploadHandler) HandleProcess(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	filePath := filepath.Join(h.uploadDir, req.Filename)
+	record, filePath, err := h.uploadStore.Resolve(req.UploadID)
+	if err != nil {
+		log.Printf("Загрузка %s не найдена: %v", req.UploadID, err)
+		sendJSON(w, r, false, "Загруженный файл не найден", nil, http.StatusNotFound)
+		return
+	}
+
 	f, err := excelize.OpenFile(filePath)
 	if err != nil {
-		log.Printf("Ошибка открытия Excel файла %s: %v", req.Filename, err)
+		log.Printf("Ошибка открытия Excel файла %s: %v", record.Filename, err)
 		sendJSON(w, r, false, "Ошибка открытия Excel файла: "+err.Error(), nil, http.StatusInternalServerError)
 		return
 	}
 	defer f.Close()
 
-	processed, err := h.parser.Parse(f)
+	var processed *models.ProcessedFile
+	if len(req.Sheets) > 0 {
+		processed, err = h.parser.ParseSheets(f, req.Sheets)
+	} else {
+		processed, err = h.parser.Parse(f)
+	}
 	if err != nil {
-		log.Printf("Ошибка парсинга файла %s: %v", req.Filename, err)
+		log.Printf("Ошибка парсинга файла %s: %v", record.Filename, err)
 		sendJSON(w, r, false, "Ошибка обработки: "+err.Error(), nil, http.StatusInternalServerError)
 		return
 	}
 
-	processed.OriginalFile = req.Filename
+	processed.UploadID = record.ID
+	processed.OriginalFile = record.Filename
+	processed.OriginalName = record.OriginalName
 
-	resultPath := filepath.Join(h.processedDir, processed.Filename)
-	resultData, _ := json.MarshalIndent(processed, "", "  ")
-	if err := os.WriteFile(resultPath, resultData, 0644); err != nil {
+	if err := h.storeProcessed(processed); err != nil {
 		log.Printf("Ошибка сохранения результата: %v", err)
 		sendJSON(w, r, false, "Ошибка сохранения результата", nil, http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Файл обработан: %s, всего строк: %d, Pirelli: %d",
-		req.Filename, processed.Stats.TotalRows, processed.Stats.PirelliCount)
+	log.Printf("Файл обработан: %s (листы: %s), всего строк: %d, Pirelli: %d",
+		record.Filename, strings.Join(processed.Sheets, ", "), processed.Stats.TotalRows, processed.Stats.PirelliCount)
 
 	sendJSON(w, r, true, "Файл обработан", processed, http.StatusOK)
 }
 
+// HandleCombine объединяет несколько загруженных ведомостей в один снимок остатков
+func (h *UploadHandler) HandleCombine(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Password  string              `json:"password"`
+		UploadIDs []string            `json:"upload_ids"`
+		Sheets    map[string][]string `json:"sheets"` // листы по идентификатору загрузки (по умолчанию первый)
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Ошибка парсинга запроса combine: %v", err)
+		http.Error(w, "Ошибка парсинга запроса", http.StatusBadRequest)
+		return
+	}
+
+	if req.Password != h.adminPassword {
+		log.Println("Ошибка объединения: неверный пароль")
+		sendJSON(w, r, false, "Неверный пароль", nil, http.StatusUnauthorized)
+		return
+	}
+
+	if h.combiner == nil {
+		log.Println("Ошибка: объединение ведомостей не настроено")
+		sendJSON(w, r, false, "Объединение ведомостей не настроено", nil, http.StatusInternalServerError)
+		return
+	}
+
+	if len(req.UploadIDs) < 2 {
+		sendJSON(w, r, false, "Для объединения выберите минимум два файла", nil, http.StatusBadRequest)
+		return
+	}
+
+	inputs := make([]processors.CombineInput, 0, len(req.UploadIDs))
+	sourceIDs := make([]string, 0, len(req.UploadIDs))
+	// Повторно выбранный файл удвоил бы остатки в объединенном снимке
+	seen := make(map[string]bool, len(req.UploadIDs))
+	// Источник позиции - имя файла у пользователя (по нему клиенты Ikon выбирают свои остатки),
+	// у разных файлов с одинаковым именем - с номером
+	sourceNames := make(map[string]bool, len(req.UploadIDs))
+	for _, id := range req.UploadIDs {
+		record, path, err := h.uploadStore.Resolve(id)
+		if err != nil {
+			log.Printf("Загрузка %s не найдена: %v", id, err)
+			sendJSON(w, r, false, "Загруженный файл не найден", nil, http.StatusNotFound)
+			return
+		}
+		if seen[record.ID] || seen[record.SHA256] {
+			sendJSON(w, r, false, fmt.Sprintf("Файл %s выбран повторно", record.OriginalName), nil, http.StatusBadRequest)
+			return
+		}
+		seen[record.ID] = true
+		seen[record.SHA256] = true
+
+		f, err := excelize.OpenFile(path)
+		if err != nil {
+			log.Printf("Ошибка открытия Excel файла %s: %v", record.Filename, err)
+			sendJSON(w, r, false, fmt.Sprintf("Ошибка открытия файла %s: %v", record.OriginalName, err), nil, http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+
+		source := record.OriginalName
+		for i := 2; sourceNames[source]; i++ {
+			source = fmt.Sprintf("%s (%d)", record.OriginalName, i)
+		}
+		sourceNames[source] = true
+
+		inputs = append(inputs, processors.CombineInput{
+			Source: source,
+			File:   f,
+			Sheets: req.Sheets[id],
+		})
+		sourceIDs = append(sourceIDs, record.ID)
+	}
+
+	processed, err := h.combiner.Combine(inputs)
+	if err != nil {
+		log.Printf("Ошибка объединения файлов: %v", err)
+		sendJSON(w, r, false, "Ошибка объединения: "+err.Error(), nil, http.StatusInternalServerError)
+		return
+	}
+	processed.SourceIDs = sourceIDs
+
+	if err := h.storeProcessed(processed); err != nil {
+		log.Printf("Ошибка сохранения результата: %v", err)
+		sendJSON(w, r, false, "Ошибка сохранения результата", nil, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Файлы объединены: %s, всего строк: %d, позиций: %d, объединено строк: %d",
+		strings.Join(processed.SourceFiles, ", "), processed.Stats.TotalRows, len(processed.AllItems), processed.Stats.CombinedRows)
+
+	sendJSON(w, r, true, "Файлы объединены", processed, http.StatusOK)
+}
+
+// storeProcessed отмечает залежалый товар и сохраняет результат обработки под новым идентификатором
+func (h *UploadHandler) storeProcessed(processed *models.ProcessedFile) error {
+	if h.agedProcessor != nil {
+		h.agedProcessor.Mark(processed.AllItems)
+		h.agedProcessor.Mark(processed.PirelliItems)
+	}
+
+	return h.results.Save(processed)
+}
+
 // HandleDownloadPirelliCSV скачивает CSV файл для Pirelli
 func (h *UploadHandler) HandleDownloadPirelliCSV(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -231,7 +448,7 @@ func (h *UploadHandler) HandleDownloadPirelliCSV(w http.ResponseWriter, r *http.
 	}
 
 	password := r.URL.Query().Get("password")
-	filename := r.URL.Query().Get("file")
+	id := r.URL.Query().Get("id")
 
 	if password != h.adminPassword {
 		log.Println("Ошибка скачивания Pirelli CSV: неверный пароль")
@@ -239,38 +456,53 @@ func (h *UploadHandler) HandleDownloadPirelliCSV(w http.ResponseWriter, r *http.
 		return
 	}
 
-	resultPath := filepath.Join(h.processedDir, filename)
-	data, err := os.ReadFile(resultPath)
+	date := r.URL.Query().Get("date")
+	processed, err := h.snapshot(id, date)
 	if err != nil {
-		log.Printf("Файл не найден: %s", filename)
-		http.Error(w, "Файл не найден", http.StatusNotFound)
+		log.Printf("Снимок остатков %s на %s не найден: %v", id, date, err)
+		if errors.Is(err, services.ErrUnknownID) {
+			http.Error(w, "Результат обработки не найден", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
 		return
 	}
 
-	var processed models.ProcessedFile
-	if err := json.Unmarshal(data, &processed); err != nil {
-		log.Printf("Ошибка чтения данных из %s: %v", filename, err)
-		http.Error(w, "Ошибка чтения данных", http.StatusInternalServerError)
+	asOf, err := h.reportDate(processed, date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	h.applyAgedPolicy(processed)
+
 	if len(processed.PirelliItems) == 0 {
-		log.Printf("Нет данных Pirelli в файле %s", filename)
+		log.Printf("Нет данных Pirelli в результате %s", processed.ID)
 		http.Error(w, "Нет данных Pirelli для скачивания", http.StatusNotFound)
 		return
 	}
 
-	downloadFilename := h.pirelliProcessor.GenerateFilename()
+	downloadFilename := h.pirelliProcessor.GenerateFilename(asOf)
 	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
 	w.Header().Set("Content-Disposition",
 		fmt.Sprintf("attachment; filename=%s", downloadFilename))
 
-	if err := h.pirelliProcessor.CreateCSV(processed.PirelliItems, w); err != nil {
+	if err := h.pirelliProcessor.CreateCSV(processed.PirelliItems, w, asOf); err != nil {
 		log.Printf("Ошибка создания CSV: %v", err)
 		http.Error(w, "Ошибка создания CSV: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	h.recordDelivery(&models.Delivery{
+		Report:    "pirelli_csv",
+		Channel:   services.DeliveryDownload,
+		StockDate: asOf.Format(processors.ReportDateLayout),
+		ResultID:  processed.ID,
+		Filename:  downloadFilename,
+		Items:     len(processed.PirelliItems),
+		Success:   true,
+	})
+
 	log.Printf("Скачан файл Pirelli CSV: %s", downloadFilename)
 }
 
@@ -282,8 +514,9 @@ func (h *UploadHandler) HandleSendPirelli(w http.ResponseWriter, r *http.Request
 	}
 
 	var req struct {
-		Password string `json:"password"`
-		Filename string `json:"filename"`
+		Password   string `json:"password"`
+		ID         string `json:"id"`          // идентификатор результата обработки (пусто - последний снимок на report_date)
+		ReportDate string `json:"report_date"` // дата остатков (по умолчанию из шапки ведомости)
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -304,23 +537,27 @@ func (h *UploadHandler) HandleSendPirelli(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	resultPath := filepath.Join(h.processedDir, req.Filename)
-	data, err := os.ReadFile(resultPath)
+	processed, err := h.snapshot(req.ID, req.ReportDate)
 	if err != nil {
-		log.Printf("Файл не найден: %s", req.Filename)
-		sendJSON(w, r, false, "Файл не найден", nil, http.StatusNotFound)
+		log.Printf("Снимок остатков %s на %s не найден: %v", req.ID, req.ReportDate, err)
+		if errors.Is(err, services.ErrUnknownID) {
+			sendJSON(w, r, false, "Результат обработки не найден", nil, http.StatusNotFound)
+		} else {
+			sendJSON(w, r, false, err.Error(), nil, http.StatusBadRequest)
+		}
 		return
 	}
 
-	var processed models.ProcessedFile
-	if err := json.Unmarshal(data, &processed); err != nil {
-		log.Printf("Ошибка чтения данных из %s: %v", req.Filename, err)
-		sendJSON(w, r, false, "Ошибка чтения данных", nil, http.StatusInternalServerError)
+	asOf, err := h.reportDate(processed, req.ReportDate)
+	if err != nil {
+		sendJSON(w, r, false, err.Error(), nil, http.StatusBadRequest)
 		return
 	}
 
+	h.applyAgedPolicy(processed)
+
 	if len(processed.PirelliItems) == 0 {
-		log.Printf("Нет данных Pirelli в файле %s", req.Filename)
+		log.Printf("Нет данных Pirelli в результате %s", processed.ID)
 		sendJSON(w, r, false, "Нет данных Pirelli для отправки", nil, http.StatusBadRequest)
 		return
 	}
@@ -331,6 +568,10 @@ func (h *UploadHandler) HandleSendPirelli(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if h.rejectIfBlocked(w, r, processed, stockRows(processed.PirelliItems), "Pirelli") {
+		return
+	}
+
 	tmpFile, err := os.CreateTemp("", "pirelli-*.csv")
 	if err != nil {
 		log.Printf("Ошибка создания временного файла: %v", err)
@@ -340,27 +581,49 @@ func (h *UploadHandler) HandleSendPirelli(w http.ResponseWriter, r *http.Request
 	defer os.Remove(tmpFile.Name())
 	defer tmpFile.Close()
 
-	if err := h.pirelliProcessor.CreateCSV(processed.PirelliItems, tmpFile); err != nil {
+	if err := h.pirelliProcessor.CreateCSV(processed.PirelliItems, tmpFile, asOf); err != nil {
 		log.Printf("Ошибка создания CSV: %v", err)
 		sendJSON(w, r, false, "Ошибка создания CSV: "+err.Error(), nil, http.StatusInternalServerError)
 		return
 	}
 
-	filename := h.pirelliProcessor.GenerateFilename()
+	filename := h.pirelliProcessor.GenerateFilename(asOf)
+	delivery := &models.Delivery{
+		Report:    "pirelli_csv",
+		Channel:   services.DeliveryAPI,
+		StockDate: asOf.Format(processors.ReportDateLayout),
+		ResultID:  processed.ID,
+		Filename:  filename,
+		Items:     len(processed.PirelliItems),
+	}
+
 	response, err := h.pirelliAPI.UploadFile(tmpFile.Name(), filename)
 	if err != nil {
 		log.Printf("Ошибка отправки в Pirelli: %v", err)
+		delivery.Message = err.Error()
+		h.recordDelivery(delivery)
 		sendJSON(w, r, false, "Ошибка отправки: "+err.Error(), nil, http.StatusInternalServerError)
 		return
 	}
 
+	delivery.Success = response.Status
+	delivery.Message = response.Message
+	h.recordDelivery(delivery)
+
+	message := response.Message
 	if response.Status {
 		log.Printf("Файл отправлен в Pirelli: %s, ответ: %s", filename, response.Message)
+		if delivery.Correction {
+			message = fmt.Sprintf("Корректировка остатков на %s: %s", asOf.Format("02.01.2006"), response.Message)
+		}
 	} else {
 		log.Printf("Ошибка отправки в Pirelli: %s", response.Message)
 	}
 
-	sendJSON(w, r, response.Status, response.Message, response, http.StatusOK)
+	sendJSON(w, r, response.Status, message, map[string]interface{}{
+		"pirelli":  response,
+		"delivery": delivery,
+	}, http.StatusOK)
 }
 
 // HandleDownloadPirelliExcel скачивает Excel отчет для Pirelli
@@ -371,7 +634,7 @@ func (h *UploadHandler) HandleDownloadPirelliExcel(w http.ResponseWriter, r *htt
 	}
 
 	password := r.URL.Query().Get("password")
-	filename := r.URL.Query().Get("file")
+	id := r.URL.Query().Get("id")
 
 	if password != h.adminPassword {
 		log.Println("Ошибка скачивания Pirelli Excel: неверный пароль")
@@ -379,28 +642,30 @@ func (h *UploadHandler) HandleDownloadPirelliExcel(w http.ResponseWriter, r *htt
 		return
 	}
 
-	resultPath := filepath.Join(h.processedDir, filename)
-	data, err := os.ReadFile(resultPath)
+	processed, err := h.results.Load(id)
 	if err != nil {
-		log.Printf("Файл не найден: %s", filename)
-		http.Error(w, "Файл не найден", http.StatusNotFound)
+		log.Printf("Результат обработки %s не найден: %v", id, err)
+		http.Error(w, "Результат обработки не найден", http.StatusNotFound)
 		return
 	}
 
-	var processed models.ProcessedFile
-	if err := json.Unmarshal(data, &processed); err != nil {
-		log.Printf("Ошибка чтения данных из %s: %v", filename, err)
-		http.Error(w, "Ошибка чтения данных", http.StatusInternalServerError)
+	asOf, err := h.reportDate(processed, r.URL.Query().Get("date"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	h.applyAgedPolicy(processed)
+
 	if h.pirelliExcelProcessor == nil {
 		log.Println("Ошибка: процессор Pirelli Excel не инициализирован")
 		http.Error(w, "Процессор Pirelli Excel не настроен", http.StatusInternalServerError)
 		return
 	}
 
-	f, err := h.pirelliExcelProcessor.CreateExcelReport(processed.AllItems)
+	f, err := h.buildReport("pirelli", processed, asOf, func() (*excelize.File, error) {
+		return h.pirelliExcelProcessor.CreateExcelReport(processed.AllItems)
+	})
 	if err != nil {
 		log.Printf("Ошибка создания отчета Pirelli Excel: %v", err)
 		http.Error(w, "Ошибка создания отчета", http.StatusInternalServerError)
@@ -423,7 +688,7 @@ func (h *UploadHandler) HandleDownloadPirelliExcel(w http.ResponseWriter, r *htt
 		return
 	}
 
-	downloadFilename := h.pirelliExcelProcessor.GenerateFilename()
+	downloadFilename := h.pirelliExcelProcessor.GenerateFilename(asOf)
 	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
 	w.Header().Set("Content-Disposition",
 		fmt.Sprintf("attachment; filename=%s", downloadFilename))
@@ -441,9 +706,10 @@ func (h *UploadHandler) HandleSendPirelliExcel(w http.ResponseWriter, r *http.Re
 	}
 
 	var req struct {
-		Password string `json:"password"`
-		Filename string `json:"filename"`
-		Emails   string `json:"emails"`
+		Password   string `json:"password"`
+		ID         string `json:"id"`          // идентификатор результата обработки
+		ReportDate string `json:"report_date"` // дата остатков (по умолчанию из шапки ведомости)
+		Emails     string `json:"emails"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -475,21 +741,21 @@ func (h *UploadHandler) HandleSendPirelliExcel(w http.ResponseWriter, r *http.Re
 		}
 	}
 
-	resultPath := filepath.Join(h.processedDir, req.Filename)
-	data, err := os.ReadFile(resultPath)
+	processed, err := h.results.Load(req.ID)
 	if err != nil {
-		log.Printf("Файл не найден: %s", req.Filename)
-		sendJSON(w, r, false, "Файл не найден", nil, http.StatusNotFound)
+		log.Printf("Результат обработки %s не найден: %v", req.ID, err)
+		sendJSON(w, r, false, "Результат обработки не найден", nil, http.StatusNotFound)
 		return
 	}
 
-	var processed models.ProcessedFile
-	if err := json.Unmarshal(data, &processed); err != nil {
-		log.Printf("Ошибка чтения данных из %s: %v", req.Filename, err)
-		sendJSON(w, r, false, "Ошибка чтения данных", nil, http.StatusInternalServerError)
+	asOf, err := h.reportDate(processed, req.ReportDate)
+	if err != nil {
+		sendJSON(w, r, false, err.Error(), nil, http.StatusBadRequest)
 		return
 	}
 
+	h.applyAgedPolicy(processed)
+
 	allPirelliItems := make([]models.StockItem, 0)
 	for _, item := range processed.AllItems {
 		brandLower := strings.ToLower(item.CleanBrand)
@@ -506,7 +772,13 @@ func (h *UploadHandler) HandleSendPirelliExcel(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	f, err := h.pirelliExcelProcessor.CreateExcelReport(processed.AllItems)
+	if h.rejectIfBlocked(w, r, processed, stockRows(allPirelliItems), "Pirelli Excel") {
+		return
+	}
+
+	f, err := h.buildReport("pirelli", processed, asOf, func() (*excelize.File, error) {
+		return h.pirelliExcelProcessor.CreateExcelReport(processed.AllItems)
+	})
 	if err != nil {
 		log.Printf("Ошибка создания отчета Pirelli Excel: %v", err)
 		sendJSON(w, r, false, "Ошибка создания отчета", nil, http.StatusInternalServerError)
@@ -536,10 +808,11 @@ func (h *UploadHandler) HandleSendPirelliExcel(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	filename := h.pirelliExcelProcessor.GenerateFilename()
-	subject := fmt.Sprintf("Отчет Pirelli от %s", time.Now().Format("02.01.2006"))
-	body := fmt.Sprintf("Отчет Pirelli сформирован %s.\nВсего позиций: %d\nОбщее количество: %d",
-		time.Now().Format("02.01.2006 15:04:05"),
+	filename := h.pirelliExcelProcessor.GenerateFilename(asOf)
+	subject := fmt.Sprintf("Отчет Pirelli на %s", asOf.Format("02.01.2006"))
+	body := fmt.Sprintf("Отчет Pirelli на %s сформирован %s.\nВсего позиций: %d\nОбщее количество: %d",
+		asOf.Format("02.01.2006"),
+		h.clock.Now().Format("02.01.2006 15:04:05"),
 		len(allPirelliItems),
 		len(processed.AllItems))
 
@@ -564,7 +837,7 @@ func (h *UploadHandler) HandleDownloadIkon(w http.ResponseWriter, r *http.Reques
 	}
 
 	password := r.URL.Query().Get("password")
-	filename := r.URL.Query().Get("file")
+	id := r.URL.Query().Get("id")
 
 	if password != h.adminPassword {
 		log.Println("Ошибка скачивания Ikon: неверный пароль")
@@ -572,28 +845,30 @@ func (h *UploadHandler) HandleDownloadIkon(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	resultPath := filepath.Join(h.processedDir, filename)
-	data, err := os.ReadFile(resultPath)
+	processed, err := h.results.Load(id)
 	if err != nil {
-		log.Printf("Файл не найден: %s", filename)
-		http.Error(w, "Файл не найден", http.StatusNotFound)
+		log.Printf("Результат обработки %s не найден: %v", id, err)
+		http.Error(w, "Результат обработки не найден", http.StatusNotFound)
 		return
 	}
 
-	var processed models.ProcessedFile
-	if err := json.Unmarshal(data, &processed); err != nil {
-		log.Printf("Ошибка чтения данных из %s: %v", filename, err)
-		http.Error(w, "Ошибка чтения данных", http.StatusInternalServerError)
+	asOf, err := h.reportDate(processed, r.URL.Query().Get("date"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	h.applyAgedPolicy(processed)
+
 	if h.ikonProcessor == nil {
 		log.Println("Ошибка: процессор Ikon не инициализирован")
 		http.Error(w, "Процессор Ikon не настроен", http.StatusInternalServerError)
 		return
 	}
 
-	f, err := h.ikonProcessor.CreateReport(processed.AllItems)
+	f, err := h.buildReport("ikon", processed, asOf, func() (*excelize.File, error) {
+		return h.ikonProcessor.CreateReport(ikonItems(processed))
+	})
 	if err != nil {
 		log.Printf("Ошибка создания отчета Ikon: %v", err)
 		http.Error(w, "Ошибка создания отчета", http.StatusInternalServerError)
@@ -616,7 +891,7 @@ func (h *UploadHandler) HandleDownloadIkon(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	downloadFilename := h.ikonProcessor.GenerateFilename()
+	downloadFilename := h.ikonProcessor.GenerateFilename(asOf)
 	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
 	w.Header().Set("Content-Disposition",
 		fmt.Sprintf("attachment; filename=%s", downloadFilename))
@@ -634,9 +909,10 @@ func (h *UploadHandler) HandleSendIkon(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Password string `json:"password"`
-		Filename string `json:"filename"`
-		Emails   string `json:"emails"`
+		Password   string `json:"password"`
+		ID         string `json:"id"`          // идентификатор результата обработки
+		ReportDate string `json:"report_date"` // дата остатков (по умолчанию из шапки ведомости)
+		Emails     string `json:"emails"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -668,28 +944,34 @@ func (h *UploadHandler) HandleSendIkon(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	resultPath := filepath.Join(h.processedDir, req.Filename)
-	data, err := os.ReadFile(resultPath)
+	processed, err := h.results.Load(req.ID)
 	if err != nil {
-		log.Printf("Файл не найден: %s", req.Filename)
-		sendJSON(w, r, false, "Файл не найден", nil, http.StatusNotFound)
+		log.Printf("Результат обработки %s не найден: %v", req.ID, err)
+		sendJSON(w, r, false, "Результат обработки не найден", nil, http.StatusNotFound)
 		return
 	}
 
-	var processed models.ProcessedFile
-	if err := json.Unmarshal(data, &processed); err != nil {
-		log.Printf("Ошибка чтения данных из %s: %v", req.Filename, err)
-		sendJSON(w, r, false, "Ошибка чтения данных", nil, http.StatusInternalServerError)
+	asOf, err := h.reportDate(processed, req.ReportDate)
+	if err != nil {
+		sendJSON(w, r, false, err.Error(), nil, http.StatusBadRequest)
 		return
 	}
 
+	h.applyAgedPolicy(processed)
+
 	if h.ikonProcessor == nil {
 		log.Println("Ошибка: процессор Ikon не инициализирован")
 		sendJSON(w, r, false, "Процессор Ikon не настроен", nil, http.StatusInternalServerError)
 		return
 	}
 
-	f, err := h.ikonProcessor.CreateReport(processed.AllItems)
+	if h.rejectIfBlocked(w, r, processed, stockRows(processed.AllItems), "Ikon") {
+		return
+	}
+
+	f, err := h.buildReport("ikon", processed, asOf, func() (*excelize.File, error) {
+		return h.ikonProcessor.CreateReport(ikonItems(processed))
+	})
 	if err != nil {
 		log.Printf("Ошибка создания отчета Ikon: %v", err)
 		sendJSON(w, r, false, "Ошибка создания отчета", nil, http.StatusInternalServerError)
@@ -719,15 +1001,24 @@ func (h *UploadHandler) HandleSendIkon(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	filename := h.ikonProcessor.GenerateFilename()
-	subject := fmt.Sprintf("Отчет Ikon от %s", time.Now().Format("02.01.2006"))
+	filename := h.ikonProcessor.GenerateFilename(asOf)
+	subject := fmt.Sprintf("Отчет Ikon на %s", asOf.Format("02.01.2006"))
 
-	// Исправленный вызов - 5 значений
-	_, _, allBrandsTotal, _, _ := h.ikonProcessor.CalculateSums(processed.AllItems)
+	clientTotals := h.ikonProcessor.ClientTotals(ikonItems(processed))
+	allBrandsTotal := 0
+	for _, client := range clientTotals {
+		allBrandsTotal += client.Total
+	}
 
-	body := fmt.Sprintf("Отчет Ikon сформирован %s.\nОбщее количество по всем брендам: %d",
-		time.Now().Format("02.01.2006 15:04:05"),
+	body := fmt.Sprintf("Отчет Ikon на %s сформирован %s.\nОбщее количество по всем брендам: %d",
+		asOf.Format("02.01.2006"),
+		h.clock.Now().Format("02.01.2006 15:04:05"),
 		allBrandsTotal)
+	if len(clientTotals) > 1 {
+		for _, client := range clientTotals {
+			body += fmt.Sprintf("\n%s: %d", client.Name, client.Total)
+		}
+	}
 
 	err = h.smtpService.SendEmail(emailList, subject, body, fileData, filename)
 	if err != nil {
@@ -737,8 +1028,9 @@ func (h *UploadHandler) HandleSendIkon(w http.ResponseWriter, r *http.Request) {
 	}
 
 	sendJSON(w, r, true, fmt.Sprintf("Отчет отправлен на %d адресов", len(emailList)), map[string]interface{}{
-		"emails": emailList,
-		"total":  allBrandsTotal,
+		"emails":  emailList,
+		"total":   allBrandsTotal,
+		"clients": clientTotals,
 	}, http.StatusOK)
 }
 
@@ -750,7 +1042,7 @@ func (h *UploadHandler) HandleDownloadCordiantCSV(w http.ResponseWriter, r *http
 	}
 
 	password := r.URL.Query().Get("password")
-	filename := r.URL.Query().Get("file")
+	id := r.URL.Query().Get("id")
 
 	if password != h.adminPassword {
 		log.Println("Ошибка скачивания Cordiant CSV: неверный пароль")
@@ -758,21 +1050,21 @@ func (h *UploadHandler) HandleDownloadCordiantCSV(w http.ResponseWriter, r *http
 		return
 	}
 
-	resultPath := filepath.Join(h.processedDir, filename)
-	data, err := os.ReadFile(resultPath)
+	processed, err := h.results.Load(id)
 	if err != nil {
-		log.Printf("Файл не найден: %s", filename)
-		http.Error(w, "Файл не найден", http.StatusNotFound)
+		log.Printf("Результат обработки %s не найден: %v", id, err)
+		http.Error(w, "Результат обработки не найден", http.StatusNotFound)
 		return
 	}
 
-	var processed models.ProcessedFile
-	if err := json.Unmarshal(data, &processed); err != nil {
-		log.Printf("Ошибка чтения данных из %s: %v", filename, err)
-		http.Error(w, "Ошибка чтения данных", http.StatusInternalServerError)
+	asOf, err := h.reportDate(processed, r.URL.Query().Get("date"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	h.applyAgedPolicy(processed)
+
 	if h.cordiantProcessor == nil {
 		log.Println("Ошибка: процессор Cordiant не инициализирован")
 		http.Error(w, "Процессор Cordiant не настроен", http.StatusInternalServerError)
@@ -782,7 +1074,7 @@ func (h *UploadHandler) HandleDownloadCordiantCSV(w http.ResponseWriter, r *http
 	cordiantItems := h.cordiantProcessor.FilterItems(processed.AllItems)
 
 	if len(cordiantItems) == 0 {
-		log.Printf("Нет данных Cordiant в файле %s", filename)
+		log.Printf("Нет данных Cordiant в результате %s", id)
 		http.Error(w, "Нет данных Cordiant для скачивания", http.StatusNotFound)
 		return
 	}
@@ -794,7 +1086,7 @@ func (h *UploadHandler) HandleDownloadCordiantCSV(w http.ResponseWriter, r *http
 		return
 	}
 
-	downloadFilename := h.cordiantProcessor.GenerateFilename()
+	downloadFilename := h.cordiantProcessor.GenerateFilename(asOf)
 	w.Header().Set("Content-Type", "text/csv; charset=windows-1251")
 	w.Header().Set("Content-Disposition",
 		fmt.Sprintf("attachment; filename=%s", downloadFilename))
@@ -815,10 +1107,12 @@ func (h *UploadHandler) HandleSendCordiant(w http.ResponseWriter, r *http.Reques
 	}
 
 	var req struct {
-		Password string `json:"password"`
-		Filename string `json:"filename"`
-		Month    string `json:"month"`
-		Year     string `json:"year"`
+		Password   string `json:"password"`
+		ID         string `json:"id"`          // идентификатор результата обработки
+		ReportDate string `json:"report_date"` // дата остатков (по умолчанию из шапки ведомости)
+		Month      string `json:"month"`       // отчетный период (пусто - предложенный по дате остатков)
+		Year       string `json:"year"`
+		Overwrite  bool   `json:"overwrite"` // подтверждение перезаписи уже загруженного периода
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -839,44 +1133,76 @@ func (h *UploadHandler) HandleSendCordiant(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Валидация месяца и года
-	if req.Month == "" || req.Year == "" {
-		log.Println("Ошибка отправки: не указаны месяц или год")
-		sendJSON(w, r, false, "Не указаны месяц или год", nil, http.StatusBadRequest)
-		return
-	}
-
 	// Загружаем обработанные данные
-	resultPath := filepath.Join(h.processedDir, req.Filename)
-	data, err := os.ReadFile(resultPath)
+	processed, err := h.results.Load(req.ID)
 	if err != nil {
-		log.Printf("Файл не найден: %s", req.Filename)
-		sendJSON(w, r, false, "Файл не найден", nil, http.StatusNotFound)
+		log.Printf("Результат обработки %s не найден: %v", req.ID, err)
+		sendJSON(w, r, false, "Результат обработки не найден", nil, http.StatusNotFound)
 		return
 	}
 
-	var processed models.ProcessedFile
-	if err := json.Unmarshal(data, &processed); err != nil {
-		log.Printf("Ошибка чтения данных из %s: %v", req.Filename, err)
-		sendJSON(w, r, false, "Ошибка чтения данных", nil, http.StatusInternalServerError)
+	asOf, err := h.reportDate(processed, req.ReportDate)
+	if err != nil {
+		sendJSON(w, r, false, err.Error(), nil, http.StatusBadRequest)
 		return
 	}
 
+	h.applyAgedPolicy(processed)
+
 	if h.cordiantProcessor == nil {
 		log.Println("Ошибка: процессор Cordiant не инициализирован")
 		sendJSON(w, r, false, "Процессор Cordiant не настроен", nil, http.StatusInternalServerError)
 		return
 	}
 
+	// Период по умолчанию - предложенный по дате остатков
+	if req.Month == "" && req.Year == "" {
+		req.Year, req.Month = h.cordiantProcessor.SuggestPeriod(asOf)
+	}
+	if req.Month == "" || req.Year == "" {
+		log.Println("Ошибка отправки: не указаны месяц или год")
+		sendJSON(w, r, false, "Не указаны месяц или год", nil, http.StatusBadRequest)
+		return
+	}
+	if err := h.cordiantProcessor.ValidatePeriod(req.Year, req.Month); err != nil {
+		log.Printf("Ошибка отправки Cordiant: %v", err)
+		sendJSON(w, r, false, err.Error(), nil, http.StatusBadRequest)
+		return
+	}
+	period := h.cordiantProcessor.PeriodKey(req.Year, req.Month)
+
+	// Период уже отправлялся - перезапись только с подтверждением
+	if prev := h.lastDelivery("cordiant", period); prev != nil && !req.Overwrite {
+		log.Printf("Отправка Cordiant за %s требует подтверждения: период уже отправлен %s", period, prev.SentAt)
+		sendJSON(w, r, false,
+			fmt.Sprintf("Остатки за %s.%s уже отправлены %s. Подтвердите перезапись", req.Month, req.Year, prev.SentAt),
+			cordiantConfirmation(req.Year, req.Month, prev), http.StatusConflict)
+		return
+	}
+
 	// Фильтруем позиции для Cordiant
 	cordiantItems := h.cordiantProcessor.FilterItems(processed.AllItems)
 
 	if len(cordiantItems) == 0 {
-		log.Printf("Нет данных Cordiant в файле %s", req.Filename)
+		log.Printf("Нет данных Cordiant в результате %s", req.ID)
 		sendJSON(w, r, false, "Нет данных Cordiant для отправки", nil, http.StatusBadRequest)
 		return
 	}
 
+	cordiantKeys := make(map[string]bool, len(cordiantItems))
+	for _, item := range cordiantItems {
+		cordiantKeys[models.RowKey(item.Source, item.Sheet, item.RowNum)] = true
+	}
+	cordiantStock := make([]models.StockItem, 0, len(cordiantItems))
+	for _, item := range processed.AllItems {
+		if cordiantKeys[models.RowKey(item.Source, item.Sheet, item.RowNum)] {
+			cordiantStock = append(cordiantStock, item)
+		}
+	}
+	if h.rejectIfBlocked(w, r, processed, stockRows(cordiantStock), "Cordiant") {
+		return
+	}
+
 	// Подготавливаем файл в base64
 	fileBase64, err := h.cordiantProcessor.PrepareBase64File(cordiantItems)
 	if err != nil {
@@ -885,21 +1211,169 @@ func (h *UploadHandler) HandleSendCordiant(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	delivery := &models.Delivery{
+		Report:    "cordiant",
+		Channel:   services.DeliveryAPI,
+		StockDate: asOf.Format(processors.ReportDateLayout),
+		Period:    period,
+		ResultID:  processed.ID,
+		Filename:  h.cordiantProcessor.GenerateFilename(asOf),
+		Items:     len(cordiantItems),
+	}
+
 	// Отправляем в Cordiant с переданными месяцем и годом
 	response, err := h.cordiantAPI.SendReport(fileBase64, req.Year, req.Month)
+	if err == nil && !response.Success && response.HavePrevRecords {
+		if !req.Overwrite {
+			// В Cordiant за период уже есть остатки - импорт не выполнен, спрашиваем пользователя
+			log.Printf("Cordiant: за %s уже загружены остатки, требуется подтверждение", period)
+			sendJSON(w, r, false,
+				fmt.Sprintf("В Cordiant уже есть остатки за %s.%s. Подтвердите перезапись", req.Month, req.Year),
+				cordiantConfirmation(req.Year, req.Month, nil), http.StatusConflict)
+			return
+		}
+		log.Printf("Cordiant: перезапись остатков за %s подтверждена", period)
+		response, err = h.cordiantAPI.ConfirmOverwrite(response.ConfirmFunction, fileBase64, req.Year, req.Month)
+	}
 	if err != nil {
 		log.Printf("Ошибка отправки в Cordiant: %v", err)
+		delivery.Message = err.Error()
+		h.recordDelivery(delivery)
 		sendJSON(w, r, false, "Ошибка отправки: "+err.Error(), nil, http.StatusInternalServerError)
 		return
 	}
 
+	delivery.Success = response.Success
+	delivery.Message = response.Message
+	h.recordDelivery(delivery)
+
+	// Номера строк CSV из ответа переводим в позиции и строки ведомости
+	rejected := h.cordiantProcessor.RejectedItems(cordiantItems, response.ErrorLines, response.Warnings)
+	h.storeCordiantRejected(processed.ID, rejected)
+
 	if response.Success {
 		log.Printf("Отчет успешно отправлен в Cordiant за %s.%s, позиций: %d", req.Month, req.Year, len(cordiantItems))
 	} else {
 		log.Printf("Ошибка отправки в Cordiant: %s", response.Message)
 	}
 
-	sendJSON(w, r, response.Success, response.Message, response.Data, http.StatusOK)
+	sendJSON(w, r, response.Success, response.Message, map[string]interface{}{
+		"cordiant": response.Data,
+		"rejected": rejected,
+	}, http.StatusOK)
+}
+
+// storeCordiantRejected сохраняет отклоненные позиции в результате обработки для последующей выгрузки.
+// Результат перечитывается, чтобы не сохранить изменения политики залежалого товара
+func (h *UploadHandler) storeCordiantRejected(id string, rejected []models.CordiantRejectedItem) {
+	stored, err := h.results.Load(id)
+	if err != nil {
+		log.Printf("Ошибка сохранения отклоненных позиций Cordiant: %v", err)
+		return
+	}
+	stored.CordiantRejected = rejected
+	if err := h.results.Save(stored); err != nil {
+		log.Printf("Ошибка сохранения отклоненных позиций Cordiant: %v", err)
+	}
+}
+
+// HandleDownloadCordiantRejected скачивает позиции, отклоненные Cordiant при последней отправке
+func (h *UploadHandler) HandleDownloadCordiantRejected(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+
+	password := r.URL.Query().Get("password")
+	id := r.URL.Query().Get("id")
+
+	if password != h.adminPassword {
+		log.Println("Ошибка скачивания отклоненных позиций Cordiant: неверный пароль")
+		http.Error(w, "Неверный пароль", http.StatusUnauthorized)
+		return
+	}
+
+	if h.cordiantProcessor == nil {
+		log.Println("Ошибка: процессор Cordiant не инициализирован")
+		http.Error(w, "Процессор Cordiant не настроен", http.StatusInternalServerError)
+		return
+	}
+
+	processed, err := h.results.Load(id)
+	if err != nil {
+		log.Printf("Результат обработки %s не найден: %v", id, err)
+		http.Error(w, "Результат обработки не найден", http.StatusNotFound)
+		return
+	}
+
+	asOf, err := h.reportDate(processed, r.URL.Query().Get("date"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(processed.CordiantRejected) == 0 {
+		http.Error(w, "Нет позиций, отклоненных Cordiant", http.StatusNotFound)
+		return
+	}
+
+	f, err := h.cordiantProcessor.CreateRejectedReport(processed.CordiantRejected)
+	if err != nil {
+		log.Printf("Ошибка создания списка отклоненных позиций: %v", err)
+		http.Error(w, "Ошибка создания отчета", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	h.serveExcel(w, r, f, h.cordiantProcessor.GenerateRejectedFilename(asOf))
+	log.Printf("Скачан список отклоненных Cordiant позиций: %d", len(processed.CordiantRejected))
+}
+
+// HandleCordiantPeriod предлагает отчетный период Cordiant для снимка остатков
+// и сообщает, отправлялся ли он уже
+func (h *UploadHandler) HandleCordiantPeriod(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Query().Get("password") != h.adminPassword {
+		log.Println("Ошибка получения периода Cordiant: неверный пароль")
+		sendJSON(w, r, false, "Неверный пароль", nil, http.StatusUnauthorized)
+		return
+	}
+
+	if h.cordiantProcessor == nil {
+		sendJSON(w, r, false, "Процессор Cordiant не настроен", nil, http.StatusInternalServerError)
+		return
+	}
+
+	processed, err := h.results.Load(r.URL.Query().Get("id"))
+	if err != nil {
+		sendJSON(w, r, false, "Результат обработки не найден", nil, http.StatusNotFound)
+		return
+	}
+
+	asOf, err := h.reportDate(processed, r.URL.Query().Get("date"))
+	if err != nil {
+		sendJSON(w, r, false, err.Error(), nil, http.StatusBadRequest)
+		return
+	}
+
+	year, month := h.cordiantProcessor.SuggestPeriod(asOf)
+	currentYear, currentMonth := h.cordiantProcessor.GetCurrentYearMonth()
+	data := map[string]interface{}{
+		"year":          year,
+		"month":         month,
+		"current_year":  currentYear,
+		"current_month": currentMonth,
+		"stock_date":    asOf.Format(processors.ReportDateLayout),
+	}
+	if prev := h.lastDelivery("cordiant", h.cordiantProcessor.PeriodKey(year, month)); prev != nil {
+		data["sent_at"] = prev.SentAt
+	}
+
+	sendJSON(w, r, true, "", data, http.StatusOK)
 }
 
 // HandleDownloadHankookExcel скачивает Excel отчет для Hankook
@@ -910,7 +1384,7 @@ func (h *UploadHandler) HandleDownloadHankookExcel(w http.ResponseWriter, r *htt
 	}
 
 	password := r.URL.Query().Get("password")
-	filename := r.URL.Query().Get("file")
+	id := r.URL.Query().Get("id")
 
 	if password != h.adminPassword {
 		log.Println("Ошибка скачивания Hankook Excel: неверный пароль")
@@ -918,28 +1392,30 @@ func (h *UploadHandler) HandleDownloadHankookExcel(w http.ResponseWriter, r *htt
 		return
 	}
 
-	resultPath := filepath.Join(h.processedDir, filename)
-	data, err := os.ReadFile(resultPath)
+	processed, err := h.results.Load(id)
 	if err != nil {
-		log.Printf("Файл не найден: %s", filename)
-		http.Error(w, "Файл не найден", http.StatusNotFound)
+		log.Printf("Результат обработки %s не найден: %v", id, err)
+		http.Error(w, "Результат обработки не найден", http.StatusNotFound)
 		return
 	}
 
-	var processed models.ProcessedFile
-	if err := json.Unmarshal(data, &processed); err != nil {
-		log.Printf("Ошибка чтения данных из %s: %v", filename, err)
-		http.Error(w, "Ошибка чтения данных", http.StatusInternalServerError)
+	asOf, err := h.reportDate(processed, r.URL.Query().Get("date"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	h.applyAgedPolicy(processed)
+
 	if h.hankookProcessor == nil {
 		log.Println("Ошибка: процессор Hankook не инициализирован")
 		http.Error(w, "Процессор Hankook не настроен", http.StatusInternalServerError)
 		return
 	}
 
-	f, err := h.hankookProcessor.CreateExcelReport(processed.AllItems)
+	f, err := h.buildReport("hankook", processed, asOf, func() (*excelize.File, error) {
+		return h.hankookProcessor.CreateExcelReport(processed.AllItems)
+	})
 	if err != nil {
 		log.Printf("Ошибка создания отчета Hankook Excel: %v", err)
 		http.Error(w, "Ошибка создания отчета", http.StatusInternalServerError)
@@ -962,7 +1438,7 @@ func (h *UploadHandler) HandleDownloadHankookExcel(w http.ResponseWriter, r *htt
 		return
 	}
 
-	downloadFilename := h.hankookProcessor.GenerateFilename()
+	downloadFilename := h.hankookProcessor.GenerateFilename(asOf)
 	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
 	w.Header().Set("Content-Disposition",
 		fmt.Sprintf("attachment; filename=%s", downloadFilename))
@@ -980,9 +1456,10 @@ func (h *UploadHandler) HandleSendHankook(w http.ResponseWriter, r *http.Request
 	}
 
 	var req struct {
-		Password string `json:"password"`
-		Filename string `json:"filename"`
-		Emails   string `json:"emails"`
+		Password   string `json:"password"`
+		ID         string `json:"id"`          // идентификатор результата обработки
+		ReportDate string `json:"report_date"` // дата остатков (по умолчанию из шапки ведомости)
+		Emails     string `json:"emails"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1014,21 +1491,21 @@ func (h *UploadHandler) HandleSendHankook(w http.ResponseWriter, r *http.Request
 		}
 	}
 
-	resultPath := filepath.Join(h.processedDir, req.Filename)
-	data, err := os.ReadFile(resultPath)
+	processed, err := h.results.Load(req.ID)
 	if err != nil {
-		log.Printf("Файл не найден: %s", req.Filename)
-		sendJSON(w, r, false, "Файл не найден", nil, http.StatusNotFound)
+		log.Printf("Результат обработки %s не найден: %v", req.ID, err)
+		sendJSON(w, r, false, "Результат обработки не найден", nil, http.StatusNotFound)
 		return
 	}
 
-	var processed models.ProcessedFile
-	if err := json.Unmarshal(data, &processed); err != nil {
-		log.Printf("Ошибка чтения данных из %s: %v", req.Filename, err)
-		sendJSON(w, r, false, "Ошибка чтения данных", nil, http.StatusInternalServerError)
+	asOf, err := h.reportDate(processed, req.ReportDate)
+	if err != nil {
+		sendJSON(w, r, false, err.Error(), nil, http.StatusBadRequest)
 		return
 	}
 
+	h.applyAgedPolicy(processed)
+
 	if h.hankookProcessor == nil {
 		log.Println("Ошибка: процессор Hankook не инициализирован")
 		sendJSON(w, r, false, "Процессор Hankook не настроен", nil, http.StatusInternalServerError)
@@ -1038,12 +1515,18 @@ func (h *UploadHandler) HandleSendHankook(w http.ResponseWriter, r *http.Request
 	hankookItems := h.hankookProcessor.FilterItems(processed.AllItems)
 
 	if len(hankookItems) == 0 {
-		log.Printf("Нет данных Hankook в файле %s", req.Filename)
+		log.Printf("Нет данных Hankook в результате %s", req.ID)
 		sendJSON(w, r, false, "Нет данных Hankook для отправки", nil, http.StatusBadRequest)
 		return
 	}
 
-	f, err := h.hankookProcessor.CreateExcelReport(processed.AllItems)
+	if h.rejectIfBlocked(w, r, processed, stockRows(hankookItems), "Hankook") {
+		return
+	}
+
+	f, err := h.buildReport("hankook", processed, asOf, func() (*excelize.File, error) {
+		return h.hankookProcessor.CreateExcelReport(processed.AllItems)
+	})
 	if err != nil {
 		log.Printf("Ошибка создания отчета Hankook Excel: %v", err)
 		sendJSON(w, r, false, "Ошибка создания отчета", nil, http.StatusInternalServerError)
@@ -1073,10 +1556,11 @@ func (h *UploadHandler) HandleSendHankook(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	filename := h.hankookProcessor.GenerateFilename()
-	subject := fmt.Sprintf("Отчет Hankook от %s", time.Now().Format("02.01.2006"))
-	body := fmt.Sprintf("Отчет Hankook сформирован %s.\nВсего позиций: %d",
-		time.Now().Format("02.01.2006 15:04:05"),
+	filename := h.hankookProcessor.GenerateFilename(asOf)
+	subject := fmt.Sprintf("Отчет Hankook на %s", asOf.Format("02.01.2006"))
+	body := fmt.Sprintf("Отчет Hankook на %s сформирован %s.\nВсего позиций: %d",
+		asOf.Format("02.01.2006"),
+		h.clock.Now().Format("02.01.2006 15:04:05"),
 		len(hankookItems))
 
 	err = h.smtpService.SendEmail(emailList, subject, body, fileData, filename)
@@ -1152,7 +1636,163 @@ func (h *UploadHandler) HandleClear(w http.ResponseWriter, r *http.Request) {
 	}, http.StatusOK)
 }
 
+// rejectIfBlocked отклоняет отправку, если для позиций отчета есть ошибки валидации
+func (h *UploadHandler) rejectIfBlocked(w http.ResponseWriter, r *http.Request, processed *models.ProcessedFile, rows map[string]bool, report string) bool {
+	blocking := processors.BlockingFindings(processed.Findings, rows)
+	if len(blocking) == 0 {
+		return false
+	}
+
+	log.Printf("Отправка %s заблокирована: ошибок валидации %d", report, len(blocking))
+	sendJSON(w, r, false,
+		fmt.Sprintf("Отправка %s заблокирована: ошибок валидации %d", report, len(blocking)),
+		map[string]interface{}{
+			"findings": blocking,
+		}, http.StatusUnprocessableEntity)
+	return true
+}
+
+// applyAgedPolicy исключает или отмечает залежалый товар перед формированием отчетов производителей
+func (h *UploadHandler) applyAgedPolicy(processed *models.ProcessedFile) {
+	if h.agedProcessor == nil {
+		return
+	}
+	processed.AllItems = h.agedProcessor.Apply(processed.AllItems)
+	processed.PirelliItems = h.agedProcessor.Apply(processed.PirelliItems)
+}
+
 // Вспомогательные функции
+
+// reportDate дата остатков для отчетов: явно переданная (ГГГГ-ММ-ДД или ДД.ММ.ГГГГ),
+// иначе дата из шапки ведомости, иначе текущая дата. Все даты - в часовом поясе бизнеса
+func (h *UploadHandler) reportDate(processed *models.ProcessedFile, override string) (time.Time, error) {
+	if strings.TrimSpace(override) != "" {
+		return h.parseDate(override)
+	}
+
+	if processed.ReportDate != "" {
+		if d, err := time.ParseInLocation(processors.ReportDateLayout, processed.ReportDate, h.clock.Location()); err == nil {
+			return d, nil
+		}
+	}
+	return h.clock.Now(), nil
+}
+
+// parseDate разбирает дату в формате ГГГГ-ММ-ДД или ДД.ММ.ГГГГ
+func (h *UploadHandler) parseDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{processors.ReportDateLayout, "02.01.2006"} {
+		if d, err := time.ParseInLocation(layout, value, h.clock.Location()); err == nil {
+			return d, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("неверная дата отчета %q (ожидается ГГГГ-ММ-ДД или ДД.ММ.ГГГГ)", value)
+}
+
+// snapshot снимок остатков по идентификатору результата, а без него - последний
+// обработанный снимок на дату остатков (для отправки пропущенного дня задним числом).
+// Если указаны и идентификатор, и дата, снимок должен содержать остатки именно на эту дату
+func (h *UploadHandler) snapshot(id, date string) (*models.ProcessedFile, error) {
+	if strings.TrimSpace(date) == "" {
+		return h.results.Load(id)
+	}
+	d, err := h.parseDate(date)
+	if err != nil {
+		return nil, err
+	}
+	day := d.Format(processors.ReportDateLayout)
+	if id == "" {
+		return h.results.FindByDate(day)
+	}
+
+	processed, err := h.results.Load(id)
+	if err != nil {
+		return nil, err
+	}
+	if snapshotDay := services.SnapshotDate(processed); snapshotDay != day {
+		return nil, fmt.Errorf("снимок %s содержит остатки на %s, а не на %s", id, snapshotDay, day)
+	}
+	return processed, nil
+}
+
+// recordDelivery записывает отправку в журнал; ошибка журнала не отменяет уже выполненную отправку
+func (h *UploadHandler) recordDelivery(delivery *models.Delivery) {
+	if h.deliveries == nil {
+		return
+	}
+	if err := h.deliveries.Record(delivery); err != nil {
+		log.Printf("Ошибка записи журнала отправок: %v", err)
+		return
+	}
+	if delivery.Correction {
+		log.Printf("Отправка %s на %s записана как корректировка (предыдущая: %s)", delivery.Report, delivery.StockDate, delivery.CorrectionOf)
+	}
+}
+
+// lastDelivery последняя успешная отправка отчета за период (nil - не отправлялся)
+func (h *UploadHandler) lastDelivery(report, period string) *models.Delivery {
+	if h.deliveries == nil {
+		return nil
+	}
+	deliveries, err := h.deliveries.Deliveries(report)
+	if err != nil {
+		log.Printf("Ошибка чтения журнала отправок: %v", err)
+		return nil
+	}
+	for _, delivery := range deliveries {
+		if delivery.Success && delivery.Period == period {
+			return &delivery
+		}
+	}
+	return nil
+}
+
+// cordiantConfirmation данные ответа, требующего подтверждения перезаписи периода Cordiant
+func cordiantConfirmation(year, month string, prev *models.Delivery) map[string]interface{} {
+	data := map[string]interface{}{
+		"need_confirmation": true,
+		"year":              year,
+		"month":             month,
+	}
+	if prev != nil {
+		data["sent_at"] = prev.SentAt
+		data["delivery_id"] = prev.ID
+	}
+	return data
+}
+
+// ikonItems позиции снимка для отчета Ikon. У обычной обработки источник позиций не заполнен:
+// клиенты с фильтром sources сопоставляются с именем загруженного файла
+func ikonItems(processed *models.ProcessedFile) []models.StockItem {
+	if len(processed.SourceFiles) > 0 || processed.OriginalName == "" {
+		return processed.AllItems
+	}
+
+	items := slices.Clone(processed.AllItems)
+	for i := range items {
+		items[i].Source = processed.OriginalName
+		if len(items[i].Sources) > 0 {
+			items[i].Sources = slices.Clone(items[i].Sources)
+			for j := range items[i].Sources {
+				items[i].Sources[j].Source = processed.OriginalName
+			}
+		}
+	}
+	return items
+}
+
+// stockRows ключи строк исходных файлов, из которых собраны позиции (включая источники объединенных позиций)
+func stockRows(items []models.StockItem) map[string]bool {
+	rows := make(map[string]bool, len(items))
+	for _, item := range items {
+		rows[models.RowKey(item.Source, item.Sheet, item.RowNum)] = true
+		for _, src := range item.Sources {
+			rows[models.RowKey(src.Source, src.Sheet, src.RowNum)] = true
+		}
+	}
+	return rows
+}
+
 func parseEmailList(emailsStr string) []string {
 	if emailsStr == "" {
 		return []string{}
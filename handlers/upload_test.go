@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"sending-stocks/models"
+	"sending-stocks/processors"
+	"sending-stocks/services"
+)
+
+func TestReportDate(t *testing.T) {
+	msk := time.FixedZone("MSK", 3*60*60)
+	// В UTC еще 31 декабря
+	h := &UploadHandler{clock: models.FixedClock{Time: time.Date(2027, 1, 1, 0, 30, 0, 0, msk)}}
+
+	tests := []struct {
+		name       string
+		reportDate string
+		override   string
+		want       string
+	}{
+		{"текущая дата по часам бизнеса", "", "", "2027-01-01"},
+		{"дата из шапки ведомости", "2026-12-31", "", "2026-12-31"},
+		{"дата из запроса", "2026-12-31", "2026-11-30", "2026-11-30"},
+		{"дата из запроса ДД.ММ.ГГГГ", "", "29.02.2028", "2028-02-29"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := h.reportDate(&models.ProcessedFile{ReportDate: tt.reportDate}, tt.override)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Format("2006-01-02") != tt.want {
+				t.Errorf("reportDate = %s, ожидалось %s", got.Format("2006-01-02"), tt.want)
+			}
+			if got.Location() != msk {
+				t.Errorf("часовой пояс %v, ожидался %v", got.Location(), msk)
+			}
+		})
+	}
+
+	if _, err := h.reportDate(&models.ProcessedFile{}, "2026-02-30"); err == nil {
+		t.Error("несуществующая дата принята")
+	}
+}
+
+func TestSnapshotByIDAndDate(t *testing.T) {
+	msk := time.FixedZone("MSK", 3*60*60)
+	h := &UploadHandler{
+		results: services.NewResultStore(t.TempDir()),
+		clock:   models.FixedClock{Time: time.Date(2026, 10, 16, 9, 0, 0, 0, msk)},
+	}
+
+	older := &models.ProcessedFile{ReportDate: "2026-10-14", UploadDate: "2026-10-14 18:00:00"}
+	newer := &models.ProcessedFile{ReportDate: "2026-10-15", UploadDate: "2026-10-15 18:00:00"}
+	for _, p := range []*models.ProcessedFile{older, newer} {
+		if err := h.results.Save(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if p, err := h.snapshot("", "14.10.2026"); err != nil || p.ID != older.ID {
+		t.Errorf("снимок на дату: %v, %v", p, err)
+	}
+	if p, err := h.snapshot(older.ID, "2026-10-14"); err != nil || p.ID != older.ID {
+		t.Errorf("снимок по id и совпадающей дате: %v, %v", p, err)
+	}
+	// Остатки другого дня нельзя переименовать датой отправки
+	if _, err := h.snapshot(newer.ID, "2026-10-14"); err == nil || errors.Is(err, services.ErrUnknownID) {
+		t.Errorf("снимок на 15.10 принят для даты 14.10: %v", err)
+	}
+	if _, err := h.snapshot("", "2026-10-13"); !errors.Is(err, services.ErrUnknownID) {
+		t.Errorf("снимок на дату без обработок: %v", err)
+	}
+}
+
+// stockWorkbook книга в формате ведомости 1С (данные со 2-й строки): наименование, бренд, код 1С, остаток;
+// типоразмер и цена у всех строк одинаковые
+func stockWorkbook(t *testing.T, rows [][4]interface{}) []byte {
+	t.Helper()
+	f := excelize.NewFile()
+	defer f.Close()
+	f.SetCellValue("Sheet1", "A1", "Остатки")
+	for i, row := range rows {
+		r := i + 2
+		f.SetCellValue("Sheet1", fmt.Sprintf("A%d", r), row[0])
+		f.SetCellValue("Sheet1", fmt.Sprintf("C%d", r), row[1])
+		f.SetCellValue("Sheet1", fmt.Sprintf("F%d", r), row[2])
+		f.SetCellValue("Sheet1", fmt.Sprintf("H%d", r), "205/55 R16")
+		f.SetCellValue("Sheet1", fmt.Sprintf("I%d", r), row[3])
+		f.SetCellValue("Sheet1", fmt.Sprintf("J%d", r), 1000)
+	}
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCombineSplitsIkonClientsBySource(t *testing.T) {
+	clock := models.FixedClock{Time: time.Date(2026, 10, 18, 19, 33, 15, 0, time.UTC)}
+	parser := processors.NewStockParser(2, nil, nil, nil, nil, clock)
+	combiner, err := processors.NewStockCombiner(parser, processors.CombineByCode1C)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ikon, err := processors.NewIkonProcessor("Компания", processors.IkonLayout{
+		Columns: []processors.IkonColumn{
+			{ID: "client", Caption: "Клиент", Type: processors.IkonColumnClient},
+			{ID: "all", Caption: "Все остатки", Type: processors.IkonColumnAll},
+		},
+		Clients: []processors.IkonClient{
+			{Name: "ИП Семисотнов", Sources: []string{"msk.xlsx"}},
+			{Name: "ООО Шинный центр", Sources: []string{"tver.xlsx"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &UploadHandler{
+		adminPassword: "pw",
+		combiner:      combiner,
+		ikonProcessor: ikon,
+		uploadStore:   services.NewUploadStore(t.TempDir(), 10<<20, 100<<20, 1000, clock),
+		results:       services.NewResultStore(t.TempDir()),
+		clock:         clock,
+	}
+
+	// Одна позиция есть в обоих файлах и складывается в одну строку снимка
+	ids := make([]string, 0, 2)
+	for name, rows := range map[string][][4]interface{}{
+		"msk.xlsx":  {{"Шина 1", "Nokian лето", "101", 4}, {"Шина 2", "Nokian зима", "102", 6}},
+		"tver.xlsx": {{"Шина 1", "Nokian лето", "101", 3}, {"Шина 3", "Ikon зима", "103", 2}},
+	} {
+		record, _, err := h.uploadStore.Save(name, bytes.NewReader(stockWorkbook(t, rows)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, record.ID)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"password": "pw", "upload_ids": ids})
+	rec := httptest.NewRecorder()
+	h.HandleCombine(rec, httptest.NewRequest(http.MethodPost, "/api/combine", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("объединение: %d %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Data models.ProcessedFile `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	processed := &resp.Data
+
+	want := map[string]int{"ИП Семисотнов": 10, "ООО Шинный центр": 5}
+	for _, total := range ikon.ClientTotals(ikonItems(processed)) {
+		if total.Total != want[total.Name] {
+			t.Errorf("клиент %s: остаток %d, ожидалось %d", total.Name, total.Total, want[total.Name])
+		}
+	}
+}
+
+func TestValuationItemsUsesOriginalNames(t *testing.T) {
+	clock := models.FixedClock{Time: time.Date(2026, 10, 18, 19, 33, 15, 0, time.UTC)}
+	h := &UploadHandler{
+		uploadStore: services.NewUploadStore(t.TempDir(), 10<<20, 100<<20, 1000, clock),
+		clock:       clock,
+	}
+
+	records := make([]*models.UploadRecord, 0, 2)
+	for i, name := range []string{"msk.xlsx", "msk.xlsx"} {
+		record, _, err := h.uploadStore.Save(name, bytes.NewReader(stockWorkbook(t, [][4]interface{}{{"Шина", "Nokian лето", "101", i + 1}})))
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+
+	// Объединенный снимок, сохраненный с именами загрузок на диске
+	old := &models.ProcessedFile{
+		SourceFiles: []string{records[0].Filename, records[1].Filename},
+		SourceIDs:   []string{records[0].ID, records[1].ID},
+		AllItems: []models.StockItem{{
+			Source: records[0].Filename,
+			Sources: []models.StockSource{
+				{Source: records[0].Filename, Quantity: 1},
+				{Source: records[1].Filename, Quantity: 2},
+			},
+		}},
+	}
+	items := h.valuationItems(old)
+	got := []string{items[0].Source, items[0].Sources[0].Source, items[0].Sources[1].Source}
+	if want := []string{"msk.xlsx", "msk.xlsx", "msk.xlsx (2)"}; !slices.Equal(got, want) {
+		t.Errorf("источники %v, ожидалось %v", got, want)
+	}
+	if old.AllItems[0].Sources[1].Source != records[1].Filename {
+		t.Error("снимок изменен")
+	}
+
+	// В новых снимках источник уже имя файла у пользователя
+	current := &models.ProcessedFile{
+		SourceFiles: []string{"msk.xlsx", "msk.xlsx (2)"},
+		SourceIDs:   []string{records[0].ID, records[1].ID},
+		AllItems:    []models.StockItem{{Source: "msk.xlsx (2)"}},
+	}
+	if items := h.valuationItems(current); items[0].Source != "msk.xlsx (2)" {
+		t.Errorf("источник нового снимка %q", items[0].Source)
+	}
+}
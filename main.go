@@ -7,10 +7,12 @@ import (
 	"os"
 	"strings"
 	"time"
+	_ "time/tzdata" // база часовых поясов для контейнеров без tzdata
 
 	"github.com/joho/godotenv"
 
 	"sending-stocks/handlers"
+	"sending-stocks/models"
 	"sending-stocks/processors"
 	"sending-stocks/services"
 )
@@ -21,6 +23,24 @@ type Config struct {
 	UploadDir     string
 	ProcessedDir  string
 
+	// Часовой пояс бизнеса для дат отчетов, имен файлов и писем
+	Timezone string
+
+	// Журнал отправок отчетов (не очищается вместе с загрузками)
+	DeliveryLogFile string
+
+	// Каталог Excel шаблонов отчетов производителей
+	ReportTemplatesDir string
+
+	// Определения пользовательских отчетов (JSON)
+	CustomReportsFile string
+
+	// SFTP получатели отчетов (JSON)
+	SFTPTargetsFile string
+
+	// Настройки EDIFACT INVRPT по отчетам (JSON)
+	InvrptFile string
+
 	// SMTP Configuration
 	SMTPHost     string
 	SMTPPort     int
@@ -54,22 +74,59 @@ type Config struct {
 	IkonWinterC       []string
 	IkonSummerExclude []string
 	IkonWinterExclude []string
+	IkonLayoutFile    string // JSON с колонками отчета, пусто - раскладка по IKON_* группам
 
 	// Cordiant бренды
 	CordiantBrands []string
 
+	// Cordiant: число первых дней месяца, когда отчет отправляется за предыдущий месяц
+	CordiantPeriodGraceDays int
+
 	// Cordiant API
 	CordiantBaseURL  string
 	CordiantToken    string
 	CordiantLogin    string
 	CordiantPassword string
 
+	// Cordiant: действие API для получения токена по логину и паролю и срок жизни токена (мин)
+	CordiantAuthAction  string
+	CordiantTokenTTLMin int
+
 	// Hankook бренды
 	HankookBrands []string
+
+	// Файл с правилами валидации (JSON), пусто - правила по умолчанию
+	ValidationRulesFile string
+
+	// Дубликаты: политика по умолчанию и по брендам ("Pirelli:sum,Cordiant:reject")
+	DuplicatePolicy      string
+	DuplicateBrandPolicy string
+
+	// Залежалый товар: возраст в годах, действие по умолчанию и по брендам ("Pirelli:exclude,Hankook:flag")
+	AgedStockYears       int
+	AgedStockAction      string
+	AgedStockBrandAction string
+
+	// Отчет о стоимости остатков: сколько самых дорогих по остатку кодов показывать
+	ValuationTopSKUs int
+
+	// Нормализация кода производителя: цепочка по умолчанию и по брендам ("Hankook=digits|last:7")
+	SKUNormalize       string
+	SKUNormalizeBrands string
+	SKUNormalizeFile   string // JSON с цепочками (заменяет SKU_NORMALIZE и SKU_NORMALIZE_BRANDS)
+
+	// Объединение ведомостей филиалов: ключ объединения позиций (code_1c, sku, none)
+	CombineKey string
+
+	// Ограничения загрузки: размер файла и распакованного содержимого (МБ), число файлов в архиве
+	UploadMaxMB         int
+	UploadMaxUnzippedMB int
+	UploadMaxZipEntries int
 }
 
 var (
 	config                Config
+	clock                 models.Clock
 	parser                *processors.StockParser
 	pirelliAPI            *services.PirelliAPIService
 	ikonProcessor         *processors.IkonProcessor
@@ -77,6 +134,15 @@ var (
 	cordiantProcessor     *processors.CordiantProcessor
 	cordiantAPI           *services.CordiantAPIService
 	hankookProcessor      *processors.HankookProcessor
+	agedProcessor         *processors.AgedStockProcessor
+	invrptProcessor       *processors.InvrptProcessor
+	valuationProcessor    *processors.ValuationProcessor
+	combiner              *processors.StockCombiner
+	uploadStore           *services.UploadStore
+	deliveryLog           *services.DeliveryLog
+	templateStore         *services.TemplateStore
+	customReportStore     *services.CustomReportStore
+	sftpService           *services.SFTPService
 	smtpService           *services.SMTPService
 )
 
@@ -87,20 +153,102 @@ func main() {
 	// Выводим конфигурацию для отладки
 	log.Println("=== Конфигурация ===")
 	log.Printf("ServerPort: %s", config.ServerPort)
+	log.Printf("Timezone: %s", config.Timezone)
 	log.Printf("SMTP Host: %s", config.SMTPHost)
 	log.Printf("Pirelli Brands: %v", config.PirelliBrands)
 	log.Printf("Cordiant Brands: %v", config.CordiantBrands)
 	log.Printf("Hankook Brands: %v", config.HankookBrands)
 	log.Printf("Ikon Summer Exclude: %v", config.IkonSummerExclude)
 	log.Printf("Ikon Winter Exclude: %v", config.IkonWinterExclude)
+	log.Printf("SKU Normalize: %s; по брендам: %s", config.SKUNormalize, config.SKUNormalizeBrands)
 	log.Println("===================")
 
+	// Часы в часовом поясе бизнеса - общие для всех процессоров и сервисов
+	location, err := time.LoadLocation(config.Timezone)
+	if err != nil {
+		log.Fatalf("Ошибка в TIMEZONE: %v", err)
+	}
+	clock = models.NewZoneClock(location)
+
 	// Создаем директории
 	os.MkdirAll(config.UploadDir, 0755)
 	os.MkdirAll(config.ProcessedDir, 0755)
 
+	// Хранилище загрузок с проверкой содержимого
+	uploadStore = services.NewUploadStore(
+		config.UploadDir,
+		int64(config.UploadMaxMB)<<20,
+		int64(config.UploadMaxUnzippedMB)<<20,
+		config.UploadMaxZipEntries,
+		clock,
+	)
+
+	// Журнал отправок отчетов
+	deliveryLog = services.NewDeliveryLog(config.DeliveryLogFile, clock)
+
+	// Excel шаблоны отчетов производителей
+	templateStore = services.NewTemplateStore(config.ReportTemplatesDir, handlers.TemplateReports, uploadStore)
+
+	// Пользовательские отчеты
+	customReportStore = services.NewCustomReportStore(config.CustomReportsFile, clock)
+
+	// SFTP получатели отчетов
+	if config.SFTPTargetsFile != "" {
+		targets, err := services.LoadSFTPTargets(config.SFTPTargetsFile)
+		if err != nil {
+			log.Fatalf("Ошибка загрузки SFTP получателей: %v", err)
+		}
+		sftpService, err = services.NewSFTPService(targets, clock)
+		if err != nil {
+			log.Fatalf("Ошибка в настройках SFTP: %v", err)
+		}
+		log.Printf("SFTP получателей: %d", len(sftpService.Targets))
+	}
+
+	// Загружаем правила валидации
+	rules := processors.DefaultValidationRules(config.PirelliBrands, config.CordiantBrands)
+	if config.ValidationRulesFile != "" {
+		loaded, err := processors.LoadValidationRules(config.ValidationRulesFile)
+		if err != nil {
+			log.Fatalf("Ошибка загрузки правил валидации: %v", err)
+		}
+		rules = loaded
+	}
+	validator, err := processors.NewValidator(rules)
+	if err != nil {
+		log.Fatalf("Ошибка в правилах валидации: %v", err)
+	}
+	log.Printf("Загружено правил валидации: %d", len(validator.Rules))
+
+	// Политики обработки дубликатов
+	brandPolicies, err := processors.ParseBrandDuplicatePolicies(config.DuplicateBrandPolicy)
+	if err != nil {
+		log.Fatalf("Ошибка в DUPLICATE_POLICY_BRANDS: %v", err)
+	}
+	duplicates, err := processors.NewDuplicateResolver(config.DuplicatePolicy, brandPolicies)
+	if err != nil {
+		log.Fatalf("Ошибка в настройках дубликатов: %v", err)
+	}
+
+	// Нормализация кодов производителя
+	var skuNormalizer *processors.SKUNormalizer
+	if config.SKUNormalizeFile != "" {
+		skuNormalizer, err = processors.LoadSKUNormalizer(config.SKUNormalizeFile)
+	} else {
+		skuNormalizer, err = processors.NewSKUNormalizer(config.SKUNormalize, config.SKUNormalizeBrands)
+	}
+	if err != nil {
+		log.Fatalf("Ошибка в настройках нормализации кодов: %v", err)
+	}
+
 	// Инициализируем парсер с конфигурацией Pirelli брендов
-	parser = processors.NewStockParser(12, config.PirelliBrands)
+	parser = processors.NewStockParser(12, config.PirelliBrands, validator, duplicates, skuNormalizer, clock)
+
+	// Объединение ведомостей нескольких филиалов
+	combiner, err = processors.NewStockCombiner(parser, config.CombineKey)
+	if err != nil {
+		log.Fatalf("Ошибка в COMBINE_KEY: %v", err)
+	}
 
 	// Инициализируем SMTP сервис
 	if config.SMTPHost != "" && config.SMTPUsername != "" {
@@ -110,6 +258,7 @@ func main() {
 			config.SMTPUsername,
 			config.SMTPPassword,
 			config.SMTPFrom,
+			clock,
 		)
 		log.Println("SMTP сервис инициализирован")
 	} else {
@@ -129,26 +278,34 @@ func main() {
 		log.Println("ВНИМАНИЕ: API Pirelli не настроен (нет логина или токена)")
 	}
 
-	// Инициализируем процессор Ikon
-	summerGroups := map[string][]string{
-		"B": config.IkonSummerA,
-		"C": config.IkonSummerB,
-		"D": config.IkonSummerC,
-		"E": config.IkonSummerD,
-	}
-	winterGroups := map[string][]string{
-		"H": config.IkonWinterA,
-		"I": config.IkonWinterB,
-		"J": config.IkonWinterC,
-	}
-
-	ikonProcessor = processors.NewIkonProcessor(
-		config.IkonCompanyName,
-		summerGroups,
-		winterGroups,
+	// Инициализируем процессор Ikon: раскладка из файла или по умолчанию из IKON_* групп
+	ikonLayout := processors.DefaultIkonLayout(
+		[]processors.IkonGroup{
+			{Caption: "Summer A", Brands: config.IkonSummerA, Width: 12},
+			{Caption: "Summer B", Brands: config.IkonSummerB, Width: 12},
+			{Caption: "Bars", Brands: config.IkonSummerC, Width: 10},
+			{Caption: "Attar", Brands: config.IkonSummerD, Width: 10},
+		},
+		[]processors.IkonGroup{
+			{Caption: "Winter A", Brands: config.IkonWinterA, Width: 12},
+			{Caption: "Winter B", Brands: config.IkonWinterB, Width: 12},
+			{Caption: "Attar", Brands: config.IkonWinterC, Width: 10},
+		},
 		config.IkonSummerExclude,
 		config.IkonWinterExclude,
 	)
+	if config.IkonLayoutFile != "" {
+		loaded, err := processors.LoadIkonLayout(config.IkonLayoutFile)
+		if err != nil {
+			log.Fatalf("Ошибка загрузки раскладки Ikon: %v", err)
+		}
+		ikonLayout = loaded
+	}
+	ikonProcessor, err = processors.NewIkonProcessor(config.IkonCompanyName, ikonLayout)
+	if err != nil {
+		log.Fatalf("Ошибка в раскладке Ikon: %v", err)
+	}
+	log.Printf("Колонок в отчете Ikon: %d", len(ikonProcessor.Layout.Columns))
 	log.Println("Процессор Ikon инициализирован")
 
 	// Инициализируем процессор Excel для Pirelli
@@ -156,26 +313,60 @@ func main() {
 	log.Println("Процессор Pirelli Excel инициализирован")
 
 	// Инициализируем процессор Cordiant
-	cordiantProcessor = processors.NewCordiantProcessor(config.CordiantBrands)
+	cordiantProcessor = processors.NewCordiantProcessor(config.CordiantBrands, config.CordiantPeriodGraceDays, clock)
 	log.Println("Процессор Cordiant инициализирован")
 
 	// Инициализируем API для Cordiant
-	if config.CordiantToken != "" {
+	if config.CordiantToken != "" || (config.CordiantLogin != "" && config.CordiantPassword != "") {
 		cordiantAPI = services.NewCordiantAPIService(
 			config.CordiantBaseURL,
 			config.CordiantToken,
 			config.CordiantLogin,
 			config.CordiantPassword,
+			config.CordiantAuthAction,
+			time.Duration(config.CordiantTokenTTLMin)*time.Minute,
+			clock,
 		)
 		log.Println("API Cordiant инициализирован")
 	} else {
-		log.Println("ВНИМАНИЕ: API Cordiant не настроен (нет токена)")
+		log.Println("ВНИМАНИЕ: API Cordiant не настроен (нет токена и учетных данных)")
 	}
 
 	// Инициализируем процессор Hankook
 	hankookProcessor = processors.NewHankookProcessor(config.HankookBrands)
 	log.Println("Процессор Hankook инициализирован")
 
+	// Инициализируем процессор залежалого товара
+	agedPolicies, err := processors.ParseBrandAgedPolicies(config.AgedStockBrandAction)
+	if err != nil {
+		log.Fatalf("Ошибка в AGED_STOCK_BRANDS: %v", err)
+	}
+	agedProcessor, err = processors.NewAgedStockProcessor(config.AgedStockYears, config.AgedStockAction, agedPolicies, clock)
+	if err != nil {
+		log.Fatalf("Ошибка в настройках залежалого товара: %v", err)
+	}
+	log.Println("Процессор залежалого товара инициализирован")
+
+	// Инициализируем процессор стоимости остатков
+	valuationProcessor, err = processors.NewValuationProcessor(config.ValuationTopSKUs)
+	if err != nil {
+		log.Fatalf("Ошибка в VALUATION_TOP_SKUS: %v", err)
+	}
+	log.Println("Процессор стоимости остатков инициализирован")
+
+	// Инициализируем процессор EDIFACT INVRPT
+	if config.InvrptFile != "" {
+		invrptConfigs, err := processors.LoadInvrptConfigs(config.InvrptFile)
+		if err != nil {
+			log.Fatalf("Ошибка загрузки настроек INVRPT: %v", err)
+		}
+		invrptProcessor, err = processors.NewInvrptProcessor(invrptConfigs, clock)
+		if err != nil {
+			log.Fatalf("Ошибка в настройках INVRPT: %v", err)
+		}
+		log.Printf("Процессор INVRPT инициализирован, отчетов: %d", len(invrptProcessor.Configs))
+	}
+
 	// Настраиваем маршруты
 	setupRoutes()
 
@@ -221,6 +412,12 @@ func loadConfig() {
 		hankookBrands[i] = strings.TrimSpace(brand)
 	}
 
+	// По умолчанию Hankook получает последние 7 цифр кода
+	hankookSKUSpecs := make([]string, 0, len(hankookBrands))
+	for _, brand := range hankookBrands {
+		hankookSKUSpecs = append(hankookSKUSpecs, brand+"=digits|last:7")
+	}
+
 	// Получаем списки email-адресов
 	pirelliEmailsStr := getEnv("PIRELLI_EMAILS", "")
 	ikonEmailsStr := getEnv("IKON_EMAILS", "")
@@ -236,6 +433,14 @@ func loadConfig() {
 		AdminPassword: getEnv("ADMIN_PASSWORD", "admin123"),
 		UploadDir:     getEnv("UPLOAD_DIR", "./uploads"),
 		ProcessedDir:  getEnv("PROCESSED_DIR", "./uploads/processed"),
+		Timezone:      getEnv("TIMEZONE", "Europe/Moscow"),
+
+		DeliveryLogFile: getEnv("DELIVERY_LOG_FILE", "./data/deliveries.json"),
+
+		ReportTemplatesDir: getEnv("REPORT_TEMPLATES_DIR", "./data/report-templates"),
+		CustomReportsFile:  getEnv("CUSTOM_REPORTS_FILE", "./data/custom-reports.json"),
+		SFTPTargetsFile:    getEnv("SFTP_TARGETS_FILE", ""),
+		InvrptFile:         getEnv("EDI_INVRPT_FILE", ""),
 
 		// SMTP
 		SMTPHost:     getEnv("SMTP_HOST", "smtp.mail.ru"),
@@ -268,16 +473,48 @@ func loadConfig() {
 		IkonWinterC:       parseBrandList(getEnv("IKON_WINTER_C", "Attar")),
 		IkonSummerExclude: parseBrandList(ikonSummerExcludeStr),
 		IkonWinterExclude: parseBrandList(ikonWinterExcludeStr),
+		IkonLayoutFile:    getEnv("IKON_LAYOUT_FILE", ""),
 
 		// Cordiant
-		CordiantBrands:   cordiantBrands,
-		CordiantBaseURL:  getEnv("CORDIANT_BASE_URL", "https://b2b.cordiant.ru/rest/"),
-		CordiantToken:    getEnv("CORDIANT_TOKEN", "ec6c337186cd1a807399e64a103f64a3"),
-		CordiantLogin:    getEnv("CORDIANT_LOGIN", "Semisotnov_IPYA"),
-		CordiantPassword: getEnv("CORDIANT_PASSWORD", "Semisotnov_IPYA2018"),
+		CordiantBrands:          cordiantBrands,
+		CordiantPeriodGraceDays: getEnvInt("CORDIANT_PERIOD_GRACE_DAYS", 5),
+		CordiantBaseURL:         getEnv("CORDIANT_BASE_URL", "https://b2b.cordiant.ru/rest/"),
+		CordiantToken:           getEnv("CORDIANT_TOKEN", "ec6c337186cd1a807399e64a103f64a3"),
+		CordiantLogin:           getEnv("CORDIANT_LOGIN", "Semisotnov_IPYA"),
+		CordiantPassword:        getEnv("CORDIANT_PASSWORD", "Semisotnov_IPYA2018"),
+		CordiantAuthAction:      getEnv("CORDIANT_AUTH_ACTION", "auth"),
+		CordiantTokenTTLMin:     getEnvInt("CORDIANT_TOKEN_TTL_MIN", 60),
 
 		// Hankook
 		HankookBrands: hankookBrands,
+
+		// Валидация
+		ValidationRulesFile: getEnv("VALIDATION_RULES_FILE", ""),
+
+		// Дубликаты
+		DuplicatePolicy:      getEnv("DUPLICATE_POLICY", "sum"),
+		DuplicateBrandPolicy: getEnv("DUPLICATE_POLICY_BRANDS", ""),
+
+		// Залежалый товар
+		AgedStockYears:       getEnvInt("AGED_STOCK_YEARS", 2),
+		AgedStockAction:      getEnv("AGED_STOCK_ACTION", "include"),
+		AgedStockBrandAction: getEnv("AGED_STOCK_BRANDS", ""),
+
+		// Стоимость остатков
+		ValuationTopSKUs: getEnvInt("VALUATION_TOP_SKUS", 20),
+
+		// Нормализация кодов производителя
+		SKUNormalize:       getEnv("SKU_NORMALIZE", "digits"),
+		SKUNormalizeBrands: getEnv("SKU_NORMALIZE_BRANDS", strings.Join(hankookSKUSpecs, ";")),
+		SKUNormalizeFile:   getEnv("SKU_NORMALIZE_FILE", ""),
+
+		// Объединение ведомостей
+		CombineKey: getEnv("COMBINE_KEY", "code_1c"),
+
+		// Ограничения загрузки
+		UploadMaxMB:         getEnvInt("UPLOAD_MAX_MB", 20),
+		UploadMaxUnzippedMB: getEnvInt("UPLOAD_MAX_UNZIPPED_MB", 200),
+		UploadMaxZipEntries: getEnvInt("UPLOAD_MAX_ZIP_ENTRIES", 1000),
 	}
 }
 
@@ -356,6 +593,16 @@ func setupRoutes() {
 		pirelliExcelProcessor,
 		cordiantProcessor,
 		hankookProcessor,
+		agedProcessor,
+		invrptProcessor,
+		valuationProcessor,
+		combiner,
+		uploadStore,
+		deliveryLog,
+		templateStore,
+		customReportStore,
+		sftpService,
+		clock,
 	)
 
 	// Статические файлы
@@ -369,6 +616,7 @@ func setupRoutes() {
 	http.HandleFunc("/api/check-password", uploadHandler.HandleCheckPassword)
 	http.HandleFunc("/api/upload", uploadHandler.HandleUpload)
 	http.HandleFunc("/api/process", uploadHandler.HandleProcess)
+	http.HandleFunc("/api/combine", uploadHandler.HandleCombine)
 
 	// Pirelli
 	http.HandleFunc("/api/download-pirelli-csv", uploadHandler.HandleDownloadPirelliCSV)
@@ -383,11 +631,37 @@ func setupRoutes() {
 	// Cordiant
 	http.HandleFunc("/api/download-cordiant-csv", uploadHandler.HandleDownloadCordiantCSV)
 	http.HandleFunc("/api/send-cordiant", uploadHandler.HandleSendCordiant)
+	http.HandleFunc("/api/cordiant-period", uploadHandler.HandleCordiantPeriod)
+	http.HandleFunc("/api/download-cordiant-rejected", uploadHandler.HandleDownloadCordiantRejected)
 
 	// Hankook
 	http.HandleFunc("/api/download-hankook-excel", uploadHandler.HandleDownloadHankookExcel)
 	http.HandleFunc("/api/send-hankook", uploadHandler.HandleSendHankook)
 
+	// Шаблоны отчетов
+	http.HandleFunc("/api/report-templates", uploadHandler.HandleReportTemplates)
+
+	// Пользовательские отчеты
+	http.HandleFunc("/api/custom-reports", uploadHandler.HandleCustomReports)
+	http.HandleFunc("/api/custom-reports/{id}", uploadHandler.HandleCustomReport)
+	http.HandleFunc("/api/custom-reports/{id}/send", uploadHandler.HandleSendCustomReport)
+
+	// EDIFACT INVRPT
+	http.HandleFunc("/api/download-invrpt", uploadHandler.HandleDownloadInvrpt)
+	http.HandleFunc("/api/send-invrpt", uploadHandler.HandleSendInvrpt)
+
+	// SFTP
+	http.HandleFunc("/api/send-sftp", uploadHandler.HandleSendSFTP)
+
+	// Качество данных
+	http.HandleFunc("/api/download-quality-report", uploadHandler.HandleDownloadQualityReport)
+	http.HandleFunc("/api/download-aged-report", uploadHandler.HandleDownloadAgedReport)
+	http.HandleFunc("/api/valuation-report", uploadHandler.HandleValuationReport)
+
+	// Журнал отправок и состояние интеграций
+	http.HandleFunc("/api/deliveries", uploadHandler.HandleDeliveries)
+	http.HandleFunc("/api/status", uploadHandler.HandleStatus)
+
 	// Clear
 	http.HandleFunc("/api/clear", uploadHandler.HandleClear)
 }
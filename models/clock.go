@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Clock источник текущего времени в часовом поясе бизнеса.
+// Все даты отчетов, имен файлов и писем берутся из него, а не из time.Now()
+type Clock interface {
+	Now() time.Time
+	Location() *time.Location
+}
+
+// ZoneClock системные часы в заданном часовом поясе
+type ZoneClock struct {
+	loc *time.Location
+}
+
+// NewZoneClock создает часы в часовом поясе loc (nil - локальный пояс сервера)
+func NewZoneClock(loc *time.Location) *ZoneClock {
+	if loc == nil {
+		loc = time.Local
+	}
+	return &ZoneClock{loc: loc}
+}
+
+// Now текущее время в часовом поясе часов
+func (c *ZoneClock) Now() time.Time {
+	return time.Now().In(c.loc)
+}
+
+// Location часовой пояс часов
+func (c *ZoneClock) Location() *time.Location {
+	return c.loc
+}
+
+// FixedClock часы, всегда показывающие одно и то же время (для тестов и повторяемых выгрузок)
+type FixedClock struct {
+	Time time.Time
+}
+
+// Now зафиксированное время
+func (c FixedClock) Now() time.Time {
+	return c.Time
+}
+
+// Location часовой пояс зафиксированного времени
+func (c FixedClock) Location() *time.Location {
+	return c.Time.Location()
+}
@@ -2,6 +2,8 @@ package models
 
 // CordiantItem представляет позицию для отчета Cordiant
 type CordiantItem struct {
+	Source     string `json:"source,omitempty"`
+	Sheet      string `json:"sheet"`
 	RowNum     int    `json:"row_num"`
 	Code       string `json:"code"`        // код товара (ManufacturerSKU)
 	TireSize   string `json:"tire_size"`   // типоразмер
@@ -10,6 +12,19 @@ type CordiantItem struct {
 	CleanBrand string `json:"clean_brand"` // очищенный бренд
 }
 
+// CordiantRejectedItem позиция, строку которой Cordiant отклонил при импорте
+type CordiantRejectedItem struct {
+	Line     int    `json:"line"` // номер строки в отправленном CSV
+	Source   string `json:"source,omitempty"`
+	Sheet    string `json:"sheet"`
+	RowNum   int    `json:"row_num"` // строка исходной ведомости 1С (0 - строки нет в файле)
+	Code     string `json:"code"`
+	TireSize string `json:"tire_size"`
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+	Warning  string `json:"warning"` // замечание Cordiant по строке
+}
+
 // CordiantRequest запрос к API Cordiant
 type CordiantRequest struct {
 	Year   string `json:"year"`
@@ -38,4 +53,13 @@ type CordiantResponse struct {
 	Success bool        `json:"success"`
 	Message string      `json:"message"`
 	Data    interface{} `json:"data,omitempty"`
+
+	// За период уже загружены остатки (isHavePrevRecords); импорт ждет подтверждения
+	// перезаписи вызовом функции ConfirmFunction, которую вернул API
+	HavePrevRecords bool   `json:"have_prev_records"`
+	ConfirmFunction string `json:"confirm_function,omitempty"`
+
+	// Номера отклоненных строк CSV (errorFileStrings) и предупреждения API
+	ErrorLines []int    `json:"error_lines,omitempty"`
+	Warnings   []string `json:"warnings,omitempty"`
 }
@@ -0,0 +1,30 @@
+package models
+
+// CustomReport пользовательский отчет: отбор позиций, колонки, сортировка и группировка
+type CustomReport struct {
+	ID      string         `json:"id"`
+	Name    string         `json:"name"`
+	Filters []CustomFilter `json:"filters,omitempty"`  // условия отбора (все должны выполняться)
+	Columns []string       `json:"columns,omitempty"`  // поля позиции в порядке колонок (пусто - основные поля)
+	Sort    []CustomSort   `json:"sort,omitempty"`     // порядок строк
+	GroupBy []string       `json:"group_by,omitempty"` // поля группировки: строка «Итого» после каждой группы
+	Format  string         `json:"format"`             // csv или xlsx
+	Emails  []string       `json:"emails,omitempty"`   // получатели при отправке по email
+
+	CreatedAt string `json:"created_at,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+// CustomFilter условие отбора по полю позиции
+type CustomFilter struct {
+	Field  string   `json:"field"`            // имя поля как в JSON позиции (season, quantity, rim, ...)
+	Op     string   `json:"op"`               // eq, ne, contains, in, gt, gte, lt, lte, regex, empty, not_empty
+	Value  string   `json:"value,omitempty"`  // значение сравнения
+	Values []string `json:"values,omitempty"` // значения для in
+}
+
+// CustomSort сортировка по полю
+type CustomSort struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc,omitempty"`
+}
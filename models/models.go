@@ -2,30 +2,90 @@ package models
 
 // StockItem данные из строки файла
 type StockItem struct {
-	RowNum          int     `json:"row_num"`          // номер строки
-	Name            string  `json:"name"`             // столбец A - наименование
-	Brand           string  `json:"brand"`            // столбец C - бренд (с сезоном)
-	Code1C          string  `json:"code_1c"`          // столбец F - код в 1С (только цифры)
-	ManufacturerSKU string  `json:"manufacturer_sku"` // столбец G - код производителя (только цифры)
-	TireSize        string  `json:"tire_size"`        // столбец H - типоразмер
-	Quantity        int     `json:"quantity"`         // столбец I - остаток
-	Price           float64 `json:"price"`            // столбец J - цена
+	Source             string  `json:"source,omitempty"`     // загруженный файл (для объединенного снимка)
+	Sheet              string  `json:"sheet"`                // лист книги
+	RowNum             int     `json:"row_num"`              // номер строки
+	Name               string  `json:"name"`                 // столбец A - наименование
+	Characteristic     string  `json:"characteristic"`       // столбец B - характеристика
+	Brand              string  `json:"brand"`                // столбец C - бренд (с сезоном)
+	Code1C             string  `json:"code_1c"`              // столбец F - код в 1С (только цифры)
+	ManufacturerSKU    string  `json:"manufacturer_sku"`     // столбец G - код производителя (в формате бренда)
+	RawManufacturerSKU string  `json:"raw_manufacturer_sku"` // столбец G - код производителя как в файле
+	TireSize           string  `json:"tire_size"`            // столбец H - типоразмер
+	Quantity           int     `json:"quantity"`             // столбец I - остаток (целая часть)
+	RawQuantity        float64 `json:"raw_quantity"`         // столбец I - остаток как в файле (со знаком и дробной частью)
+	Price              float64 `json:"price"`                // столбец J - цена
 
 	// Обработанные поля
 	CleanBrand string `json:"clean_brand"` // бренд без сезона и *
 	Season     string `json:"season"`      // лето/зима
 	IsYearOld  bool   `json:"is_year_old"` // есть ли "год" в названии
 	IsPirelli  bool   `json:"is_pirelli"`  // относится к Pirelli/Formula
+
+	// Дата производства
+	ProductionYear int  `json:"production_year,omitempty"` // год выпуска (из наименования/характеристики)
+	DOTWeek        int  `json:"dot_week,omitempty"`        // неделя по DOT, 0 - неизвестна
+	IsAged         bool `json:"is_aged"`                   // залежалый товар (по году выпуска или метке "год")
+	AgedFlag       bool `json:"aged_flag,omitempty"`       // отметить как залежалый в отчете производителя
+
+	// Предупреждения о качестве данных (строка не отбрасывается)
+	Warnings []string `json:"warnings,omitempty"`
+
+	// Источники остатка, если позиция собрана из нескольких файлов
+	Sources []StockSource `json:"sources,omitempty"`
+}
+
+// StockSource строка исходного файла, из которой взят остаток объединенной позиции
+type StockSource struct {
+	Source   string  `json:"source"`
+	Sheet    string  `json:"sheet"`
+	RowNum   int     `json:"row_num"`
+	Quantity int     `json:"quantity"`
+	Price    float64 `json:"price,omitempty"` // цена строки источника (у каждого склада своя)
 }
 
 // ProcessedFile результат обработки
 type ProcessedFile struct {
+	ID           string      `json:"id"` // идентификатор результата обработки
 	Filename     string      `json:"filename"`
+	UploadID     string      `json:"upload_id,omitempty"` // идентификатор исходной загрузки
 	OriginalFile string      `json:"original_file"`
+	OriginalName string      `json:"original_name,omitempty"` // имя загруженного файла у пользователя
 	UploadDate   string      `json:"upload_date"`
+	ReportDate   string      `json:"report_date,omitempty"`  // дата остатков из шапки ведомости (ГГГГ-ММ-ДД)
+	Organization string      `json:"organization,omitempty"` // организация из шапки ведомости
+	Sheets       []string    `json:"sheets"`
+	SourceFiles  []string    `json:"source_files,omitempty"` // исходные файлы объединенного снимка
+	SourceIDs    []string    `json:"source_ids,omitempty"`   // идентификаторы загрузок объединенного снимка
 	PirelliItems []StockItem `json:"pirelli_items"`
 	AllItems     []StockItem `json:"all_items"`
 	Stats        Stats       `json:"stats"`
+
+	// Замечания правил валидации
+	Findings []ValidationFinding `json:"findings"`
+
+	// Объединения дубликатов
+	Merges []DuplicateMerge `json:"merges"`
+
+	// Замечания парсера (ошибки и предупреждения по строкам, включая отброшенные строки)
+	ParseIssues []ValidationFinding `json:"parse_issues"`
+
+	// Позиции, отклоненные Cordiant при последней отправке
+	CordiantRejected []CordiantRejectedItem `json:"cordiant_rejected,omitempty"`
+}
+
+// DuplicateMerge объединение строк с одинаковым кодом
+type DuplicateMerge struct {
+	Source       string   `json:"source,omitempty"`
+	Key          string   `json:"key"`           // код производителя или код 1С
+	Brand        string   `json:"brand"`         // бренд первой строки
+	Policy       string   `json:"policy"`        // sum, keep_first, reject
+	KeptSheet    string   `json:"kept_sheet"`    // лист строки, которая осталась в отчете
+	KeptRow      int      `json:"kept_row"`      // строка, которая осталась в отчете
+	MergedSheets []string `json:"merged_sheets"` // листы строк-дубликатов
+	MergedRows   []int    `json:"merged_rows"`   // строки-дубликаты
+	Quantities   []int    `json:"quantities"`    // остатки всех строк в порядке следования
+	Quantity     int      `json:"quantity"`      // итоговый остаток
 }
 
 // Stats статистика обработки
@@ -35,6 +95,12 @@ type Stats struct {
 	InvalidRows  int      `json:"invalid_rows"`
 	PirelliCount int      `json:"pirelli_count"`
 	Errors       []string `json:"errors,omitempty"`
+	Warnings     []string `json:"warnings,omitempty"`
+
+	DuplicateRows      int `json:"duplicate_rows"`
+	ValidationErrors   int `json:"validation_errors"`
+	ValidationWarnings int `json:"validation_warnings"`
+	CombinedRows       int `json:"combined_rows,omitempty"` // строки, объединенные с позициями других файлов
 }
 
 // UploadResult результат загрузки
@@ -44,6 +110,33 @@ type UploadResult struct {
 	Data    interface{} `json:"data,omitempty"`
 }
 
+// UploadRecord сведения о загруженном файле
+type UploadRecord struct {
+	ID           string `json:"id"`            // идентификатор загрузки
+	Filename     string `json:"filename"`      // имя файла в UPLOAD_DIR
+	OriginalName string `json:"original_name"` // имя файла у пользователя
+	Size         int64  `json:"size"`
+	SHA256       string `json:"sha256"`
+	UploadedAt   string `json:"uploaded_at"`
+}
+
+// Delivery запись журнала отправок отчетов производителям
+type Delivery struct {
+	ID           string `json:"id"`
+	Report       string `json:"report"`           // отчет: pirelli_csv, cordiant
+	Channel      string `json:"channel"`          // способ передачи: api, sftp, email, download
+	StockDate    string `json:"stock_date"`       // дата остатков в отчете, "2006-01-02"
+	Period       string `json:"period,omitempty"` // отчетный период (Cordiant), "2006-01"
+	ResultID     string `json:"result_id"`        // снимок остатков, из которого собран отчет
+	Filename     string `json:"filename"`
+	Items        int    `json:"items"`
+	SentAt       string `json:"sent_at"`
+	Success      bool   `json:"success"`
+	Message      string `json:"message,omitempty"`
+	Correction   bool   `json:"correction"`              // задним числом или повторно за ту же дату
+	CorrectionOf string `json:"correction_of,omitempty"` // предыдущая успешная отправка за ту же дату
+}
+
 // PirelliResponse ответ от API Pirelli
 type PirelliResponse struct {
 	Status  bool   `json:"status"`
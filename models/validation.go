@@ -0,0 +1,29 @@
+package models
+
+import "strconv"
+
+// Уровни важности замечаний валидации
+const (
+	SeverityError   = "error"   // блокирует отправку отчета
+	SeverityWarning = "warning" // только показывается пользователю
+)
+
+// RowKey ключ строки исходного файла с учетом файла и листа
+func RowKey(source, sheet string, rowNum int) string {
+	return source + "|" + sheet + "!" + strconv.Itoa(rowNum)
+}
+
+// ValidationFinding замечание правила валидации, привязанное к строке файла
+type ValidationFinding struct {
+	Source          string `json:"source,omitempty"`
+	Sheet           string `json:"sheet"`
+	RowNum          int    `json:"row_num"`
+	RuleID          string `json:"rule_id"`
+	Severity        string `json:"severity"`
+	Field           string `json:"field"`
+	Value           string `json:"value"`
+	Message         string `json:"message"`
+	Code1C          string `json:"code_1c"`
+	ManufacturerSKU string `json:"manufacturer_sku"`
+	Brand           string `json:"brand"`
+}
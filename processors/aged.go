@@ -0,0 +1,292 @@
+package processors
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"sending-stocks/models"
+)
+
+// Действия с залежалым товаром в отчетах производителей
+const (
+	AgedInclude = "include" // передавать как обычно
+	AgedExclude = "exclude" // не передавать производителю
+	AgedFlag    = "flag"    // передавать с отметкой (в Excel отчетах)
+)
+
+// BrandAgedPolicy действие с залежалым товаром для бренда
+type BrandAgedPolicy struct {
+	Brand  string
+	Action string
+}
+
+// AgedStockProcessor определяет залежалый товар и формирует отчет по нему
+type AgedStockProcessor struct {
+	MinAgeYears   int // товар старше указанного числа лет считается залежалым
+	DefaultAction string
+	BrandPolicies []BrandAgedPolicy
+	Clock         models.Clock // часы для расчета возраста и имени файла
+}
+
+// NewAgedStockProcessor создает процессор залежалого товара
+func NewAgedStockProcessor(minAgeYears int, defaultAction string, brandPolicies []BrandAgedPolicy, clock models.Clock) (*AgedStockProcessor, error) {
+	if defaultAction == "" {
+		defaultAction = AgedInclude
+	}
+	if !isAgedAction(defaultAction) {
+		return nil, fmt.Errorf("неизвестное действие для залежалого товара %q", defaultAction)
+	}
+	for _, bp := range brandPolicies {
+		if !isAgedAction(bp.Action) {
+			return nil, fmt.Errorf("неизвестное действие %q для бренда %s", bp.Action, bp.Brand)
+		}
+	}
+
+	return &AgedStockProcessor{
+		MinAgeYears:   minAgeYears,
+		DefaultAction: defaultAction,
+		BrandPolicies: brandPolicies,
+		Clock:         clock,
+	}, nil
+}
+
+// ParseBrandAgedPolicies разбирает строку вида "Pirelli:exclude,Hankook:flag"
+func ParseBrandAgedPolicies(s string) ([]BrandAgedPolicy, error) {
+	result := make([]BrandAgedPolicy, 0)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		brand, action, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("неверный формат %q, ожидается Бренд:действие", part)
+		}
+		result = append(result, BrandAgedPolicy{
+			Brand:  strings.TrimSpace(brand),
+			Action: strings.TrimSpace(action),
+		})
+	}
+	return result, nil
+}
+
+func isAgedAction(action string) bool {
+	switch action {
+	case AgedInclude, AgedExclude, AgedFlag:
+		return true
+	}
+	return false
+}
+
+// ActionFor возвращает действие для бренда
+func (p *AgedStockProcessor) ActionFor(brand string) string {
+	for _, bp := range p.BrandPolicies {
+		if matchesBrand(brand, []string{bp.Brand}) {
+			return bp.Action
+		}
+	}
+	return p.DefaultAction
+}
+
+// isAged проверяет, является ли позиция залежалой
+func (p *AgedStockProcessor) isAged(item models.StockItem, now time.Time) bool {
+	if item.IsYearOld {
+		return true
+	}
+	if item.ProductionYear == 0 || p.MinAgeYears <= 0 {
+		return false
+	}
+	return now.Year()-item.ProductionYear >= p.MinAgeYears
+}
+
+// Mark отмечает залежалые позиции (поле IsAged)
+func (p *AgedStockProcessor) Mark(items []models.StockItem) {
+	now := p.Clock.Now()
+	for i := range items {
+		items[i].IsAged = p.isAged(items[i], now)
+	}
+}
+
+// Apply применяет политику бренда к позициям отчета производителя:
+// исключает или отмечает залежалый товар
+func (p *AgedStockProcessor) Apply(items []models.StockItem) []models.StockItem {
+	if p == nil {
+		return items
+	}
+
+	result := make([]models.StockItem, 0, len(items))
+	for _, item := range items {
+		if item.IsAged {
+			switch p.ActionFor(item.CleanBrand) {
+			case AgedExclude:
+				continue
+			case AgedFlag:
+				item.AgedFlag = true
+			}
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+// ExclusionReason возвращает причину исключения залежалой позиции из отчетов производителя
+func (p *AgedStockProcessor) ExclusionReason(item models.StockItem) string {
+	if !item.IsAged || p.ActionFor(item.CleanBrand) != AgedExclude {
+		return ""
+	}
+	if label := AgedLabel(item); label != "" && label != "год" {
+		return fmt.Sprintf("залежалый товар (%s), исключен из отчетов", label)
+	}
+	return "залежалый товар, исключен из отчетов"
+}
+
+// AgedLabel подпись года выпуска для отчетов ("2021", "DOT 1221", "год")
+func AgedLabel(item models.StockItem) string {
+	switch {
+	case item.DOTWeek > 0:
+		return fmt.Sprintf("DOT %02d%02d", item.DOTWeek, item.ProductionYear%100)
+	case item.ProductionYear > 0:
+		return fmt.Sprintf("%d", item.ProductionYear)
+	case item.IsYearOld:
+		return "год"
+	}
+	return ""
+}
+
+// CreateReport создает внутренний отчет по залежалому товару, сгруппированный по бренду и году
+func (p *AgedStockProcessor) CreateReport(items []models.StockItem) (*excelize.File, error) {
+	f := excelize.NewFile()
+
+	const sheet = "Aged Stock"
+
+	// Создаем лист
+	index, _ := f.NewSheet(sheet)
+	f.SetActiveSheet(index)
+
+	// Удаляем лист по умолчанию
+	f.DeleteSheet("Sheet1")
+
+	// Заголовки
+	headers := []string{
+		"Бренд", "Год выпуска", "DOT", "Код 1С", "Код производителя", "Наименование", "Типоразмер", "Остаток", "Действие в отчете",
+	}
+	for i, header := range headers {
+		col := string(rune('A' + i))
+		f.SetCellValue(sheet, fmt.Sprintf("%s1", col), header)
+	}
+
+	// Отбираем залежалые позиции с остатком
+	aged := make([]models.StockItem, 0)
+	for _, item := range items {
+		if item.IsAged && item.Quantity > 0 {
+			aged = append(aged, item)
+		}
+	}
+
+	// Сортируем по бренду, затем по году
+	sort.SliceStable(aged, func(i, j int) bool {
+		if aged[i].CleanBrand != aged[j].CleanBrand {
+			return aged[i].CleanBrand < aged[j].CleanBrand
+		}
+		return aged[i].ProductionYear < aged[j].ProductionYear
+	})
+
+	subtotalStyle, _ := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{
+			Bold: true,
+		},
+		Fill: excelize.Fill{
+			Type:    "pattern",
+			Color:   []string{"#F2F2F2"},
+			Pattern: 1,
+		},
+	})
+
+	actionNames := map[string]string{
+		AgedInclude: "передается",
+		AgedExclude: "исключается",
+		AgedFlag:    "передается с отметкой",
+	}
+
+	// Заполняем данные с промежуточными итогами по группам бренд+год
+	row := 2
+	grandTotal := 0
+	for start := 0; start < len(aged); {
+		end := start
+		for end < len(aged) && aged[end].CleanBrand == aged[start].CleanBrand &&
+			aged[end].ProductionYear == aged[start].ProductionYear {
+			end++
+		}
+
+		firstRow := row
+		for _, item := range aged[start:end] {
+			f.SetCellValue(sheet, fmt.Sprintf("A%d", row), item.CleanBrand)
+			if item.ProductionYear > 0 {
+				f.SetCellValue(sheet, fmt.Sprintf("B%d", row), item.ProductionYear)
+			} else {
+				f.SetCellValue(sheet, fmt.Sprintf("B%d", row), "не указан")
+			}
+			if item.DOTWeek > 0 {
+				f.SetCellValue(sheet, fmt.Sprintf("C%d", row), AgedLabel(item))
+			}
+			f.SetCellValue(sheet, fmt.Sprintf("D%d", row), item.Code1C)
+			f.SetCellValue(sheet, fmt.Sprintf("E%d", row), item.ManufacturerSKU)
+			f.SetCellValue(sheet, fmt.Sprintf("F%d", row), item.Name)
+			f.SetCellValue(sheet, fmt.Sprintf("G%d", row), item.TireSize)
+			f.SetCellValue(sheet, fmt.Sprintf("H%d", row), item.Quantity)
+			f.SetCellValue(sheet, fmt.Sprintf("I%d", row), actionNames[p.ActionFor(item.CleanBrand)])
+			grandTotal += item.Quantity
+			row++
+		}
+
+		// Итог по группе
+		year := "не указан"
+		if aged[start].ProductionYear > 0 {
+			year = fmt.Sprintf("%d", aged[start].ProductionYear)
+		}
+		f.SetCellValue(sheet, fmt.Sprintf("A%d", row), fmt.Sprintf("Итого %s, %s", aged[start].CleanBrand, year))
+		f.SetCellFormula(sheet, fmt.Sprintf("H%d", row), fmt.Sprintf("=SUM(H%d:H%d)", firstRow, row-1))
+		f.SetCellStyle(sheet, fmt.Sprintf("A%d", row), fmt.Sprintf("I%d", row), subtotalStyle)
+		row++
+
+		start = end
+	}
+
+	// Общий итог
+	f.SetCellValue(sheet, fmt.Sprintf("A%d", row), "ИТОГО")
+	f.SetCellValue(sheet, fmt.Sprintf("H%d", row), grandTotal)
+	f.SetCellStyle(sheet, fmt.Sprintf("A%d", row), fmt.Sprintf("I%d", row), subtotalStyle)
+
+	// Стили для заголовков
+	headerStyle, _ := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{
+			Bold: true,
+			Size: 12,
+		},
+		Fill: excelize.Fill{
+			Type:    "pattern",
+			Color:   []string{"#E0E0E0"},
+			Pattern: 1,
+		},
+	})
+	f.SetCellStyle(sheet, "A1", "I1", headerStyle)
+
+	// Устанавливаем ширину колонок
+	colWidths := map[string]float64{
+		"A": 20, "B": 12, "C": 12, "D": 12, "E": 18, "F": 50, "G": 15, "H": 10, "I": 22,
+	}
+	for col, width := range colWidths {
+		f.SetColWidth(sheet, col, col, width)
+	}
+
+	return f, nil
+}
+
+// GenerateFilename генерирует имя файла
+func (p *AgedStockProcessor) GenerateFilename() string {
+	return fmt.Sprintf("Aged_Stock_Report_%s.xlsx", p.Clock.Now().Format("20060102_150405"))
+}
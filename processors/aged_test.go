@@ -0,0 +1,40 @@
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"sending-stocks/models"
+)
+
+func TestAgedStockProcessorMarkYearBoundary(t *testing.T) {
+	msk := time.FixedZone("MSK", 3*60*60)
+
+	tests := []struct {
+		name string
+		now  time.Time
+		item models.StockItem
+		aged bool
+	}{
+		{"последний день года", time.Date(2026, 12, 31, 23, 59, 0, 0, msk), models.StockItem{ProductionYear: 2025}, false},
+		{"первый день года", time.Date(2027, 1, 1, 0, 0, 0, 0, msk), models.StockItem{ProductionYear: 2025}, true},
+		// В UTC еще 31 декабря, но год считается по часам бизнеса
+		{"новый год по Москве", time.Date(2027, 1, 1, 0, 30, 0, 0, msk), models.StockItem{ProductionYear: 2025}, true},
+		{"год выпуска неизвестен", time.Date(2027, 1, 1, 0, 0, 0, 0, msk), models.StockItem{}, false},
+		{"метка год в названии", time.Date(2026, 6, 1, 0, 0, 0, 0, msk), models.StockItem{IsYearOld: true}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewAgedStockProcessor(2, AgedInclude, nil, models.FixedClock{Time: tt.now})
+			if err != nil {
+				t.Fatal(err)
+			}
+			items := []models.StockItem{tt.item}
+			p.Mark(items)
+			if items[0].IsAged != tt.aged {
+				t.Errorf("IsAged = %v, ожидалось %v", items[0].IsAged, tt.aged)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package processors
+
+import (
+	"fmt"
+
+	"github.com/xuri/excelize/v2"
+
+	"sending-stocks/models"
+)
+
+// Ключи объединения позиций из нескольких файлов
+const (
+	CombineByCode1C = "code_1c" // по коду 1С (если его нет - по коду производителя)
+	CombineBySKU    = "sku"     // по коду производителя (если его нет - по коду 1С)
+	CombineNone     = "none"    // не объединять, просто сложить списки позиций
+)
+
+// CombineInput исходный файл для объединения
+type CombineInput struct {
+	Source string         // имя загруженного файла у пользователя
+	File   *excelize.File // открытая книга
+	Sheets []string       // листы для обработки (пусто - первый лист)
+}
+
+// StockCombiner собирает ведомости нескольких филиалов в один снимок остатков
+type StockCombiner struct {
+	Parser *StockParser
+	Key    string
+}
+
+// NewStockCombiner создает объединитель ведомостей
+func NewStockCombiner(parser *StockParser, key string) (*StockCombiner, error) {
+	if key == "" {
+		key = CombineByCode1C
+	}
+	switch key {
+	case CombineByCode1C, CombineBySKU, CombineNone:
+	default:
+		return nil, fmt.Errorf("неизвестный ключ объединения %q", key)
+	}
+
+	return &StockCombiner{
+		Parser: parser,
+		Key:    key,
+	}, nil
+}
+
+// combineKey ключ позиции для объединения
+func (c *StockCombiner) combineKey(item models.StockItem) string {
+	switch c.Key {
+	case CombineBySKU:
+		return duplicateKey(item)
+	case CombineByCode1C:
+		if item.Code1C != "" {
+			return "1c:" + item.Code1C
+		}
+		if item.ManufacturerSKU != "" {
+			return "sku:" + item.ManufacturerSKU
+		}
+	}
+	return ""
+}
+
+// Combine парсит каждый файл и объединяет позиции в один результат обработки.
+// У каждой позиции заполнен список источников остатка (Sources)
+func (c *StockCombiner) Combine(inputs []CombineInput) (*models.ProcessedFile, error) {
+	if len(inputs) < 2 {
+		return nil, fmt.Errorf("для объединения нужно минимум два файла")
+	}
+
+	result := c.Parser.newProcessedFile()
+	result.SourceFiles = make([]string, 0, len(inputs))
+	result.Sheets = make([]string, 0)
+
+	seenSheets := make(map[string]bool)
+	items := make([]models.StockItem, 0)
+	duplicateFindings := make([]models.ValidationFinding, 0)
+
+	for _, input := range inputs {
+		var (
+			parsed *models.ProcessedFile
+			err    error
+		)
+		if len(input.Sheets) > 0 {
+			parsed, err = c.Parser.ParseSheets(input.File, input.Sheets)
+		} else {
+			parsed, err = c.Parser.Parse(input.File)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("файл %s: %v", input.Source, err)
+		}
+
+		result.SourceFiles = append(result.SourceFiles, input.Source)
+
+		// Дата снимка - самая поздняя из дат ведомостей; расхождение дат показываем предупреждением
+		if parsed.ReportDate != "" {
+			if result.ReportDate != "" && result.ReportDate != parsed.ReportDate {
+				result.Stats.Warnings = append(result.Stats.Warnings,
+					fmt.Sprintf("%s: ведомость на %s, предыдущие файлы на %s", input.Source, parsed.ReportDate, result.ReportDate))
+			}
+			if parsed.ReportDate > result.ReportDate {
+				result.ReportDate = parsed.ReportDate
+			}
+		}
+		if result.Organization == "" {
+			result.Organization = parsed.Organization
+		}
+		for _, sheet := range parsed.Sheets {
+			if !seenSheets[sheet] {
+				seenSheets[sheet] = true
+				result.Sheets = append(result.Sheets, sheet)
+			}
+		}
+
+		for _, item := range parsed.AllItems {
+			item.Source = input.Source
+			for i := range item.Sources {
+				item.Sources[i].Source = input.Source
+			}
+			items = append(items, item)
+		}
+		for _, issue := range parsed.ParseIssues {
+			issue.Source = input.Source
+			result.ParseIssues = append(result.ParseIssues, issue)
+		}
+		for _, merge := range parsed.Merges {
+			merge.Source = input.Source
+			result.Merges = append(result.Merges, merge)
+		}
+		// Правила валидации проверяются заново по итоговым позициям, переносим только дубликаты
+		for _, finding := range parsed.Findings {
+			if finding.RuleID == DuplicateRuleID {
+				finding.Source = input.Source
+				duplicateFindings = append(duplicateFindings, finding)
+			}
+		}
+
+		result.Stats.TotalRows += parsed.Stats.TotalRows
+		result.Stats.ValidRows += parsed.Stats.ValidRows
+		result.Stats.InvalidRows += parsed.Stats.InvalidRows
+		result.Stats.DuplicateRows += parsed.Stats.DuplicateRows
+		for _, e := range parsed.Stats.Errors {
+			result.Stats.Errors = append(result.Stats.Errors, fmt.Sprintf("%s: %s", input.Source, e))
+		}
+		for _, w := range parsed.Stats.Warnings {
+			result.Stats.Warnings = append(result.Stats.Warnings, fmt.Sprintf("%s: %s", input.Source, w))
+		}
+	}
+
+	result.AllItems = c.aggregate(items)
+	result.Stats.CombinedRows = len(items) - len(result.AllItems)
+
+	c.Parser.finish(result, duplicateFindings)
+
+	return result, nil
+}
+
+// aggregate суммирует остатки позиций с одинаковым ключом, сохраняя порядок первых вхождений
+func (c *StockCombiner) aggregate(items []models.StockItem) []models.StockItem {
+	result := make([]models.StockItem, 0, len(items))
+	index := make(map[string]int)
+
+	for _, item := range items {
+		// Позиция со сложенными дубликатами уже собрана из нескольких строк
+		sources := item.Sources
+		if len(sources) == 0 {
+			sources = []models.StockSource{stockSource(item)}
+		}
+
+		key := c.combineKey(item)
+		if key != "" {
+			if idx, ok := index[key]; ok {
+				combined := &result[idx]
+				combined.Quantity += item.Quantity
+				combined.RawQuantity += item.RawQuantity
+				if combined.Price == 0 {
+					combined.Price = item.Price
+				}
+				combined.Warnings = append(combined.Warnings, item.Warnings...)
+				combined.Sources = append(combined.Sources, sources...)
+				continue
+			}
+			index[key] = len(result)
+		}
+
+		item.Sources = sources
+		result = append(result, item)
+	}
+
+	return result
+}
+
+// stockSource строка исходного файла, из которой взят остаток позиции
+func stockSource(item models.StockItem) models.StockSource {
+	return models.StockSource{
+		Source:   item.Source,
+		Sheet:    item.Sheet,
+		RowNum:   item.RowNum,
+		Quantity: item.Quantity,
+		Price:    item.Price,
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/base64"
 	"encoding/csv"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,12 +16,16 @@ import (
 // CordiantProcessor обработчик для брендов Cordiant
 type CordiantProcessor struct {
 	CordiantBrands []string
+	GraceDays      int // в первые GraceDays дней месяца отчитываемся за предыдущий месяц
+	Clock          models.Clock
 }
 
 // NewCordiantProcessor создает новый процессор
-func NewCordiantProcessor(cordiantBrands []string) *CordiantProcessor {
+func NewCordiantProcessor(cordiantBrands []string, graceDays int, clock models.Clock) *CordiantProcessor {
 	return &CordiantProcessor{
 		CordiantBrands: cordiantBrands,
+		GraceDays:      graceDays,
+		Clock:          clock,
 	}
 }
 
@@ -52,6 +57,8 @@ func (p *CordiantProcessor) FilterItems(items []models.StockItem) []models.Cordi
 		}
 
 		cordiantItem := models.CordiantItem{
+			Source:     item.Source,
+			Sheet:      item.Sheet,
 			RowNum:     item.RowNum,
 			Code:       item.ManufacturerSKU, // Используем ManufacturerSKU как код
 			TireSize:   item.TireSize,
@@ -66,6 +73,20 @@ func (p *CordiantProcessor) FilterItems(items []models.StockItem) []models.Cordi
 	return result
 }
 
+// ExclusionReason возвращает причину, по которой позиция Cordiant не попадет в отчет
+func (p *CordiantProcessor) ExclusionReason(item models.StockItem) string {
+	if !p.isCordiantBrand(item.CleanBrand) {
+		return ""
+	}
+	if item.Quantity <= 0 {
+		return "нет остатка"
+	}
+	if item.ManufacturerSKU == "" {
+		return "нет кода производителя"
+	}
+	return ""
+}
+
 // CreateCSV создает CSV для отправки в Cordiant (формат как в примере)
 func (p *CordiantProcessor) CreateCSV(items []models.CordiantItem) ([]byte, error) {
 	// Используем буфер для накопления данных
@@ -77,13 +98,7 @@ func (p *CordiantProcessor) CreateCSV(items []models.CordiantItem) ([]byte, erro
 
 	// Записываем данные
 	for _, item := range items {
-		row := []string{
-			item.Code,
-			item.TireSize,
-			item.Brand, // Теперь здесь наименование, а не бренд
-			fmt.Sprintf("%d", item.Quantity),
-		}
-		if err := writer.Write(row); err != nil {
+		if err := writer.Write(cordiantRecord(item)); err != nil {
 			return nil, fmt.Errorf("ошибка записи строки: %v", err)
 		}
 	}
@@ -96,6 +111,37 @@ func (p *CordiantProcessor) CreateCSV(items []models.CordiantItem) ([]byte, erro
 	return []byte(buf.String()), nil
 }
 
+// cordiantRecord строка CSV Cordiant для позиции
+func cordiantRecord(item models.CordiantItem) []string {
+	return []string{
+		item.Code,
+		item.TireSize,
+		item.Brand, // Теперь здесь наименование, а не бренд
+		fmt.Sprintf("%d", item.Quantity),
+	}
+}
+
+// CSVLines возвращает соответствие номера строки CSV (с 1, как в errorFileStrings) индексу позиции.
+// Наименование с переводом строки занимает в файле несколько строк - учитываются все
+func (p *CordiantProcessor) CSVLines(items []models.CordiantItem) map[int]int {
+	lines := make(map[int]int, len(items))
+	line := 1
+	for i, item := range items {
+		var buf strings.Builder
+		writer := csv.NewWriter(&buf)
+		writer.Comma = ';'
+		writer.Write(cordiantRecord(item))
+		writer.Flush()
+
+		height := strings.Count(buf.String(), "\n")
+		for j := 0; j < height; j++ {
+			lines[line+j] = i
+		}
+		line += height
+	}
+	return lines
+}
+
 // CreateCSVWithEncoding создает CSV в указанной кодировке (Windows-1251 для совместимости)
 func (p *CordiantProcessor) CreateCSVWithEncoding(items []models.CordiantItem, encoding string) ([]byte, error) {
 	// Сначала создаем UTF-8 CSV
@@ -127,15 +173,54 @@ func (p *CordiantProcessor) PrepareBase64File(items []models.CordiantItem) (stri
 	return base64.StdEncoding.EncodeToString(csvData), nil
 }
 
-// GetCurrentYearMonth возвращает текущий год и месяц
+// GetCurrentYearMonth возвращает текущий год и месяц в часовом поясе бизнеса
 func (p *CordiantProcessor) GetCurrentYearMonth() (string, string) {
-	now := time.Now()
-	year := now.Format("2006")
-	month := now.Format("1") // без ведущего нуля
+	return p.YearMonth(p.Clock.Now())
+}
+
+// YearMonth возвращает год и месяц отчетного периода для даты остатков
+func (p *CordiantProcessor) YearMonth(reportDate time.Time) (string, string) {
+	year := reportDate.Format("2006")
+	month := reportDate.Format("1") // без ведущего нуля
 	return year, month
 }
 
-// GenerateFilename генерирует имя файла
-func (p *CordiantProcessor) GenerateFilename() string {
-	return fmt.Sprintf("Cordiant_Report_%s.csv", time.Now().Format("20060102_150405"))
+// SuggestPeriod предлагает отчетный период для даты остатков: в первые GraceDays дней месяца
+// остатки отправляются за предыдущий (закрываемый) месяц, иначе - за месяц даты остатков
+func (p *CordiantProcessor) SuggestPeriod(stockDate time.Time) (string, string) {
+	if stockDate.Day() <= p.GraceDays {
+		stockDate = time.Date(stockDate.Year(), stockDate.Month(), 1, 0, 0, 0, 0, stockDate.Location()).AddDate(0, -1, 0)
+	}
+	return p.YearMonth(stockDate)
+}
+
+// ValidatePeriod проверяет год и месяц отчетного периода; период позже текущего месяца не допускается
+func (p *CordiantProcessor) ValidatePeriod(year, month string) error {
+	y, err := strconv.Atoi(year)
+	if err != nil || y < 2000 {
+		return fmt.Errorf("неверный год %q", year)
+	}
+	m, err := strconv.Atoi(month)
+	if err != nil || m < 1 || m > 12 {
+		return fmt.Errorf("неверный месяц %q", month)
+	}
+
+	currentYear, currentMonth := p.GetCurrentYearMonth()
+	cy, _ := strconv.Atoi(currentYear)
+	cm, _ := strconv.Atoi(currentMonth)
+	if y*12+m > cy*12+cm {
+		return fmt.Errorf("период %02d.%d еще не наступил (текущий период %02d.%d)", m, y, cm, cy)
+	}
+	return nil
+}
+
+// PeriodKey ключ отчетного периода для журнала отправок ("2026-10")
+func (p *CordiantProcessor) PeriodKey(year, month string) string {
+	m, _ := strconv.Atoi(month)
+	return fmt.Sprintf("%s-%02d", year, m)
+}
+
+// GenerateFilename генерирует имя файла для отчета на дату остатков
+func (p *CordiantProcessor) GenerateFilename(reportDate time.Time) string {
+	return fmt.Sprintf("Cordiant_Report_%s.csv", reportDate.Format("20060102"))
 }
@@ -0,0 +1,125 @@
+package processors
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"sending-stocks/models"
+)
+
+// "Строка 12: ...", "строке №12", "стр. 12"
+var cordiantWarningLinePattern = regexp.MustCompile(`(?i)(?:строк[аеиу]?|стр\.)\s*№?\s*(\d+)`)
+
+// RejectedItems сопоставляет номера отклоненных строк CSV (errorFileStrings) позициям отчета.
+// Замечание берется из предупреждения, в котором упомянут номер строки; если номера в
+// предупреждениях не указаны, но их столько же, сколько строк, - по порядку
+func (p *CordiantProcessor) RejectedItems(items []models.CordiantItem, errorLines []int, warnings []string) []models.CordiantRejectedItem {
+	result := make([]models.CordiantRejectedItem, 0, len(errorLines))
+	if len(errorLines) == 0 {
+		return result
+	}
+
+	lineWarnings := make(map[int]string)
+	for _, warning := range warnings {
+		if m := cordiantWarningLinePattern.FindStringSubmatch(warning); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			if _, ok := lineWarnings[line]; !ok {
+				lineWarnings[line] = warning
+			}
+		}
+	}
+	byOrder := len(lineWarnings) == 0 && len(warnings) == len(errorLines)
+
+	lines := p.CSVLines(items)
+	for i, line := range errorLines {
+		rejected := models.CordiantRejectedItem{
+			Line:    line,
+			Warning: lineWarnings[line],
+		}
+		if byOrder {
+			rejected.Warning = warnings[i]
+		}
+
+		if idx, ok := lines[line]; ok {
+			item := items[idx]
+			rejected.Source = item.Source
+			rejected.Sheet = item.Sheet
+			rejected.RowNum = item.RowNum
+			rejected.Code = item.Code
+			rejected.TireSize = item.TireSize
+			rejected.Name = item.Brand
+			rejected.Quantity = item.Quantity
+		} else if rejected.Warning == "" {
+			rejected.Warning = fmt.Sprintf("строки %d нет в отправленном файле", line)
+		}
+
+		result = append(result, rejected)
+	}
+
+	return result
+}
+
+// CreateRejectedReport формирует Excel со строками, отклоненными Cordiant, для исправления в 1С
+func (p *CordiantProcessor) CreateRejectedReport(rejected []models.CordiantRejectedItem) (*excelize.File, error) {
+	f := excelize.NewFile()
+
+	const sheet = "Отклонено Cordiant"
+
+	index, _ := f.NewSheet(sheet)
+	f.SetActiveSheet(index)
+	f.DeleteSheet("Sheet1")
+
+	headers := []string{
+		"Строка CSV", "Файл", "Лист", "Строка 1С", "Код", "Типоразмер", "Наименование", "Остаток", "Замечание Cordiant",
+	}
+	for i, header := range headers {
+		col := string(rune('A' + i))
+		f.SetCellValue(sheet, fmt.Sprintf("%s1", col), header)
+	}
+
+	for i, item := range rejected {
+		row := i + 2
+		f.SetCellValue(sheet, fmt.Sprintf("A%d", row), item.Line)
+		f.SetCellValue(sheet, fmt.Sprintf("B%d", row), item.Source)
+		f.SetCellValue(sheet, fmt.Sprintf("C%d", row), item.Sheet)
+		if item.RowNum > 0 {
+			f.SetCellValue(sheet, fmt.Sprintf("D%d", row), item.RowNum)
+		}
+		f.SetCellValue(sheet, fmt.Sprintf("E%d", row), item.Code)
+		f.SetCellValue(sheet, fmt.Sprintf("F%d", row), item.TireSize)
+		f.SetCellValue(sheet, fmt.Sprintf("G%d", row), item.Name)
+		f.SetCellValue(sheet, fmt.Sprintf("H%d", row), item.Quantity)
+		f.SetCellValue(sheet, fmt.Sprintf("I%d", row), item.Warning)
+	}
+
+	headerStyle, _ := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{
+			Bold: true,
+			Size: 12,
+		},
+		Fill: excelize.Fill{
+			Type:    "pattern",
+			Color:   []string{"#E0E0E0"},
+			Pattern: 1,
+		},
+	})
+	f.SetCellStyle(sheet, "A1", "I1", headerStyle)
+
+	colWidths := map[string]float64{
+		"A": 12, "B": 20, "C": 15, "D": 11, "E": 15, "F": 15, "G": 50, "H": 10, "I": 60,
+	}
+	for col, width := range colWidths {
+		f.SetColWidth(sheet, col, col, width)
+	}
+
+	return f, nil
+}
+
+// GenerateRejectedFilename имя файла отклоненных строк на дату остатков
+func (p *CordiantProcessor) GenerateRejectedFilename(reportDate time.Time) string {
+	return fmt.Sprintf("Cordiant_Rejected_%s.xlsx", reportDate.Format("20060102"))
+}
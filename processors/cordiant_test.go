@@ -0,0 +1,33 @@
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"sending-stocks/models"
+)
+
+func TestCordiantProcessorSuggestPeriod(t *testing.T) {
+	msk := time.FixedZone("MSK", 3*60*60)
+	p := NewCordiantProcessor(nil, 5, models.FixedClock{Time: time.Date(2027, 1, 10, 12, 0, 0, 0, msk)})
+
+	tests := []struct {
+		stockDate   time.Time
+		year, month string
+	}{
+		{time.Date(2027, 1, 1, 0, 0, 0, 0, msk), "2026", "12"},
+		{time.Date(2027, 1, 5, 23, 59, 0, 0, msk), "2026", "12"},
+		{time.Date(2027, 1, 6, 0, 0, 0, 0, msk), "2027", "1"},
+		{time.Date(2026, 3, 1, 0, 0, 0, 0, msk), "2026", "2"},
+		{time.Date(2026, 3, 31, 0, 0, 0, 0, msk), "2026", "3"},
+		{time.Date(2026, 12, 31, 0, 0, 0, 0, msk), "2026", "12"},
+	}
+
+	for _, tt := range tests {
+		year, month := p.SuggestPeriod(tt.stockDate)
+		if year != tt.year || month != tt.month {
+			t.Errorf("SuggestPeriod(%s) = %s-%s, ожидалось %s-%s",
+				tt.stockDate.Format("2006-01-02"), year, month, tt.year, tt.month)
+		}
+	}
+}
@@ -0,0 +1,481 @@
+package processors
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/xuri/excelize/v2"
+
+	"sending-stocks/models"
+)
+
+// Форматы пользовательских отчетов
+const (
+	CustomFormatCSV  = "csv"
+	CustomFormatXLSX = "xlsx"
+)
+
+// customFieldCaptions заголовки колонок пользовательского отчета по полям позиции
+var customFieldCaptions = map[string]string{
+	"name":                 "Наименование",
+	"characteristic":       "Характеристика",
+	"brand":                "Бренд (1С)",
+	"clean_brand":          "Бренд",
+	"season":               "Сезон",
+	"code_1c":              "Код 1С",
+	"manufacturer_sku":     "Код производителя",
+	"raw_manufacturer_sku": "Код производителя (1С)",
+	"tire_size":            "Типоразмер",
+	"rim":                  "Диаметр",
+	"quantity":             "Остаток",
+	"raw_quantity":         "Остаток (1С)",
+	"price":                "Цена",
+	"production_year":      "Год выпуска",
+	"source":               "Файл",
+	"sheet":                "Лист",
+	"row_num":              "Строка",
+}
+
+// customNumericFields поля, которые сравниваются и выводятся как числа
+var customNumericFields = map[string]bool{
+	"quantity": true, "raw_quantity": true, "price": true, "row_num": true, "production_year": true,
+}
+
+// customSumFields поля, суммируемые в строках «Итого»
+var customSumFields = map[string]bool{
+	"quantity": true, "raw_quantity": true,
+}
+
+// defaultCustomColumns колонки отчета, если они не выбраны
+var defaultCustomColumns = []string{"code_1c", "manufacturer_sku", "clean_brand", "name", "tire_size", "season", "quantity", "price"}
+
+// customFilterOps допустимые условия отбора
+var customFilterOps = map[string]bool{
+	"eq": true, "ne": true, "contains": true, "in": true, "gt": true, "gte": true, "lt": true, "lte": true,
+	"regex": true, "empty": true, "not_empty": true,
+}
+
+// ValidateCustomReport проверяет определение отчета и подставляет значения по умолчанию
+func ValidateCustomReport(def *models.CustomReport) error {
+	def.Name = strings.TrimSpace(def.Name)
+	if def.Name == "" {
+		return fmt.Errorf("не указано название отчета")
+	}
+
+	if def.Format == "" {
+		def.Format = CustomFormatXLSX
+	}
+	if def.Format != CustomFormatCSV && def.Format != CustomFormatXLSX {
+		return fmt.Errorf("неизвестный формат %q (csv или xlsx)", def.Format)
+	}
+
+	known := func(field string) bool {
+		_, ok := stockItemField(models.StockItem{}, field)
+		return ok
+	}
+
+	for i, filter := range def.Filters {
+		if !known(filter.Field) {
+			return fmt.Errorf("условие %d: неизвестное поле %q", i+1, filter.Field)
+		}
+		if !customFilterOps[filter.Op] {
+			return fmt.Errorf("условие %d: неизвестная операция %q", i+1, filter.Op)
+		}
+		switch filter.Op {
+		case "in":
+			if len(filter.Values) == 0 {
+				return fmt.Errorf("условие %d: для in нужен список values", i+1)
+			}
+		case "gt", "gte", "lt", "lte":
+			if (customNumericFields[filter.Field] || filter.Field == "rim") && !isCustomNumber(filter.Field, filter.Value) {
+				return fmt.Errorf("условие %d: значение %q не является числом", i+1, filter.Value)
+			}
+		case "regex":
+			if _, err := regexp.Compile(filter.Value); err != nil {
+				return fmt.Errorf("условие %d: неверное регулярное выражение: %v", i+1, err)
+			}
+		}
+	}
+
+	for _, field := range def.Columns {
+		if !known(field) {
+			return fmt.Errorf("неизвестная колонка %q", field)
+		}
+	}
+	for _, s := range def.Sort {
+		if !known(s.Field) {
+			return fmt.Errorf("неизвестное поле сортировки %q", s.Field)
+		}
+	}
+	for _, field := range def.GroupBy {
+		if !known(field) {
+			return fmt.Errorf("неизвестное поле группировки %q", field)
+		}
+	}
+	return nil
+}
+
+// customNumber числовое значение поля (диаметр R17.5 - как 17.5)
+func customNumber(field, value string) (float64, bool) {
+	if field == "rim" {
+		value = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(value)), "R")
+	}
+	n, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(value), ",", ".", 1), 64)
+	return n, err == nil
+}
+
+// isCustomNumber проверяет, что значение можно сравнивать как число
+func isCustomNumber(field, value string) bool {
+	_, ok := customNumber(field, value)
+	return ok
+}
+
+// compareCustom сравнивает значения поля: числа и диаметры - по величине, строки - без учета регистра
+func compareCustom(field, a, b string) int {
+	if customNumericFields[field] || field == "rim" {
+		x, okA := customNumber(field, a)
+		y, okB := customNumber(field, b)
+		switch {
+		case okA && okB:
+			if x < y {
+				return -1
+			}
+			if x > y {
+				return 1
+			}
+			return 0
+		case okA:
+			return -1 // пустые и нечисловые значения - в конце
+		case okB:
+			return 1
+		}
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+// matchCustomFilter проверяет позицию по условию отбора
+func matchCustomFilter(item models.StockItem, filter models.CustomFilter) bool {
+	value, _ := stockItemField(item, filter.Field)
+	switch filter.Op {
+	case "eq":
+		return compareCustom(filter.Field, value, filter.Value) == 0
+	case "ne":
+		return compareCustom(filter.Field, value, filter.Value) != 0
+	case "contains":
+		return strings.Contains(strings.ToLower(value), strings.ToLower(filter.Value))
+	case "in":
+		for _, v := range filter.Values {
+			if compareCustom(filter.Field, value, v) == 0 {
+				return true
+			}
+		}
+		return false
+	case "gt", "gte", "lt", "lte":
+		if (customNumericFields[filter.Field] || filter.Field == "rim") && !isCustomNumber(filter.Field, value) {
+			return false
+		}
+		c := compareCustom(filter.Field, value, filter.Value)
+		switch filter.Op {
+		case "gt":
+			return c > 0
+		case "gte":
+			return c >= 0
+		case "lt":
+			return c < 0
+		}
+		return c <= 0
+	case "regex":
+		re, err := regexp.Compile(filter.Value)
+		return err == nil && re.MatchString(value)
+	case "empty":
+		return strings.TrimSpace(value) == ""
+	case "not_empty":
+		return strings.TrimSpace(value) != ""
+	}
+	return false
+}
+
+// CustomReportRow строка пользовательского отчета
+type CustomReportRow struct {
+	Values   []string `json:"values"`
+	Subtotal bool     `json:"subtotal,omitempty"` // строка «Итого» группы или всего отчета
+}
+
+// CustomReportTable результат выполнения пользовательского отчета
+type CustomReportTable struct {
+	Name    string            `json:"name"`
+	Fields  []string          `json:"fields"`
+	Headers []string          `json:"headers"`
+	Rows    []CustomReportRow `json:"rows"`
+	Count   int               `json:"count"` // позиций после отбора
+	Total   int               `json:"total"` // сумма остатков отобранных позиций
+
+	Items []models.StockItem `json:"-"` // отобранные позиции (для блокировки по ошибкам валидации)
+}
+
+// BuildCustomReport отбирает, сортирует и группирует позиции по определению отчета
+func BuildCustomReport(def models.CustomReport, items []models.StockItem) (*CustomReportTable, error) {
+	if err := ValidateCustomReport(&def); err != nil {
+		return nil, err
+	}
+
+	fields := def.Columns
+	if len(fields) == 0 {
+		fields = defaultCustomColumns
+	}
+	table := &CustomReportTable{Name: def.Name, Fields: fields}
+	for _, field := range fields {
+		table.Headers = append(table.Headers, customFieldCaptions[field])
+	}
+
+	// Отбор
+	selected := make([]models.StockItem, 0)
+	for _, item := range items {
+		ok := true
+		for _, filter := range def.Filters {
+			if !matchCustomFilter(item, filter) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			selected = append(selected, item)
+			table.Total += item.Quantity
+		}
+	}
+	table.Count = len(selected)
+	table.Items = selected
+
+	// Сортировка: сначала поля группировки, затем поля сортировки
+	order := make([]models.CustomSort, 0, len(def.GroupBy)+len(def.Sort))
+	for _, field := range def.GroupBy {
+		order = append(order, models.CustomSort{Field: field})
+	}
+	order = append(order, def.Sort...)
+	sort.SliceStable(selected, func(i, j int) bool {
+		for _, s := range order {
+			a, _ := stockItemField(selected[i], s.Field)
+			b, _ := stockItemField(selected[j], s.Field)
+			if c := compareCustom(s.Field, a, b); c != 0 {
+				if s.Desc {
+					return c > 0
+				}
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	groupKey := func(item models.StockItem) []string {
+		key := make([]string, 0, len(def.GroupBy))
+		for _, field := range def.GroupBy {
+			value, _ := stockItemField(item, field)
+			key = append(key, value)
+		}
+		return key
+	}
+
+	// subtotal строка «Итого»: подпись в первой колонке, суммы по суммируемым полям
+	subtotal := func(label string, group []models.StockItem) CustomReportRow {
+		values := make([]string, len(fields))
+		values[0] = label
+		for i, field := range fields {
+			if !customSumFields[field] {
+				continue
+			}
+			sum := 0.0
+			for _, item := range group {
+				v, _ := stockItemField(item, field)
+				n, _ := strconv.ParseFloat(v, 64)
+				sum += n
+			}
+			values[i] = formatNumber(sum)
+		}
+		return CustomReportRow{Values: values, Subtotal: true}
+	}
+
+	for start := 0; start < len(selected); {
+		end := start + 1
+		if len(def.GroupBy) > 0 {
+			key := strings.Join(groupKey(selected[start]), "\x00")
+			for end < len(selected) && strings.Join(groupKey(selected[end]), "\x00") == key {
+				end++
+			}
+		} else {
+			end = len(selected)
+		}
+
+		for _, item := range selected[start:end] {
+			values := make([]string, len(fields))
+			for i, field := range fields {
+				values[i], _ = stockItemField(item, field)
+			}
+			table.Rows = append(table.Rows, CustomReportRow{Values: values})
+		}
+		if len(def.GroupBy) > 0 {
+			table.Rows = append(table.Rows, subtotal("Итого "+strings.Join(groupKey(selected[start]), ", "), selected[start:end]))
+		}
+		start = end
+	}
+	if len(def.GroupBy) > 0 && len(selected) > 0 {
+		table.Rows = append(table.Rows, subtotal("Итого", selected))
+	}
+
+	return table, nil
+}
+
+// CreateCSV выгружает отчет в CSV (разделитель ";")
+func (t *CustomReportTable) CreateCSV() ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Comma = ';'
+
+	if err := writer.Write(t.Headers); err != nil {
+		return nil, err
+	}
+	for _, row := range t.Rows {
+		if err := writer.Write(row.Values); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// CreateExcel выгружает отчет в Excel: числовые поля записываются числами, строки «Итого» выделены
+func (t *CustomReportTable) CreateExcel() (*excelize.File, error) {
+	f := excelize.NewFile()
+
+	const sheet = "Sheet1"
+
+	for i, header := range t.Headers {
+		cell, _ := excelize.CoordinatesToCellName(i+1, 1)
+		f.SetCellValue(sheet, cell, header)
+	}
+
+	subtotalStyle, _ := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{
+			Bold: true,
+		},
+		Fill: excelize.Fill{
+			Type:    "pattern",
+			Color:   []string{"#F2F2F2"},
+			Pattern: 1,
+		},
+	})
+
+	lastCol, _ := excelize.ColumnNumberToName(max(len(t.Fields), 1))
+	for r, row := range t.Rows {
+		excelRow := r + 2
+		for i, value := range row.Values {
+			cell, _ := excelize.CoordinatesToCellName(i+1, excelRow)
+			if customNumericFields[t.Fields[i]] && value != "" {
+				if n, err := strconv.ParseFloat(value, 64); err == nil {
+					f.SetCellValue(sheet, cell, n)
+					continue
+				}
+			}
+			f.SetCellValue(sheet, cell, value)
+		}
+		if row.Subtotal {
+			f.SetCellStyle(sheet, fmt.Sprintf("A%d", excelRow), fmt.Sprintf("%s%d", lastCol, excelRow), subtotalStyle)
+		}
+	}
+
+	headerStyle, _ := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{
+			Bold: true,
+		},
+		Fill: excelize.Fill{
+			Type:    "pattern",
+			Color:   []string{"#E0E0E0"},
+			Pattern: 1,
+		},
+	})
+	f.SetCellStyle(sheet, "A1", lastCol+"1", headerStyle)
+
+	for i, field := range t.Fields {
+		col, _ := excelize.ColumnNumberToName(i + 1)
+		width := 15.0
+		switch field {
+		case "name", "characteristic":
+			width = 45
+		case "quantity", "raw_quantity", "rim", "season", "row_num":
+			width = 10
+		}
+		f.SetColWidth(sheet, col, col, width)
+	}
+
+	return f, nil
+}
+
+// CustomReportFile файл выполненного пользовательского отчета
+type CustomReportFile struct {
+	Data        []byte
+	Filename    string
+	ContentType string
+	Count       int                // позиций после отбора
+	Total       int                // сумма остатков отобранных позиций
+	Items       []models.StockItem // отобранные позиции
+}
+
+// RenderCustomReport выполняет отчет над позициями и возвращает файл в формате отчета.
+// Используется при скачивании и отправке по email
+func RenderCustomReport(def models.CustomReport, items []models.StockItem, reportDate time.Time) (*CustomReportFile, error) {
+	table, err := BuildCustomReport(def, items)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &CustomReportFile{
+		Filename: CustomReportFilename(def, reportDate),
+		Count:    table.Count,
+		Total:    table.Total,
+		Items:    table.Items,
+	}
+
+	if def.Format == CustomFormatCSV {
+		file.ContentType = "text/csv; charset=utf-8"
+		file.Data, err = table.CreateCSV()
+		return file, err
+	}
+
+	f, err := table.CreateExcel()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	file.ContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	file.Data = buf.Bytes()
+	return file, nil
+}
+
+// CustomReportFilename имя файла отчета: название (буквы и цифры) и дата остатков
+func CustomReportFilename(def models.CustomReport, reportDate time.Time) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, def.Name)
+	name = strings.Trim(name, "_")
+	if name == "" {
+		name = "Report"
+	}
+	format := def.Format
+	if format == "" {
+		format = CustomFormatXLSX
+	}
+	return fmt.Sprintf("%s_%s.%s", name, reportDate.Format("20060102"), format)
+}
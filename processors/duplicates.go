@@ -0,0 +1,213 @@
+package processors
+
+import (
+	"fmt"
+	"strings"
+
+	"sending-stocks/models"
+)
+
+// Политики обработки дубликатов
+const (
+	DuplicateSum       = "sum"        // суммировать остатки в первую строку
+	DuplicateKeepFirst = "keep_first" // оставить первую строку, остальные отбросить
+	DuplicateReject    = "reject"     // оставить все строки и заблокировать отправку
+)
+
+// DuplicateRuleID идентификатор замечаний о дубликатах
+const DuplicateRuleID = "duplicate"
+
+// BrandDuplicatePolicy политика дубликатов для бренда
+type BrandDuplicatePolicy struct {
+	Brand  string
+	Policy string
+}
+
+// DuplicateResolver находит строки с одинаковым кодом производителя (или кодом 1С) и объединяет их
+type DuplicateResolver struct {
+	DefaultPolicy string
+	BrandPolicies []BrandDuplicatePolicy
+}
+
+// NewDuplicateResolver создает обработчик дубликатов
+func NewDuplicateResolver(defaultPolicy string, brandPolicies []BrandDuplicatePolicy) (*DuplicateResolver, error) {
+	if defaultPolicy == "" {
+		defaultPolicy = DuplicateSum
+	}
+	if !isDuplicatePolicy(defaultPolicy) {
+		return nil, fmt.Errorf("неизвестная политика дубликатов %q", defaultPolicy)
+	}
+	for _, bp := range brandPolicies {
+		if !isDuplicatePolicy(bp.Policy) {
+			return nil, fmt.Errorf("неизвестная политика дубликатов %q для бренда %s", bp.Policy, bp.Brand)
+		}
+	}
+
+	return &DuplicateResolver{
+		DefaultPolicy: defaultPolicy,
+		BrandPolicies: brandPolicies,
+	}, nil
+}
+
+// ParseBrandDuplicatePolicies разбирает строку вида "Pirelli:sum,Cordiant:reject"
+func ParseBrandDuplicatePolicies(s string) ([]BrandDuplicatePolicy, error) {
+	result := make([]BrandDuplicatePolicy, 0)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		brand, policy, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("неверный формат %q, ожидается Бренд:политика", part)
+		}
+		result = append(result, BrandDuplicatePolicy{
+			Brand:  strings.TrimSpace(brand),
+			Policy: strings.TrimSpace(policy),
+		})
+	}
+	return result, nil
+}
+
+func isDuplicatePolicy(policy string) bool {
+	switch policy {
+	case DuplicateSum, DuplicateKeepFirst, DuplicateReject:
+		return true
+	}
+	return false
+}
+
+// PolicyFor возвращает политику для бренда
+func (d *DuplicateResolver) PolicyFor(brand string) string {
+	for _, bp := range d.BrandPolicies {
+		if matchesBrand(brand, []string{bp.Brand}) {
+			return bp.Policy
+		}
+	}
+	return d.DefaultPolicy
+}
+
+// duplicateKey ключ для поиска дубликатов: бренд и код производителя, а если его нет - код 1С.
+// Бренд входит в ключ, потому что после нормализации коды разных брендов могут совпасть
+func duplicateKey(item models.StockItem) string {
+	brand := strings.ToLower(item.CleanBrand)
+	if item.ManufacturerSKU != "" {
+		return brand + "|sku:" + item.ManufacturerSKU
+	}
+	if item.Code1C != "" {
+		return brand + "|1c:" + item.Code1C
+	}
+	return ""
+}
+
+// duplicateCode код позиции для ключа дубликатов и сообщений
+func duplicateCode(item models.StockItem) string {
+	if item.ManufacturerSKU != "" {
+		return item.ManufacturerSKU
+	}
+	return item.Code1C
+}
+
+// rowRef номер строки для сообщений; лист указывается, только если он отличается от текущего
+func rowRef(sheet string, rowNum int, currentSheet string) string {
+	if sheet != "" && sheet != currentSheet {
+		return fmt.Sprintf("%d (лист %s)", rowNum, sheet)
+	}
+	return fmt.Sprintf("%d", rowNum)
+}
+
+// Resolve объединяет дубликаты по политике бренда.
+// Возвращает итоговые позиции, список выполненных объединений и замечания для политики reject
+func (d *DuplicateResolver) Resolve(items []models.StockItem) ([]models.StockItem, []models.DuplicateMerge, []models.ValidationFinding) {
+	merges := make([]models.DuplicateMerge, 0)
+	findings := make([]models.ValidationFinding, 0)
+	if d == nil {
+		return items, merges, findings
+	}
+
+	// Группируем индексы позиций по ключу, сохраняя порядок первых вхождений
+	groups := make(map[string][]int)
+	order := make([]string, 0)
+	for i, item := range items {
+		key := duplicateKey(item)
+		if key == "" {
+			continue
+		}
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+
+	drop := make(map[int]bool)
+	for _, key := range order {
+		indexes := groups[key]
+		if len(indexes) < 2 {
+			continue
+		}
+
+		first := &items[indexes[0]]
+		policy := d.PolicyFor(first.CleanBrand)
+
+		merge := models.DuplicateMerge{
+			Key:          duplicateCode(*first),
+			Brand:        first.CleanBrand,
+			Policy:       policy,
+			KeptSheet:    first.Sheet,
+			KeptRow:      first.RowNum,
+			MergedSheets: make([]string, 0, len(indexes)-1),
+			MergedRows:   make([]int, 0, len(indexes)-1),
+			Quantities:   []int{first.Quantity},
+		}
+
+		for _, idx := range indexes[1:] {
+			dup := items[idx]
+			merge.MergedSheets = append(merge.MergedSheets, dup.Sheet)
+			merge.MergedRows = append(merge.MergedRows, dup.RowNum)
+			merge.Quantities = append(merge.Quantities, dup.Quantity)
+
+			switch policy {
+			case DuplicateSum:
+				// Строки с их ценами сохраняются: сложенный остаток оценивается по цене каждой строки
+				if len(first.Sources) == 0 {
+					first.Sources = []models.StockSource{stockSource(*first)}
+				}
+				first.Sources = append(first.Sources, stockSource(dup))
+				first.Quantity += dup.Quantity
+				first.RawQuantity += dup.RawQuantity
+				drop[idx] = true
+			case DuplicateKeepFirst:
+				drop[idx] = true
+			case DuplicateReject:
+				findings = append(findings, models.ValidationFinding{
+					Source:          dup.Source,
+					Sheet:           dup.Sheet,
+					RowNum:          dup.RowNum,
+					RuleID:          DuplicateRuleID,
+					Severity:        models.SeverityError,
+					Field:           "manufacturer_sku",
+					Value:           merge.Key,
+					Message:         fmt.Sprintf("дубликат строки %s, код %s", rowRef(first.Sheet, first.RowNum, dup.Sheet), merge.Key),
+					Code1C:          dup.Code1C,
+					ManufacturerSKU: dup.ManufacturerSKU,
+					Brand:           dup.CleanBrand,
+				})
+			}
+		}
+
+		merge.Quantity = first.Quantity
+		merges = append(merges, merge)
+	}
+
+	if len(drop) == 0 {
+		return items, merges, findings
+	}
+
+	result := make([]models.StockItem, 0, len(items)-len(drop))
+	for i, item := range items {
+		if !drop[i] {
+			result = append(result, item)
+		}
+	}
+	return result, merges, findings
+}
@@ -0,0 +1,121 @@
+package processors
+
+import (
+	"slices"
+	"testing"
+
+	"sending-stocks/models"
+)
+
+func TestDuplicateResolverResolve(t *testing.T) {
+	items := func() []models.StockItem {
+		return []models.StockItem{
+			{Sheet: "Москва", RowNum: 2, CleanBrand: "Pirelli", ManufacturerSKU: "123", Quantity: 4},
+			{Sheet: "Москва", RowNum: 3, CleanBrand: "Cordiant", ManufacturerSKU: "123", Quantity: 5},
+			{Sheet: "Тверь", RowNum: 4, CleanBrand: "Pirelli", ManufacturerSKU: "123", Quantity: 2},
+			{Sheet: "Тверь", RowNum: 5, CleanBrand: "Cordiant", Code1C: "00-1", Quantity: 1},
+			{Sheet: "Тверь", RowNum: 6, CleanBrand: "cordiant", Code1C: "00-1", Quantity: 3},
+			{Sheet: "Тверь", RowNum: 7, CleanBrand: "Cordiant", Quantity: 8},
+			{Sheet: "Тверь", RowNum: 8, CleanBrand: "Cordiant", Quantity: 9},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		policy   string
+		brands   []BrandDuplicatePolicy
+		rows     []int // строки итоговых позиций
+		quantity []int // остатки итоговых позиций
+		merges   int
+		findings []int // строки с замечаниями
+	}{
+		{
+			name:     "сумма",
+			policy:   DuplicateSum,
+			rows:     []int{2, 3, 5, 7, 8},
+			quantity: []int{6, 5, 4, 8, 9},
+			merges:   2,
+		},
+		{
+			name:     "первая строка",
+			policy:   DuplicateKeepFirst,
+			rows:     []int{2, 3, 5, 7, 8},
+			quantity: []int{4, 5, 1, 8, 9},
+			merges:   2,
+		},
+		{
+			name:     "отклонить",
+			policy:   DuplicateReject,
+			rows:     []int{2, 3, 4, 5, 6, 7, 8},
+			quantity: []int{4, 5, 2, 1, 3, 8, 9},
+			merges:   2,
+			findings: []int{4, 6},
+		},
+		{
+			name:     "политика бренда",
+			policy:   DuplicateSum,
+			brands:   []BrandDuplicatePolicy{{Brand: "Cordiant", Policy: DuplicateReject}},
+			rows:     []int{2, 3, 5, 6, 7, 8},
+			quantity: []int{6, 5, 1, 3, 8, 9},
+			merges:   2,
+			findings: []int{6},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDuplicateResolver(tt.policy, tt.brands)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, merges, findings := d.Resolve(items())
+
+			rows := make([]int, 0, len(result))
+			quantity := make([]int, 0, len(result))
+			for _, item := range result {
+				rows = append(rows, item.RowNum)
+				quantity = append(quantity, item.Quantity)
+			}
+			if !slices.Equal(rows, tt.rows) || !slices.Equal(quantity, tt.quantity) {
+				t.Errorf("строки %v с остатками %v, ожидалось %v с %v", rows, quantity, tt.rows, tt.quantity)
+			}
+			if len(merges) != tt.merges {
+				t.Errorf("объединений %d, ожидалось %d: %+v", len(merges), tt.merges, merges)
+			}
+
+			findingRows := make([]int, 0, len(findings))
+			for _, f := range findings {
+				findingRows = append(findingRows, f.RowNum)
+				if f.RuleID != DuplicateRuleID || f.Severity != models.SeverityError {
+					t.Errorf("замечание: %+v", f)
+				}
+			}
+			if len(findingRows) > 0 || len(tt.findings) > 0 {
+				if !slices.Equal(findingRows, tt.findings) {
+					t.Errorf("замечания в строках %v, ожидалось %v", findingRows, tt.findings)
+				}
+			}
+		})
+	}
+}
+
+func TestDuplicateResolverSumKeepsSources(t *testing.T) {
+	d, err := NewDuplicateResolver(DuplicateSum, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, merges, _ := d.Resolve([]models.StockItem{
+		{Sheet: "Москва", RowNum: 2, CleanBrand: "Pirelli", ManufacturerSKU: "123", Quantity: 4, RawQuantity: 4, Price: 5000},
+		{Sheet: "Тверь", RowNum: 9, CleanBrand: "Pirelli", ManufacturerSKU: "123", Quantity: 2, RawQuantity: 2, Price: 6000},
+	})
+	if len(result) != 1 || result[0].RawQuantity != 6 {
+		t.Fatalf("позиции: %+v", result)
+	}
+	sources := result[0].Sources
+	if len(sources) != 2 || sources[1].Sheet != "Тверь" || sources[1].RowNum != 9 || sources[1].Price != 6000 {
+		t.Errorf("источники: %+v", sources)
+	}
+	if m := merges[0]; m.KeptRow != 2 || !slices.Equal(m.MergedRows, []int{9}) || !slices.Equal(m.Quantities, []int{4, 2}) || m.Quantity != 6 {
+		t.Errorf("объединение: %+v", m)
+	}
+}
@@ -0,0 +1,332 @@
+package processors
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/encoding/charmap"
+
+	"sending-stocks/models"
+)
+
+// Отчеты, для которых можно сформировать INVRPT (набор позиций как у отчета производителя)
+var InvrptReports = []string{"pirelli", "cordiant", "hankook", "ikon", "all"}
+
+// InvrptParty участник сообщения (сегмент NAD)
+type InvrptParty struct {
+	Qualifier string `json:"qualifier"`        // роль: GY - отчитывающаяся сторона, SU - поставщик, BY - покупатель
+	ID        string `json:"id"`               // GLN или код клиента
+	Agency    string `json:"agency,omitempty"` // агентство кода (по умолчанию 9 - GS1)
+}
+
+// InvrptConfig настройки сообщения INVRPT для одного получателя
+//
+// Пример:
+//
+//	{"report": "pirelli", "sender_id": "4607001234567", "recipient_id": "8003699000007",
+//	 "parties": [{"qualifier": "GY", "id": "4607001234567"}, {"qualifier": "SU", "id": "8003699000007"}],
+//	 "emails": ["edi@pirelli.com"]}
+type InvrptConfig struct {
+	Report             string        `json:"report"`                        // pirelli, cordiant, hankook, ikon или all
+	Syntax             string        `json:"syntax,omitempty"`              // набор символов UNB (по умолчанию UNOC:3)
+	SenderID           string        `json:"sender_id"`                     // отправитель обмена (UNB)
+	SenderQualifier    string        `json:"sender_qualifier,omitempty"`    // тип кода отправителя (по умолчанию 14 - GLN)
+	RecipientID        string        `json:"recipient_id"`                  // получатель обмена (UNB)
+	RecipientQualifier string        `json:"recipient_qualifier,omitempty"` // тип кода получателя (по умолчанию 14 - GLN)
+	Association        string        `json:"association,omitempty"`         // код соглашения UNH, например EAN008
+	Parties            []InvrptParty `json:"parties,omitempty"`             // участники NAD (пусто - GY с sender_id)
+	ItemNumberType     string        `json:"item_number_type,omitempty"`    // тип кода товара в LIN (по умолчанию SA)
+	Descriptions       bool          `json:"descriptions,omitempty"`        // добавлять наименование (IMD)
+	Test               bool          `json:"test,omitempty"`                // тестовый обмен (UNB 0035 = 1)
+	Emails             []string      `json:"emails,omitempty"`              // получатели при отправке по email
+}
+
+// InvrptMessage сформированное сообщение
+type InvrptMessage struct {
+	Data      []byte
+	Reference string // контрольный номер обмена
+	Lines     int    // товарных строк (LIN)
+	Quantity  int    // сумма остатков
+	Skipped   int    // позиций без кода производителя
+}
+
+// InvrptProcessor формирует сообщения EDIFACT INVRPT D96A (отчет об остатках)
+type InvrptProcessor struct {
+	Configs []InvrptConfig
+	Clock   models.Clock
+
+	mu            sync.Mutex
+	lastReference int64 // последний выданный контрольный номер обмена
+}
+
+// LoadInvrptConfigs читает настройки INVRPT из JSON файла
+func LoadInvrptConfigs(path string) ([]InvrptConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать настройки INVRPT: %v", err)
+	}
+	var configs []InvrptConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("ошибка разбора настроек INVRPT: %v", err)
+	}
+	return configs, nil
+}
+
+// NewInvrptProcessor проверяет настройки, заполняет значения по умолчанию и создает процессор
+func NewInvrptProcessor(configs []InvrptConfig, clock models.Clock) (*InvrptProcessor, error) {
+	seen := make(map[string]bool, len(configs))
+	for i := range configs {
+		c := &configs[i]
+		if !slices.Contains(InvrptReports, c.Report) {
+			return nil, fmt.Errorf("INVRPT %d: неизвестный отчет %q (допустимо: %s)", i+1, c.Report, strings.Join(InvrptReports, ", "))
+		}
+		if seen[c.Report] {
+			return nil, fmt.Errorf("INVRPT %s: настройки повторяются", c.Report)
+		}
+		seen[c.Report] = true
+
+		if c.Syntax == "" {
+			c.Syntax = "UNOC:3"
+		}
+		charset, version, _ := strings.Cut(c.Syntax, ":")
+		if _, ok := edifactCharsets[charset]; !ok {
+			return nil, fmt.Errorf("INVRPT %s: неизвестный набор символов %q", c.Report, c.Syntax)
+		}
+		if !slices.Contains([]string{"1", "2", "3", "4"}, version) {
+			return nil, fmt.Errorf("INVRPT %s: неверная версия синтаксиса в %q (ожидается 1-4)", c.Report, c.Syntax)
+		}
+		// UTF-8 (UNOY) появился только в 4-й версии синтаксиса
+		if charset == "UNOY" && version != "4" {
+			return nil, fmt.Errorf("INVRPT %s: набор UNOY требует версии синтаксиса 4 (UNOY:4)", c.Report)
+		}
+		if c.SenderQualifier == "" {
+			c.SenderQualifier = "14"
+		}
+		if c.RecipientQualifier == "" {
+			c.RecipientQualifier = "14"
+		}
+		if c.ItemNumberType == "" {
+			c.ItemNumberType = "SA"
+		}
+		if c.SenderID == "" || c.RecipientID == "" {
+			return nil, fmt.Errorf("INVRPT %s: нужны sender_id и recipient_id", c.Report)
+		}
+		if len(c.Parties) == 0 {
+			c.Parties = []InvrptParty{{Qualifier: "GY", ID: c.SenderID}}
+		}
+		for j := range c.Parties {
+			if c.Parties[j].Qualifier == "" || c.Parties[j].ID == "" {
+				return nil, fmt.Errorf("INVRPT %s: участник %d без qualifier или id", c.Report, j+1)
+			}
+			if c.Parties[j].Agency == "" {
+				c.Parties[j].Agency = "9"
+			}
+		}
+		for _, value := range []string{c.SenderID, c.RecipientID, c.Association} {
+			if err := checkEdifactCharset(c.Syntax, value); err != nil {
+				return nil, fmt.Errorf("INVRPT %s: %v", c.Report, err)
+			}
+		}
+	}
+
+	return &InvrptProcessor{
+		Configs: configs,
+		Clock:   clock,
+	}, nil
+}
+
+// Config настройки INVRPT отчета (nil - не настроен)
+func (p *InvrptProcessor) Config(report string) *InvrptConfig {
+	for i := range p.Configs {
+		if p.Configs[i].Report == report {
+			return &p.Configs[i]
+		}
+	}
+	return nil
+}
+
+// CreateMessage формирует обмен с одним сообщением INVRPT: остаток (QTY+145) по каждому коду
+// производителя на дату остатков. Одинаковые коды из разных листов суммируются
+func (p *InvrptProcessor) CreateMessage(config *InvrptConfig, items []models.StockItem, stockDate time.Time) (*InvrptMessage, error) {
+	now := p.Clock.Now()
+	msg := &InvrptMessage{Reference: p.nextReference(now)}
+
+	// Строки сообщения в порядке первого появления кода
+	type line struct {
+		sku      string
+		name     string
+		quantity int
+	}
+	var lines []*line
+	bySKU := make(map[string]*line)
+	for _, item := range items {
+		sku := strings.TrimSpace(item.ManufacturerSKU)
+		if sku == "" {
+			msg.Skipped++
+			continue
+		}
+		l, ok := bySKU[sku]
+		if !ok {
+			l = &line{sku: sku, name: item.Name}
+			bySKU[sku] = l
+			lines = append(lines, l)
+		}
+		l.quantity += item.Quantity
+	}
+
+	var segments []string
+	add := func(elements ...string) {
+		segments = append(segments, strings.Join(elements, "+"))
+	}
+
+	unh := "INVRPT:D:96A:UN"
+	if config.Association != "" {
+		unh += ":" + config.Association
+	}
+	add("UNH", "1", unh)
+	add("BGM", "35", msg.Reference, "9")
+	add("DTM", "137:"+now.Format("200601021504")+":203")
+	add("DTM", "366:"+stockDate.Format("20060102")+":102")
+	for _, party := range config.Parties {
+		add("NAD", edifactEscape(party.Qualifier), edifactEscape(party.ID)+"::"+edifactEscape(party.Agency))
+	}
+	for i, l := range lines {
+		if err := checkEdifactCharset(config.Syntax, l.sku); err != nil {
+			return nil, fmt.Errorf("код %s: %v", l.sku, err)
+		}
+		add("LIN", fmt.Sprintf("%d", i+1), "", edifactEscape(l.sku)+":"+config.ItemNumberType)
+		if config.Descriptions && l.name != "" {
+			if err := checkEdifactCharset(config.Syntax, l.name); err != nil {
+				return nil, fmt.Errorf("наименование %s: %v", l.sku, err)
+			}
+			add("IMD", "F", "", ":::"+edifactEscape(truncateRunes(l.name, 35)))
+		}
+		add("QTY", fmt.Sprintf("145:%d:PCE", l.quantity))
+		msg.Quantity += l.quantity
+	}
+	msg.Lines = len(lines)
+	// UNT учитывает все сегменты сообщения от UNH до UNT включительно
+	add("UNT", fmt.Sprintf("%d", len(segments)+1), "1")
+
+	test := ""
+	if config.Test {
+		test = "++++++1"
+	}
+	// Дата подготовки UNB: ГГММДД, в 4-й версии синтаксиса - ГГГГММДД
+	prepared := now.Format("060102")
+	if strings.HasSuffix(config.Syntax, ":4") {
+		prepared = now.Format("20060102")
+	}
+	var b strings.Builder
+	b.WriteString("UNA:+.? '")
+	b.WriteString(strings.Join([]string{
+		"UNB",
+		config.Syntax,
+		edifactEscape(config.SenderID) + ":" + config.SenderQualifier,
+		edifactEscape(config.RecipientID) + ":" + config.RecipientQualifier,
+		prepared + ":" + now.Format("1504"),
+		msg.Reference,
+	}, "+") + test + "'")
+	for _, segment := range segments {
+		b.WriteString(segment + "'")
+	}
+	b.WriteString("UNZ+1+" + msg.Reference + "'")
+
+	data, err := encodeEdifact(config.Syntax, b.String())
+	if err != nil {
+		return nil, err
+	}
+	msg.Data = data
+	return msg, nil
+}
+
+// nextReference контрольный номер обмена (UNB/UNZ 0020, BGM): время ГГММДДччммсс и две цифры номера
+// внутри секунды. Номера растут монотонно, поэтому сообщения одной секунды не совпадают
+func (p *InvrptProcessor) nextReference(now time.Time) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	reference, _ := strconv.ParseInt(now.Format("060102150405")+"00", 10, 64)
+	if reference <= p.lastReference {
+		reference = p.lastReference + 1
+	}
+	p.lastReference = reference
+	return strconv.FormatInt(reference, 10)
+}
+
+// GenerateFilename имя файла INVRPT: отчет и дата остатков
+func (p *InvrptProcessor) GenerateFilename(report string, stockDate time.Time) string {
+	return fmt.Sprintf("INVRPT_%s_%s.edi", report, stockDate.Format("20060102"))
+}
+
+// edifactEscape экранирует служебные символы EDIFACT знаком ?
+func edifactEscape(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		switch r {
+		case '?', '+', ':', '\'':
+			b.WriteRune('?')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// edifactCharsets допустимые символы наборов UNB: A - заглавные латинские, B - ASCII,
+// C - Latin-1, Y - любые символы (UTF-8, только синтаксис версии 4)
+var edifactCharsets = map[string]func(r rune) bool{
+	"UNOA": func(r rune) bool {
+		return (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || strings.ContainsRune(" .,-()/='+:?!\"%&*;<>", r)
+	},
+	"UNOB": func(r rune) bool { return r >= 0x20 && r < 0x7f },
+	"UNOC": func(r rune) bool { return r >= 0x20 && r <= 0xff && r != 0x7f },
+	"UNOY": unicode.IsPrint,
+}
+
+// checkEdifactCharset проверяет, что значение записывается в выбранном наборе символов
+func checkEdifactCharset(syntax, value string) error {
+	charset := strings.SplitN(syntax, ":", 2)[0]
+	allowed := edifactCharsets[charset]
+	for _, r := range value {
+		if !allowed(r) {
+			return fmt.Errorf("символ %q недопустим в наборе %s", r, charset)
+		}
+	}
+	return nil
+}
+
+// encodeEdifact кодирует обмен в наборе символов UNB: UNOC - ISO 8859-1, UNOA и UNOB - ASCII,
+// UNOY - UTF-8
+func encodeEdifact(syntax, interchange string) ([]byte, error) {
+	switch charset := strings.SplitN(syntax, ":", 2)[0]; charset {
+	case "UNOC":
+		encoded, err := charmap.ISO8859_1.NewEncoder().String(interchange)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка конвертации в ISO 8859-1: %v", err)
+		}
+		return []byte(encoded), nil
+	case "UNOA", "UNOB":
+		for _, r := range interchange {
+			if r > unicode.MaxASCII {
+				return nil, fmt.Errorf("символ %q недопустим в наборе %s", r, charset)
+			}
+		}
+	}
+	return []byte(interchange), nil
+}
+
+// truncateRunes обрезает строку до n символов
+func truncateRunes(value string, n int) string {
+	runes := []rune(value)
+	if len(runes) <= n {
+		return value
+	}
+	return string(runes[:n])
+}
@@ -0,0 +1,88 @@
+package processors
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"golang.org/x/text/encoding/charmap"
+
+	"sending-stocks/models"
+)
+
+func TestInvrptProcessorCreateMessage(t *testing.T) {
+	clock := models.FixedClock{Time: time.Date(2026, 10, 18, 10, 15, 30, 0, time.UTC)}
+	p, err := NewInvrptProcessor([]InvrptConfig{{
+		Report:      "pirelli",
+		SenderID:    "4607001234567",
+		RecipientID: "8003699000007",
+		Association: "EAN008",
+		Parties: []InvrptParty{
+			{Qualifier: "GY", ID: "4607001234567"},
+			{Qualifier: "SU", ID: "8003699000007"},
+		},
+		Descriptions: true,
+	}}, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := p.Config("pirelli")
+
+	items := []models.StockItem{
+		{ManufacturerSKU: "AB+1:2'3?", Name: "Pneu été", Quantity: 4},
+		{ManufacturerSKU: "P7", Quantity: 4},
+		{ManufacturerSKU: "", Name: "без кода", Quantity: 1},
+		// Тот же код с другого листа суммируется в первую строку
+		{ManufacturerSKU: " AB+1:2'3? ", Name: "Pneu été", Quantity: 2},
+	}
+	stockDate := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+
+	msg, err := p.CreateMessage(config, items, stockDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// UNT считает сегменты от UNH до UNT включительно: 12
+	want := "UNA:+.? '" +
+		"UNB+UNOC:3+4607001234567:14+8003699000007:14+261018:1015+26101810153000'" +
+		"UNH+1+INVRPT:D:96A:UN:EAN008'" +
+		"BGM+35+26101810153000+9'" +
+		"DTM+137:202610181015:203'" +
+		"DTM+366:20261017:102'" +
+		"NAD+GY+4607001234567::9'" +
+		"NAD+SU+8003699000007::9'" +
+		"LIN+1++AB?+1?:2?'3??:SA'" +
+		"IMD+F++:::Pneu été'" +
+		"QTY+145:6:PCE'" +
+		"LIN+2++P7:SA'" +
+		"QTY+145:4:PCE'" +
+		"UNT+12+1'" +
+		"UNZ+1+26101810153000'"
+
+	got, err := charmap.ISO8859_1.NewDecoder().Bytes(msg.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("сообщение:\n%s\nожидалось:\n%s", got, want)
+	}
+	// UNOC: файл в ISO 8859-1, «é» - один байт 0xE9
+	if !bytes.Contains(msg.Data, []byte("Pneu \xe9t\xe9'")) {
+		t.Errorf("наименование не в ISO 8859-1: %q", msg.Data)
+	}
+	if msg.Lines != 2 || msg.Quantity != 10 || msg.Skipped != 1 {
+		t.Errorf("строк %d, остаток %d, пропущено %d", msg.Lines, msg.Quantity, msg.Skipped)
+	}
+
+	// Второе сообщение в ту же секунду получает другой контрольный номер
+	second, err := p.CreateMessage(config, items, stockDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Reference != "26101810153001" {
+		t.Errorf("контрольный номер второго сообщения %s", second.Reference)
+	}
+	if !bytes.Contains(second.Data, []byte("UNZ+1+26101810153001'")) || !bytes.Contains(second.Data, []byte("BGM+35+26101810153001+9'")) {
+		t.Errorf("UNZ и BGM второго сообщения не совпадают с UNB: %q", second.Data)
+	}
+}
@@ -34,23 +34,6 @@ func (p *HankookProcessor) isHankookBrand(brand string) bool {
 	return false
 }
 
-// truncateManufacturerSKU обрезает код производителя до последних 7 символов
-func (p *HankookProcessor) truncateManufacturerSKU(sku string) string {
-	// Удаляем пробелы
-	sku = strings.TrimSpace(sku)
-	if sku == "" {
-		return ""
-	}
-
-	// Если длина меньше или равна 7, возвращаем как есть
-	if len(sku) <= 7 {
-		return sku
-	}
-
-	// Возвращаем последние 7 символов
-	return sku[len(sku)-7:]
-}
-
 // FilterItems фильтрует позиции для Hankook
 func (p *HankookProcessor) FilterItems(items []models.StockItem) []models.StockItem {
 	result := make([]models.StockItem, 0)
@@ -67,6 +50,17 @@ func (p *HankookProcessor) FilterItems(items []models.StockItem) []models.StockI
 	return result
 }
 
+// ExclusionReason возвращает причину, по которой позиция Hankook не попадет в отчет
+func (p *HankookProcessor) ExclusionReason(item models.StockItem) string {
+	if !p.isHankookBrand(item.CleanBrand) {
+		return ""
+	}
+	if item.Quantity <= 0 {
+		return "нет остатка"
+	}
+	return ""
+}
+
 // CreateExcelReport создает Excel отчет для Hankook
 func (p *HankookProcessor) CreateExcelReport(items []models.StockItem) (*excelize.File, error) {
 	f := excelize.NewFile()
@@ -98,10 +92,10 @@ func (p *HankookProcessor) CreateExcelReport(items []models.StockItem) (*exceliz
 
 	// Заполняем данные
 	row := 2
+	hasAged := false
 	for _, item := range hankookItems {
-		// Manufacturer Code (обрезанный до 7 символов)
-		manufacturerCode := p.truncateManufacturerSKU(item.ManufacturerSKU)
-		f.SetCellValue("Hankook Report", fmt.Sprintf("A%d", row), manufacturerCode)
+		// Manufacturer Code (в формате Hankook, см. SKU_NORMALIZE_BRANDS)
+		f.SetCellValue("Hankook Report", fmt.Sprintf("A%d", row), item.ManufacturerSKU)
 
 		// Product Name (наименование товара)
 		f.SetCellValue("Hankook Report", fmt.Sprintf("B%d", row), item.Name)
@@ -110,20 +104,24 @@ func (p *HankookProcessor) CreateExcelReport(items []models.StockItem) (*exceliz
 		f.SetCellValue("Hankook Report", fmt.Sprintf("C%d", row), item.CleanBrand)
 
 		// Season
-		season := ""
-		if item.Season == "лето" {
-			season = "Summer"
-		} else if item.Season == "зима" {
-			season = "Winter"
-		}
-		f.SetCellValue("Hankook Report", fmt.Sprintf("D%d", row), season)
+		f.SetCellValue("Hankook Report", fmt.Sprintf("D%d", row), hankookSeason(item))
 
 		// Quantity
 		f.SetCellValue("Hankook Report", fmt.Sprintf("E%d", row), item.Quantity)
 
+		// Production year (только для отмеченного залежалого товара)
+		if item.AgedFlag {
+			f.SetCellValue("Hankook Report", fmt.Sprintf("F%d", row), AgedLabel(item))
+			hasAged = true
+		}
+
 		row++
 	}
 
+	if hasAged {
+		f.SetCellValue("Hankook Report", "F1", "Production Year")
+	}
+
 	// Стили для заголовков
 	headerStyle, _ := f.NewStyle(&excelize.Style{
 		Font: &excelize.Font{
@@ -136,7 +134,11 @@ func (p *HankookProcessor) CreateExcelReport(items []models.StockItem) (*exceliz
 			Pattern: 1,
 		},
 	})
-	f.SetCellStyle("Hankook Report", "A1", "E1", headerStyle)
+	lastCol := "E"
+	if hasAged {
+		lastCol = "F"
+	}
+	f.SetCellStyle("Hankook Report", "A1", lastCol+"1", headerStyle)
 
 	// Стиль для ячеек с кодом (выравнивание по левому краю)
 	leftAlignStyle, _ := f.NewStyle(&excelize.Style{
@@ -161,15 +163,23 @@ func (p *HankookProcessor) CreateExcelReport(items []models.StockItem) (*exceliz
 		"C": 15, // Brand
 		"D": 10, // Season
 		"E": 12, // Quantity
+		"F": 16, // Production Year
 	}
 	for col, width := range colWidths {
 		f.SetColWidth("Hankook Report", col, col, width)
 	}
 
+	// Сводный лист по бренду, сезону и диаметру
+	if err := p.writeSummarySheet(f, hankookItems); err != nil {
+		return nil, fmt.Errorf("ошибка создания сводного листа: %v", err)
+	}
+	index, _ = f.GetSheetIndex("Hankook Report")
+	f.SetActiveSheet(index)
+
 	return f, nil
 }
 
-// GenerateFilename генерирует имя файла
-func (p *HankookProcessor) GenerateFilename() string {
-	return fmt.Sprintf("Hankook_Report_%s.xlsx", time.Now().Format("20060102_150405"))
+// GenerateFilename генерирует имя файла для отчета на дату остатков
+func (p *HankookProcessor) GenerateFilename(reportDate time.Time) string {
+	return fmt.Sprintf("Hankook_Report_%s.xlsx", reportDate.Format("20060102"))
 }
@@ -0,0 +1,200 @@
+package processors
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+
+	"sending-stocks/models"
+)
+
+// hankookSummarySheet сводный лист отчета Hankook
+const hankookSummarySheet = "Summary"
+
+// hankookRimSheet скрытый вспомогательный лист с посадочным диаметром строк листа Hankook Report
+// (колонку на сам лист не добавляем - его формат загружает Hankook)
+const hankookRimSheet = "Rim"
+
+// hankookSeason сезон позиции в отчете Hankook (пусто - сезон не определен)
+func hankookSeason(item models.StockItem) string {
+	switch item.Season {
+	case "лето":
+		return "Summer"
+	case "зима":
+		return "Winter"
+	}
+	return ""
+}
+
+// sumifsCriterion условие SUMIFS: точное совпадение текста, пустая строка - пустая ячейка
+func sumifsCriterion(value string) string {
+	if value == "" {
+		return `"="`
+	}
+	return `"` + strings.ReplaceAll(value, `"`, `""`) + `"`
+}
+
+// brandOrder порядок бренда в отчете: по списку HANKOOK_BRANDS, остальные - в конце
+func (p *HankookProcessor) brandOrder(brand string) int {
+	brandLower := strings.ToLower(brand)
+	for i, hb := range p.HankookBrands {
+		if strings.EqualFold(hb, brand) || strings.Contains(brandLower, strings.ToLower(hb)) {
+			return i
+		}
+	}
+	return len(p.HankookBrands)
+}
+
+// writeSummarySheet добавляет сводный лист: строки бренд × сезон с итогом по бренду, колонки - посадочные
+// диаметры. Остатки - формулы SUMIFS по листу Hankook Report (items - его строки по порядку, начиная со
+// второй) и скрытому листу Rim, поэтому итоги всегда совпадают с детальным листом
+func (p *HankookProcessor) writeSummarySheet(f *excelize.File, items []models.StockItem) error {
+	if _, err := f.NewSheet(hankookSummarySheet); err != nil {
+		return err
+	}
+	if _, err := f.NewSheet(hankookRimSheet); err != nil {
+		return err
+	}
+	if err := f.SetSheetVisible(hankookRimSheet, false); err != nil {
+		return err
+	}
+	f.SetCellValue(hankookRimSheet, "A1", "Rim")
+
+	// Бренды, сезоны по брендам и диаметры, встречающиеся в отчете. SUMIFS не различает регистр,
+	// поэтому бренды, отличающиеся только регистром, сводятся в одну строку
+	brands := make([]string, 0)
+	seasons := make(map[string]map[string]bool)
+	rimSet := make(map[string]bool)
+	for i, item := range items {
+		key := strings.ToLower(item.CleanBrand)
+		if seasons[key] == nil {
+			seasons[key] = make(map[string]bool)
+			brands = append(brands, item.CleanBrand)
+		}
+		rim := RimDiameter(item)
+		seasons[key][hankookSeason(item)] = true
+		rimSet[rim] = true
+		f.SetCellStr(hankookRimSheet, fmt.Sprintf("A%d", i+2), rim)
+	}
+	sort.SliceStable(brands, func(i, j int) bool {
+		oi, oj := p.brandOrder(brands[i]), p.brandOrder(brands[j])
+		if oi != oj {
+			return oi < oj
+		}
+		return brands[i] < brands[j]
+	})
+	rims := make([]string, 0, len(rimSet))
+	for rim := range rimSet {
+		rims = append(rims, rim)
+	}
+	sort.Slice(rims, func(i, j int) bool { return rimLess(rims[i], rims[j]) })
+
+	// Заголовки: Brand, Season, диаметры, Total
+	f.SetCellValue(hankookSummarySheet, "A1", "Brand")
+	f.SetCellValue(hankookSummarySheet, "B1", "Season")
+	for i, rim := range rims {
+		cell, _ := excelize.CoordinatesToCellName(i+3, 1)
+		if rim == "" {
+			rim = "Unknown"
+		}
+		f.SetCellValue(hankookSummarySheet, cell, rim)
+	}
+	firstRimCol, _ := excelize.ColumnNumberToName(3)
+	lastRimCol, _ := excelize.ColumnNumberToName(len(rims) + 2)
+	totalCol, _ := excelize.ColumnNumberToName(len(rims) + 3)
+	f.SetCellValue(hankookSummarySheet, totalCol+"1", "Total")
+
+	// Диапазоны строк детального листа
+	lastRow := max(len(items)+1, 2)
+	detail := func(sheet, col string) string {
+		return fmt.Sprintf("'%s'!$%s$2:$%s$%d", sheet, col, col, lastRow)
+	}
+
+	subtotalStyle, _ := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{
+			Bold: true,
+		},
+		Fill: excelize.Fill{
+			Type:    "pattern",
+			Color:   []string{"#F2F2F2"},
+			Pattern: 1,
+		},
+	})
+
+	row := 2
+	subtotalRows := make([]string, 0, len(brands))
+	for _, brand := range brands {
+		firstRow := row
+		for _, season := range []string{"Summer", "Winter", ""} {
+			if !seasons[strings.ToLower(brand)][season] {
+				continue
+			}
+			f.SetCellValue(hankookSummarySheet, fmt.Sprintf("A%d", row), brand)
+			label := season
+			if label == "" {
+				label = "Unknown"
+			}
+			f.SetCellValue(hankookSummarySheet, fmt.Sprintf("B%d", row), label)
+
+			for i, rim := range rims {
+				cell, _ := excelize.CoordinatesToCellName(i+3, row)
+				f.SetCellFormula(hankookSummarySheet, cell, fmt.Sprintf("=SUMIFS(%s,%s,%s,%s,%s,%s,%s)",
+					detail("Hankook Report", "E"),
+					detail("Hankook Report", "C"), sumifsCriterion(brand),
+					detail("Hankook Report", "D"), sumifsCriterion(season),
+					detail(hankookRimSheet, "A"), sumifsCriterion(rim)))
+			}
+			f.SetCellFormula(hankookSummarySheet, fmt.Sprintf("%s%d", totalCol, row),
+				fmt.Sprintf("=SUM(%s%d:%s%d)", firstRimCol, row, lastRimCol, row))
+			row++
+		}
+
+		// Итог по бренду
+		f.SetCellValue(hankookSummarySheet, fmt.Sprintf("A%d", row), brand+" Total")
+		for i := 0; i <= len(rims); i++ {
+			col, _ := excelize.ColumnNumberToName(i + 3)
+			f.SetCellFormula(hankookSummarySheet, fmt.Sprintf("%s%d", col, row),
+				fmt.Sprintf("=SUM(%s%d:%s%d)", col, firstRow, col, row-1))
+		}
+		f.SetCellStyle(hankookSummarySheet, fmt.Sprintf("A%d", row), fmt.Sprintf("%s%d", totalCol, row), subtotalStyle)
+		subtotalRows = append(subtotalRows, fmt.Sprintf("%d", row))
+		row++
+	}
+
+	// Общий итог - сумма итогов по брендам
+	f.SetCellValue(hankookSummarySheet, fmt.Sprintf("A%d", row), "Grand Total")
+	for i := 0; i <= len(rims); i++ {
+		col, _ := excelize.ColumnNumberToName(i + 3)
+		cells := make([]string, 0, len(subtotalRows))
+		for _, r := range subtotalRows {
+			cells = append(cells, col+r)
+		}
+		formula := "=0"
+		if len(cells) > 0 {
+			formula = "=SUM(" + strings.Join(cells, ",") + ")"
+		}
+		f.SetCellFormula(hankookSummarySheet, fmt.Sprintf("%s%d", col, row), formula)
+	}
+
+	headerStyle, _ := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{
+			Bold: true,
+			Size: 12,
+		},
+		Fill: excelize.Fill{
+			Type:    "pattern",
+			Color:   []string{"#E0E0E0"},
+			Pattern: 1,
+		},
+	})
+	f.SetCellStyle(hankookSummarySheet, "A1", totalCol+"1", headerStyle)
+	f.SetCellStyle(hankookSummarySheet, fmt.Sprintf("A%d", row), fmt.Sprintf("%s%d", totalCol, row), headerStyle)
+
+	f.SetColWidth(hankookSummarySheet, "A", "A", 18)
+	f.SetColWidth(hankookSummarySheet, "B", "B", 10)
+	f.SetColWidth(hankookSummarySheet, firstRimCol, totalCol, 9)
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package processors
+
+import (
+	"testing"
+
+	"sending-stocks/models"
+)
+
+func TestHankookSummaryFormulas(t *testing.T) {
+	p := NewHankookProcessor([]string{"Hankook", "Laufenn"})
+	items := []models.StockItem{
+		{Name: "Hankook Ventus 205/55 R16", CleanBrand: "Hankook", Season: "лето", TireSize: "205/55 R16", Quantity: 4},
+		{Name: "Hankook Ventus 225/45 R17", CleanBrand: "Hankook", Season: "лето", TireSize: "225/45 R17", Quantity: 2},
+		{Name: "Laufenn I Fit", CleanBrand: "Laufenn", Season: "зима", TireSize: "205/55 R16", Quantity: 8},
+		{Name: "Laufenn S Fit", CleanBrand: "Laufenn", Quantity: 1},
+		{Name: "Cordiant Comfort 2", CleanBrand: "Cordiant", Season: "лето", TireSize: "205/55 R16", Quantity: 5},
+	}
+
+	f, err := p.CreateExcelReport(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// Детальный лист не меняет формат: диаметр только на скрытом листе
+	if got, _ := f.GetCellValue("Hankook Report", "F1"); got != "" {
+		t.Errorf("на листе Hankook Report лишняя колонка %q", got)
+	}
+	if visible, _ := f.GetSheetVisible(hankookRimSheet); visible {
+		t.Error("лист Rim не скрыт")
+	}
+
+	// Summary: A Brand, B Season, C R16, D R17, E Unknown, F Total
+	tests := []struct {
+		cell    string
+		want    string
+		formula bool
+	}{
+		{"A2", "Hankook", false},
+		{"C2", "4", true},
+		{"D2", "2", true},
+		{"F2", "6", true},
+		{"A3", "Hankook Total", false},
+		{"A4", "Laufenn", false},
+		{"B4", "Winter", false},
+		{"C4", "8", true},
+		{"B5", "Unknown", false},
+		{"E5", "1", true},
+		{"F6", "9", true},
+		{"A7", "Grand Total", false},
+		{"C7", "12", true},
+		{"F7", "15", true},
+	}
+	for _, tt := range tests {
+		if tt.formula {
+			if formula, _ := f.GetCellFormula(hankookSummarySheet, tt.cell); formula == "" {
+				t.Errorf("%s: не формула", tt.cell)
+			}
+			got, err := f.CalcCellValue(hankookSummarySheet, tt.cell)
+			if err != nil {
+				t.Errorf("%s: %v", tt.cell, err)
+			} else if got != tt.want {
+				t.Errorf("%s = %q, ожидалось %q", tt.cell, got, tt.want)
+			}
+			continue
+		}
+		if got, _ := f.GetCellValue(hankookSummarySheet, tt.cell); got != tt.want {
+			t.Errorf("%s = %q, ожидалось %q", tt.cell, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package processors
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReportDateLayout формат даты отчета в ProcessedFile
+const ReportDateLayout = "2006-01-02"
+
+var (
+	// "на 15.10.2026", "по 15.10.2026", "01.10.2026 - 15.10.2026"
+	headerDatePattern = regexp.MustCompile(`(\d{1,2})\.(\d{1,2})\.(\d{4})`)
+	// "на 15 октября 2026 г."
+	headerTextDatePattern = regexp.MustCompile(`(?i)(\d{1,2})\s+(января|февраля|марта|апреля|мая|июня|июля|августа|сентября|октября|ноября|декабря)\s+(\d{4})`)
+	// "Организация: ИП Семисотнов", "Организация Равно \"ИП Семисотнов\""
+	headerOrgPattern = regexp.MustCompile(`(?i)организаци[яи]\s*(?:равно|=|:)?\s*(.*)$`)
+)
+
+var russianMonths = map[string]time.Month{
+	"января": time.January, "февраля": time.February, "марта": time.March,
+	"апреля": time.April, "мая": time.May, "июня": time.June,
+	"июля": time.July, "августа": time.August, "сентября": time.September,
+	"октября": time.October, "ноября": time.November, "декабря": time.December,
+}
+
+// parseReportHeader ищет в шапке ведомости (строки выше данных) дату отчета и организацию.
+// Если указан период, берется его конечная дата. Даты строятся в часовом поясе loc
+func parseReportHeader(rows [][]string, loc *time.Location) (reportDate time.Time, organization string) {
+	for _, row := range rows {
+		for i, cell := range row {
+			text := strings.TrimSpace(cell)
+			if text == "" {
+				continue
+			}
+
+			// Дата формирования/печати отчета - не дата остатков
+			lower := strings.ToLower(text)
+			if !strings.Contains(lower, "сформир") && !strings.Contains(lower, "печат") {
+				for _, d := range headerDates(text, loc) {
+					if d.After(reportDate) {
+						reportDate = d
+					}
+				}
+			}
+
+			if organization == "" {
+				if m := headerOrgPattern.FindStringSubmatch(text); m != nil {
+					organization = cleanOrganization(m[1])
+					// Название в соседней ячейке: "Организация:" | "ИП Семисотнов"
+					for j := i + 1; organization == "" && j < len(row); j++ {
+						organization = cleanOrganization(row[j])
+					}
+				}
+			}
+		}
+	}
+	return reportDate, organization
+}
+
+// headerDates возвращает все даты из текста ячейки шапки
+func headerDates(text string, loc *time.Location) []time.Time {
+	result := make([]time.Time, 0)
+
+	for _, m := range headerDatePattern.FindAllStringSubmatch(text, -1) {
+		day, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[2])
+		year, _ := strconv.Atoi(m[3])
+		if d, ok := validDate(year, time.Month(month), day, loc); ok {
+			result = append(result, d)
+		}
+	}
+
+	for _, m := range headerTextDatePattern.FindAllStringSubmatch(text, -1) {
+		day, _ := strconv.Atoi(m[1])
+		year, _ := strconv.Atoi(m[3])
+		if d, ok := validDate(year, russianMonths[strings.ToLower(m[2])], day, loc); ok {
+			result = append(result, d)
+		}
+	}
+
+	return result
+}
+
+// validDate собирает дату, отбрасывая несуществующие (31.02) и явно ошибочные годы
+func validDate(year int, month time.Month, day int, loc *time.Location) (time.Time, bool) {
+	if year < 2000 || year > 2100 || month < time.January || month > time.December {
+		return time.Time{}, false
+	}
+	d := time.Date(year, month, day, 0, 0, 0, 0, loc)
+	if d.Day() != day || d.Month() != month {
+		return time.Time{}, false
+	}
+	return d, true
+}
+
+// cleanOrganization убирает кавычки и служебные слова отбора 1С вокруг названия организации.
+// Для отбора вида "ИП Семисотнов" И Склад Равно "Основной" берется первое значение в кавычках
+func cleanOrganization(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.EqualFold(s, "Равно") {
+		return ""
+	}
+
+	if strings.IndexAny(s, `"«“`) == 0 {
+		rest := s[len(string([]rune(s)[0])):]
+		if end := strings.IndexAny(rest, `"»”`); end >= 0 {
+			return strings.TrimSpace(rest[:end])
+		}
+	}
+	return strings.Trim(s, `"«»“” `)
+}
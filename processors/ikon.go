@@ -1,7 +1,9 @@
 package processors
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 	"strings"
 	"time"
 
@@ -10,31 +12,197 @@ import (
 	"sending-stocks/models"
 )
 
-// IkonConfig конфигурация для отчета Ikon
-type IkonConfig struct {
-	CompanyName   string
-	SummerGroups  map[string][]string // ключ - колонка, значение - список брендов
-	WinterGroups  map[string][]string // ключ - колонка, значение - список брендов
-	SummerExclude []string            // бренды, исключаемые из SUMMER C total
-	WinterExclude []string            // бренды, исключаемые из WINTER C total
+// Типы колонок отчета Ikon
+const (
+	IkonColumnClient      = "client"       // название клиента
+	IkonColumnGroup       = "group"        // остаток группы брендов за сезон
+	IkonColumnSeasonTotal = "season_total" // весь остаток сезона, кроме брендов exclude
+	IkonColumnAll         = "all"          // все остатки клиента, кроме брендов exclude
+	IkonColumnSum         = "sum"          // формула SUM по колонкам sum
+)
+
+// IkonColumn колонка отчета Ikon
+type IkonColumn struct {
+	ID      string   `json:"id"`                // идентификатор для ссылок из sum
+	Caption string   `json:"caption"`           // заголовок колонки
+	Type    string   `json:"type"`              // client, group, season_total, all, sum
+	Season  string   `json:"season,omitempty"`  // сезон позиции (лето, зима) для group и season_total
+	Brands  []string `json:"brands,omitempty"`  // бренды группы (group)
+	Exclude []string `json:"exclude,omitempty"` // бренды, не учитываемые в season_total и all
+	Sum     []string `json:"sum,omitempty"`     // идентификаторы суммируемых колонок (sum)
+	Width   float64  `json:"width,omitempty"`   // ширина колонки (0 - по умолчанию)
+}
+
+// IkonLayout раскладка отчета Ikon: колонки слева направо и строки клиентов
+type IkonLayout struct {
+	Columns []IkonColumn `json:"columns"`
+	Clients []IkonClient `json:"clients,omitempty"` // пусто - одна строка IKON_COMPANY_NAME
+}
+
+// IkonGroup группа брендов для раскладки по умолчанию
+type IkonGroup struct {
+	Caption string
+	Brands  []string
+	Width   float64
+}
+
+// DefaultIkonLayout раскладка по умолчанию (как в шаблоне Ikon): летние группы, SUMMER total,
+// SUMMER C total, зимние группы, WINTER total, WINTER C total, TOTAL и все остатки клиента
+func DefaultIkonLayout(summerGroups, winterGroups []IkonGroup, summerExclude, winterExclude []string) IkonLayout {
+	columns := []IkonColumn{{ID: "client", Caption: "Клиент", Type: IkonColumnClient, Width: 20}}
+
+	seasonColumns := func(prefix, season, caption string, groups []IkonGroup, exclude []string) {
+		ids := make([]string, 0, len(groups))
+		for i, group := range groups {
+			id := fmt.Sprintf("%s_%d", prefix, i+1)
+			ids = append(ids, id)
+			columns = append(columns, IkonColumn{ID: id, Caption: group.Caption, Type: IkonColumnGroup, Season: season, Brands: group.Brands, Width: group.Width})
+		}
+		columns = append(columns,
+			IkonColumn{ID: prefix + "_total", Caption: caption + " total", Type: IkonColumnSum, Sum: ids, Width: 15},
+			IkonColumn{ID: prefix + "_c_total", Caption: caption + " C total", Type: IkonColumnSeasonTotal, Season: season, Exclude: exclude, Width: 18},
+		)
+	}
+	seasonColumns("summer", "лето", "SUMMER", summerGroups, summerExclude)
+	seasonColumns("winter", "зима", "WINTER", winterGroups, winterExclude)
+
+	columns = append(columns,
+		IkonColumn{ID: "total", Caption: "TOTAL", Type: IkonColumnSum, Sum: []string{"summer_total", "winter_total"}, Width: 10},
+		IkonColumn{ID: "all", Caption: "Все остатки клиента (по всем конкурентам и Нокиан в том числе)", Type: IkonColumnAll, Width: 40},
+	)
+	return IkonLayout{Columns: columns}
+}
+
+// LoadIkonLayout читает раскладку отчета из JSON файла
+func LoadIkonLayout(path string) (IkonLayout, error) {
+	var layout IkonLayout
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return layout, fmt.Errorf("не удалось прочитать файл раскладки Ikon: %v", err)
+	}
+	if err := json.Unmarshal(data, &layout); err != nil {
+		return layout, fmt.Errorf("ошибка разбора файла раскладки Ikon: %v", err)
+	}
+	return layout, nil
 }
 
 // IkonProcessor обработчик для Ikon
 type IkonProcessor struct {
-	config *IkonConfig
+	CompanyName string
+	Layout      IkonLayout
 }
 
-// NewIkonProcessor создает новый процессор
-func NewIkonProcessor(companyName string, summerGroups, winterGroups map[string][]string, summerExclude, winterExclude []string) *IkonProcessor {
+// NewIkonProcessor создает новый процессор и проверяет раскладку
+func NewIkonProcessor(companyName string, layout IkonLayout) (*IkonProcessor, error) {
+	if len(layout.Columns) == 0 {
+		return nil, fmt.Errorf("раскладка Ikon не содержит колонок")
+	}
+
+	ids := make(map[string]bool, len(layout.Columns))
+	for i, col := range layout.Columns {
+		if col.ID == "" {
+			return nil, fmt.Errorf("колонка %d (%s): не указан id", i+1, col.Caption)
+		}
+		if ids[col.ID] {
+			return nil, fmt.Errorf("колонка %s: id повторяется", col.ID)
+		}
+		ids[col.ID] = true
+
+		switch col.Type {
+		case IkonColumnClient, IkonColumnAll:
+		case IkonColumnGroup:
+			if col.Season == "" || len(col.Brands) == 0 {
+				return nil, fmt.Errorf("колонка %s: для группы нужны season и brands", col.ID)
+			}
+		case IkonColumnSeasonTotal:
+			if col.Season == "" {
+				return nil, fmt.Errorf("колонка %s: не указан season", col.ID)
+			}
+		case IkonColumnSum:
+			if len(col.Sum) == 0 {
+				return nil, fmt.Errorf("колонка %s: не указаны суммируемые колонки", col.ID)
+			}
+		default:
+			return nil, fmt.Errorf("колонка %s: неизвестный тип %q", col.ID, col.Type)
+		}
+	}
+
+	// Формулы ссылаются только на существующие числовые колонки
+	for _, col := range layout.Columns {
+		for _, ref := range col.Sum {
+			if !ids[ref] || ref == col.ID {
+				return nil, fmt.Errorf("колонка %s: неизвестная колонка %q в sum", col.ID, ref)
+			}
+			if layout.Columns[layout.index(ref)].Type == IkonColumnClient {
+				return nil, fmt.Errorf("колонка %s: колонка %q не числовая", col.ID, ref)
+			}
+		}
+	}
+	if err := layout.checkSumCycles(); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool, len(layout.Clients))
+	for i, client := range layout.Clients {
+		if client.Name == "" {
+			return nil, fmt.Errorf("клиент %d: не указано название", i+1)
+		}
+		if names[client.Name] {
+			return nil, fmt.Errorf("клиент %s: название повторяется", client.Name)
+		}
+		names[client.Name] = true
+	}
+
 	return &IkonProcessor{
-		config: &IkonConfig{
-			CompanyName:   companyName,
-			SummerGroups:  summerGroups,
-			WinterGroups:  winterGroups,
-			SummerExclude: summerExclude,
-			WinterExclude: winterExclude,
-		},
+		CompanyName: companyName,
+		Layout:      layout,
+	}, nil
+}
+
+// checkSumCycles проверяет, что формулы sum не ссылаются сами на себя через другие колонки
+// (иначе Excel получит циклическую ссылку)
+func (l IkonLayout) checkSumCycles() error {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int, len(l.Columns))
+
+	var visit func(id string, path []string) error
+	visit = func(id string, path []string) error {
+		path = append(path, id)
+		switch state[id] {
+		case visiting:
+			return fmt.Errorf("колонка %s: циклическая ссылка в sum (%s)", id, strings.Join(path, " → "))
+		case done:
+			return nil
+		}
+		state[id] = visiting
+		for _, ref := range l.Columns[l.index(id)].Sum {
+			if err := visit(ref, path); err != nil {
+				return err
+			}
+		}
+		state[id] = done
+		return nil
 	}
+
+	for _, col := range l.Columns {
+		if err := visit(col.ID, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// index номер колонки по идентификатору (-1 - нет такой колонки)
+func (l IkonLayout) index(id string) int {
+	for i, col := range l.Columns {
+		if col.ID == id {
+			return i
+		}
+	}
+	return -1
 }
 
 // isExcludedBrand проверяет, нужно ли исключить бренд из общей суммы
@@ -49,60 +217,95 @@ func (p *IkonProcessor) isExcludedBrand(brand string, excludeList []string) bool
 	return false
 }
 
-// CalculateSums вычисляет суммы по группам и общую сумму всех остатков
-func (p *IkonProcessor) CalculateSums(items []models.StockItem) (map[string]int, map[string]int, int, int, int) {
-	summerSums := make(map[string]int)
-	winterSums := make(map[string]int)
-	allBrandsTotal := 0
-	summerCTotal := 0
-	winterCTotal := 0
-
-	// Инициализируем суммы нулями
-	for col := range p.config.SummerGroups {
-		summerSums[col] = 0
-	}
-	for col := range p.config.WinterGroups {
-		winterSums[col] = 0
+// CalculateSums вычисляет значения числовых колонок (кроме формул sum) по идентификатору колонки.
+// Позиция попадает в первую подходящую группу своего сезона
+func (p *IkonProcessor) CalculateSums(items []models.StockItem) map[string]int {
+	sums := make(map[string]int)
+	for _, col := range p.Layout.Columns {
+		if col.Type != IkonColumnClient && col.Type != IkonColumnSum {
+			sums[col.ID] = 0
+		}
 	}
 
-	// Суммируем по каждой позиции
 	for _, item := range items {
-		// Проверяем только позиции с количеством
-		if item.Quantity <= 0 {
-			continue
+		for _, id := range p.itemColumns(item) {
+			sums[id] += item.Quantity
 		}
+	}
 
-		// Добавляем в общую сумму всех брендов (ВСЕ остатки)
-		allBrandsTotal += item.Quantity
+	return sums
+}
 
-		// SUMMER C total - все летние остатки, кроме исключенных брендов
-		if item.Season == "лето" && !p.isExcludedBrand(item.CleanBrand, p.config.SummerExclude) {
-			summerCTotal += item.Quantity
-		}
+// itemColumns идентификаторы колонок, в которые входит остаток позиции
+func (p *IkonProcessor) itemColumns(item models.StockItem) []string {
+	// Проверяем только позиции с количеством
+	if item.Quantity <= 0 {
+		return nil
+	}
 
-		// WINTER C total - все зимние остатки, кроме исключенных брендов
-		if item.Season == "зима" && !p.isExcludedBrand(item.CleanBrand, p.config.WinterExclude) {
-			winterCTotal += item.Quantity
+	ids := make([]string, 0)
+	grouped := make(map[string]bool) // сезоны, в которых позиция уже учтена группой
+	for _, col := range p.Layout.Columns {
+		switch col.Type {
+		case IkonColumnAll:
+			if !p.isExcludedBrand(item.CleanBrand, col.Exclude) {
+				ids = append(ids, col.ID)
+			}
+		case IkonColumnSeasonTotal:
+			if item.Season == col.Season && !p.isExcludedBrand(item.CleanBrand, col.Exclude) {
+				ids = append(ids, col.ID)
+			}
+		case IkonColumnGroup:
+			if item.Season == col.Season && !grouped[col.Season] && p.itemInGroups(item, col.Brands) {
+				ids = append(ids, col.ID)
+				grouped[col.Season] = true
+			}
 		}
+	}
+	return ids
+}
 
-		// Проверяем летние группы
-		for col, brands := range p.config.SummerGroups {
-			if p.itemInGroups(item, brands) && item.Season == "лето" {
-				summerSums[col] += item.Quantity
-				break
-			}
+// Values значения всех числовых колонок по идентификатору, сложенные по всем клиентам
+// (включая колонки sum - как их посчитает Excel)
+func (p *IkonProcessor) Values(items []models.StockItem) map[string]int {
+	values := make(map[string]int)
+	for _, client := range p.Clients() {
+		for id, sum := range p.CalculateSums(p.ClientItems(items, client)) {
+			values[id] += sum
 		}
+	}
 
-		// Проверяем зимние группы
-		for col, brands := range p.config.WinterGroups {
-			if p.itemInGroups(item, brands) && item.Season == "зима" {
-				winterSums[col] += item.Quantity
-				break
-			}
+	var resolve func(col IkonColumn, depth int) int
+	resolve = func(col IkonColumn, depth int) int {
+		if col.Type != IkonColumnSum {
+			return values[col.ID]
+		}
+		total := 0
+		if depth > len(p.Layout.Columns) { // циклическая ссылка
+			return total
 		}
+		for _, ref := range col.Sum {
+			total += resolve(p.Layout.Columns[p.Layout.index(ref)], depth+1)
+		}
+		return total
 	}
+	for _, col := range p.Layout.Columns {
+		if col.Type == IkonColumnSum {
+			values[col.ID] = resolve(col, 0)
+		}
+	}
+	return values
+}
 
-	return summerSums, winterSums, allBrandsTotal, summerCTotal, winterCTotal
+// AllBrandsTotal общий остаток по всем брендам (для текста письма)
+func (p *IkonProcessor) AllBrandsTotal(items []models.StockItem) int {
+	total := 0
+	for _, item := range items {
+		if item.Quantity > 0 {
+			total += item.Quantity
+		}
+	}
+	return total
 }
 
 // itemInGroups проверяет, относится ли позиция к одной из групп брендов
@@ -117,7 +320,31 @@ func (p *IkonProcessor) itemInGroups(item models.StockItem, brands []string) boo
 	return false
 }
 
-// CreateReport создает Excel отчет
+// ExclusionReason возвращает причину, по которой позиция брендов групп Ikon не учтена в отчете
+func (p *IkonProcessor) ExclusionReason(item models.StockItem) string {
+	inGroups := false
+	for _, col := range p.Layout.Columns {
+		if col.Type == IkonColumnGroup && p.itemInGroups(item, col.Brands) {
+			inGroups = true
+		}
+	}
+	if !inGroups {
+		return ""
+	}
+	if item.Quantity <= 0 {
+		return "нет остатка"
+	}
+	if !p.inAnyClient(item) {
+		return "склад или файл не относится ни к одному клиенту"
+	}
+	if item.Season == "" {
+		return "не определен сезон, учтено только во «Все остатки»"
+	}
+	return ""
+}
+
+// CreateReport создает Excel отчет по раскладке: строка заголовков, по строке на клиента
+// и строка «Итого», если клиентов несколько; на втором листе - позиции, из которых сложены цифры
 func (p *IkonProcessor) CreateReport(items []models.StockItem) (*excelize.File, error) {
 	f := excelize.NewFile()
 	defer func() {
@@ -126,61 +353,56 @@ func (p *IkonProcessor) CreateReport(items []models.StockItem) (*excelize.File,
 		}
 	}()
 
+	const sheet = "Sheet1"
+
 	// Создаем лист
-	index, _ := f.NewSheet("Sheet1")
+	index, _ := f.NewSheet(sheet)
 	f.SetActiveSheet(index)
 
-	// Удаляем лист по умолчанию
-	f.DeleteSheet("Sheet1")
+	clients := p.Clients()
+	lastCol, _ := excelize.ColumnNumberToName(len(p.Layout.Columns))
 
 	// Заголовки
-	f.SetCellValue("Sheet1", "A1", "Клиент")
-	f.SetCellValue("Sheet1", "B1", "Summer A")
-	f.SetCellValue("Sheet1", "C1", "Summer B")
-	f.SetCellValue("Sheet1", "D1", "Bars")
-	f.SetCellValue("Sheet1", "E1", "Attar")
-	f.SetCellValue("Sheet1", "F1", "SUMMER total")
-	f.SetCellValue("Sheet1", "G1", "SUMMER C total")
-	f.SetCellValue("Sheet1", "H1", "Winter A")
-	f.SetCellValue("Sheet1", "I1", "Winter B")
-	f.SetCellValue("Sheet1", "J1", "Attar")
-	f.SetCellValue("Sheet1", "K1", "WINTER total")
-	f.SetCellValue("Sheet1", "L1", "WINTER C total")
-	f.SetCellValue("Sheet1", "M1", "TOTAL")
-	f.SetCellValue("Sheet1", "N1", "Все остатки клиента (по всем конкурентам и Нокиан в том числе)")
-
-	// Название компании в A2
-	f.SetCellValue("Sheet1", "A2", p.config.CompanyName)
-
-	// Вычисляем суммы
-	summerSums, winterSums, allBrandsTotal, summerCTotal, winterCTotal := p.CalculateSums(items)
-
-	// Заполняем суммы по группам
-	f.SetCellValue("Sheet1", "B2", summerSums["B"])
-	f.SetCellValue("Sheet1", "C2", summerSums["C"])
-	f.SetCellValue("Sheet1", "D2", summerSums["D"])
-	f.SetCellValue("Sheet1", "E2", summerSums["E"])
-
-	f.SetCellValue("Sheet1", "H2", winterSums["H"])
-	f.SetCellValue("Sheet1", "I2", winterSums["I"])
-	f.SetCellValue("Sheet1", "J2", winterSums["J"])
-
-	// Заполняем новые колонки
-	f.SetCellValue("Sheet1", "G2", summerCTotal)
-	f.SetCellValue("Sheet1", "L2", winterCTotal)
-
-	// Формулы
-	summerTotalFormula := "=SUM(B2:E2)"
-	f.SetCellFormula("Sheet1", "F2", summerTotalFormula)
-
-	winterTotalFormula := "=SUM(H2:J2)"
-	f.SetCellFormula("Sheet1", "K2", winterTotalFormula)
-
-	totalFormula := "=SUM(F2,K2)"
-	f.SetCellFormula("Sheet1", "M2", totalFormula)
-
-	// N2 - все остатки по всем брендам
-	f.SetCellValue("Sheet1", "N2", allBrandsTotal)
+	for i, col := range p.Layout.Columns {
+		name, _ := excelize.ColumnNumberToName(i + 1)
+		f.SetCellValue(sheet, name+"1", col.Caption)
+		if col.Width > 0 {
+			f.SetColWidth(sheet, name, name, col.Width)
+		}
+	}
+
+	// Строки клиентов
+	for r, client := range clients {
+		row := r + 2
+		sums := p.CalculateSums(p.ClientItems(items, client))
+		for i, col := range p.Layout.Columns {
+			name, _ := excelize.ColumnNumberToName(i + 1)
+			cell := fmt.Sprintf("%s%d", name, row)
+			switch col.Type {
+			case IkonColumnClient:
+				f.SetCellValue(sheet, cell, client.Name)
+			case IkonColumnSum:
+				f.SetCellFormula(sheet, cell, p.sumFormula(col, row))
+			default:
+				f.SetCellValue(sheet, cell, sums[col.ID])
+			}
+		}
+	}
+	lastRow := len(clients) + 1
+
+	// Итоговая строка по всем клиентам
+	if len(clients) > 1 {
+		lastRow++
+		for i, col := range p.Layout.Columns {
+			name, _ := excelize.ColumnNumberToName(i + 1)
+			cell := fmt.Sprintf("%s%d", name, lastRow)
+			if col.Type == IkonColumnClient {
+				f.SetCellValue(sheet, cell, "Итого")
+				continue
+			}
+			f.SetCellFormula(sheet, cell, fmt.Sprintf("=SUM(%s2:%s%d)", name, name, lastRow-1))
+		}
+	}
 
 	// Стили для заголовков
 	headerStyle, _ := f.NewStyle(&excelize.Style{
@@ -194,7 +416,7 @@ func (p *IkonProcessor) CreateReport(items []models.StockItem) (*excelize.File,
 			Pattern: 1,
 		},
 	})
-	f.SetCellStyle("Sheet1", "A1", "N1", headerStyle)
+	f.SetCellStyle(sheet, "A1", lastCol+"1", headerStyle)
 
 	// Стиль для компании
 	companyStyle, _ := f.NewStyle(&excelize.Style{
@@ -203,7 +425,6 @@ func (p *IkonProcessor) CreateReport(items []models.StockItem) (*excelize.File,
 			Size: 11,
 		},
 	})
-	f.SetCellStyle("Sheet1", "A2", "A2", companyStyle)
 
 	// Стиль для чисел (выравнивание по центру)
 	numberStyle, _ := f.NewStyle(&excelize.Style{
@@ -211,23 +432,66 @@ func (p *IkonProcessor) CreateReport(items []models.StockItem) (*excelize.File,
 			Horizontal: "center",
 		},
 	})
-	f.SetCellStyle("Sheet1", "B2", "N2", numberStyle)
 
-	// Устанавливаем ширину колонок
-	colWidths := map[string]float64{
-		"A": 20, "B": 12, "C": 12, "D": 10, "E": 10,
-		"F": 15, "G": 18,
-		"H": 12, "I": 12, "J": 10, "K": 15, "L": 18,
-		"M": 10, "N": 40,
+	// Стиль итоговой строки
+	totalStyle, _ := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{
+			Bold: true,
+		},
+		Alignment: &excelize.Alignment{
+			Horizontal: "center",
+		},
+	})
+
+	for i, col := range p.Layout.Columns {
+		name, _ := excelize.ColumnNumberToName(i + 1)
+		style := numberStyle
+		if col.Type == IkonColumnClient {
+			style = companyStyle
+		}
+		f.SetCellStyle(sheet, name+"2", fmt.Sprintf("%s%d", name, len(clients)+1), style)
 	}
-	for col, width := range colWidths {
-		f.SetColWidth("Sheet1", col, col, width)
+	if len(clients) > 1 {
+		f.SetCellStyle(sheet, fmt.Sprintf("A%d", lastRow), fmt.Sprintf("%s%d", lastCol, lastRow), totalStyle)
 	}
 
+	// Расшифровка сводных цифр на отдельном листе
+	if err := p.writeDetailSheet(f, items); err != nil {
+		return nil, fmt.Errorf("ошибка создания листа детализации: %v", err)
+	}
+	f.SetActiveSheet(index)
+
 	return f, nil
 }
 
-// GenerateFilename генерирует имя файла
-func (p *IkonProcessor) GenerateFilename() string {
-	return fmt.Sprintf("Ikon_Report_%s.xlsx", time.Now().Format("20060102_150405"))
+// sumFormula формула колонки sum для строки: соседние колонки объединяются в диапазон (=SUM(B2:E2)),
+// остальные перечисляются (=SUM(F2,K2))
+func (p *IkonProcessor) sumFormula(col IkonColumn, row int) string {
+	numbers := make([]int, 0, len(col.Sum))
+	for _, ref := range col.Sum {
+		numbers = append(numbers, p.Layout.index(ref)+1)
+	}
+
+	parts := make([]string, 0, len(numbers))
+	for i := 0; i < len(numbers); {
+		j := i
+		for j+1 < len(numbers) && numbers[j+1] == numbers[j]+1 {
+			j++
+		}
+		from, _ := excelize.ColumnNumberToName(numbers[i])
+		if j > i {
+			to, _ := excelize.ColumnNumberToName(numbers[j])
+			parts = append(parts, fmt.Sprintf("%s%d:%s%d", from, row, to, row))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s%d", from, row))
+		}
+		i = j + 1
+	}
+
+	return "=SUM(" + strings.Join(parts, ",") + ")"
+}
+
+// GenerateFilename генерирует имя файла для отчета на дату остатков
+func (p *IkonProcessor) GenerateFilename(reportDate time.Time) string {
+	return fmt.Sprintf("Ikon_Report_%s.xlsx", reportDate.Format("20060102"))
 }
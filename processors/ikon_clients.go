@@ -0,0 +1,121 @@
+package processors
+
+import (
+	"strings"
+
+	"sending-stocks/models"
+)
+
+// IkonClient клиент (юрлицо) - отдельная строка отчета Ikon. Остатки клиента берутся из его
+// загрузок (sources - имена файлов объединенного снимка) и/или складов (sheets - листы ведомости).
+// Если не указано ни то, ни другое, клиенту относятся все остатки, не отнесенные клиентам выше.
+// Остаток, подходящий нескольким клиентам, относится к первому из них по порядку строк
+type IkonClient struct {
+	Name    string   `json:"name"`
+	Sources []string `json:"sources,omitempty"`
+	Sheets  []string `json:"sheets,omitempty"`
+}
+
+// matches проверяет, относится ли файл и лист к клиенту
+func (c IkonClient) matches(source, sheet string) bool {
+	if len(c.Sources) > 0 && !containsFold(c.Sources, source) {
+		return false
+	}
+	if len(c.Sheets) > 0 && !containsFold(c.Sheets, sheet) {
+		return false
+	}
+	return true
+}
+
+// containsFold проверяет наличие значения в списке без учета регистра и пробелов по краям
+func containsFold(list []string, value string) bool {
+	value = strings.TrimSpace(value)
+	for _, v := range list {
+		if strings.EqualFold(strings.TrimSpace(v), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Clients клиенты отчета: из раскладки или один клиент IKON_COMPANY_NAME со всеми остатками
+func (p *IkonProcessor) Clients() []IkonClient {
+	if len(p.Layout.Clients) > 0 {
+		return p.Layout.Clients
+	}
+	return []IkonClient{{Name: p.CompanyName}}
+}
+
+// owns проверяет, что файл и лист относятся к клиенту, а не к клиенту выше по порядку строк,
+// чтобы один остаток не попал в отчет дважды
+func (p *IkonProcessor) owns(client IkonClient, source, sheet string) bool {
+	for _, c := range p.Clients() {
+		if c.matches(source, sheet) {
+			return c.Name == client.Name
+		}
+	}
+	return false
+}
+
+// ClientItems позиции клиента. У позиции объединенного снимка остаток берется только
+// из источников клиента, позиции без остатка у клиента пропускаются
+func (p *IkonProcessor) ClientItems(items []models.StockItem, client IkonClient) []models.StockItem {
+	if len(p.Clients()) == 1 && len(client.Sources) == 0 && len(client.Sheets) == 0 {
+		return items
+	}
+
+	result := make([]models.StockItem, 0)
+	for _, item := range items {
+		if len(item.Sources) == 0 {
+			if p.owns(client, item.Source, item.Sheet) {
+				result = append(result, item)
+			}
+			continue
+		}
+
+		quantity := 0
+		sources := make([]models.StockSource, 0, len(item.Sources))
+		for _, src := range item.Sources {
+			if p.owns(client, src.Source, src.Sheet) {
+				quantity += src.Quantity
+				sources = append(sources, src)
+			}
+		}
+		if len(sources) == 0 {
+			continue
+		}
+		item.Quantity = quantity
+		item.Sources = sources
+		result = append(result, item)
+	}
+	return result
+}
+
+// inAnyClient проверяет, относится ли позиция хотя бы к одному клиенту
+func (p *IkonProcessor) inAnyClient(item models.StockItem) bool {
+	for _, client := range p.Clients() {
+		if len(p.ClientItems([]models.StockItem{item}, client)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// IkonClientTotal общий остаток клиента по всем брендам
+type IkonClientTotal struct {
+	Name  string `json:"name"`
+	Total int    `json:"total"`
+}
+
+// ClientTotals общие остатки по клиентам в порядке строк отчета
+func (p *IkonProcessor) ClientTotals(items []models.StockItem) []IkonClientTotal {
+	clients := p.Clients()
+	totals := make([]IkonClientTotal, 0, len(clients))
+	for _, client := range clients {
+		totals = append(totals, IkonClientTotal{
+			Name:  client.Name,
+			Total: p.AllBrandsTotal(p.ClientItems(items, client)),
+		})
+	}
+	return totals
+}
@@ -0,0 +1,140 @@
+package processors
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+
+	"sending-stocks/models"
+)
+
+// ikonDetailSheet лист с расшифровкой сводных цифр отчета Ikon
+const ikonDetailSheet = "Детализация"
+
+// IkonDetail расшифровка учета одной позиции в отчете Ikon
+type IkonDetail struct {
+	Client   string           `json:"client"`
+	Item     models.StockItem `json:"item"`
+	Group    string           `json:"group,omitempty"`    // колонка группы, в которую вошла позиция
+	Totals   []string         `json:"totals,omitempty"`   // итоги сезона и все остатки, куда вошла позиция
+	Excluded []string         `json:"excluded,omitempty"` // итоги, из которых бренд исключен (exclude)
+	OnlyAll  bool             `json:"only_all"`           // учтена только во «Все остатки»
+}
+
+// Details расшифровывает, в какие колонки отчета вошла каждая позиция с остатком каждого клиента
+func (p *IkonProcessor) Details(items []models.StockItem) []IkonDetail {
+	details := make([]IkonDetail, 0)
+	for _, client := range p.Clients() {
+		for _, item := range p.ClientItems(items, client) {
+			ids := p.itemColumns(item)
+			if len(ids) == 0 {
+				continue
+			}
+			counted := make(map[string]bool, len(ids))
+			for _, id := range ids {
+				counted[id] = true
+			}
+
+			detail := IkonDetail{Client: client.Name, Item: item, OnlyAll: true}
+			for _, col := range p.Layout.Columns {
+				switch col.Type {
+				case IkonColumnGroup:
+					if counted[col.ID] {
+						detail.Group = col.Caption
+						detail.OnlyAll = false
+					}
+				case IkonColumnSeasonTotal, IkonColumnAll:
+					if counted[col.ID] {
+						detail.Totals = append(detail.Totals, col.Caption)
+						if col.Type == IkonColumnSeasonTotal {
+							detail.OnlyAll = false
+						}
+					} else if col.Type == IkonColumnAll || item.Season == col.Season {
+						detail.Excluded = append(detail.Excluded, col.Caption)
+					}
+				}
+			}
+			details = append(details, detail)
+		}
+	}
+	return details
+}
+
+// writeDetailSheet добавляет в книгу лист с позициями, из которых сложены цифры сводного листа
+func (p *IkonProcessor) writeDetailSheet(f *excelize.File, items []models.StockItem) error {
+	if _, err := f.NewSheet(ikonDetailSheet); err != nil {
+		return err
+	}
+
+	headers := []string{
+		"Клиент", "Файл", "Лист", "Строка", "Код 1С", "Наименование", "Бренд", "Сезон", "Остаток",
+		"Группа", "Вошло в итоги", "Исключено из", "Примечание",
+	}
+	for i, header := range headers {
+		cell, _ := excelize.CoordinatesToCellName(i+1, 1)
+		f.SetCellValue(ikonDetailSheet, cell, header)
+	}
+
+	row := 2
+	for _, detail := range p.Details(items) {
+		item := detail.Item
+		source, sheet := item.Source, item.Sheet
+		if len(item.Sources) > 0 {
+			sources := make([]string, 0, len(item.Sources))
+			sheets := make([]string, 0, len(item.Sources))
+			for _, src := range item.Sources {
+				// У сложенных дубликатов одной ведомости файл не указан
+				if src.Source != "" {
+					sources = append(sources, fmt.Sprintf("%s (%d)", src.Source, src.Quantity))
+				}
+				if !slices.Contains(sheets, src.Sheet) {
+					sheets = append(sheets, src.Sheet)
+				}
+			}
+			source, sheet = strings.Join(sources, ", "), strings.Join(sheets, ", ")
+		}
+
+		note := ""
+		switch {
+		case detail.OnlyAll:
+			note = "учтено только во «Все остатки»"
+		case detail.Group == "":
+			note = "не входит в группы брендов"
+		}
+
+		values := []interface{}{
+			detail.Client, source, sheet, item.RowNum, item.Code1C, item.Name, item.CleanBrand, item.Season,
+			item.Quantity, detail.Group, strings.Join(detail.Totals, ", "), strings.Join(detail.Excluded, ", "), note,
+		}
+		for i, value := range values {
+			cell, _ := excelize.CoordinatesToCellName(i+1, row)
+			f.SetCellValue(ikonDetailSheet, cell, value)
+		}
+		row++
+	}
+
+	headerStyle, _ := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{
+			Bold: true,
+		},
+		Fill: excelize.Fill{
+			Type:    "pattern",
+			Color:   []string{"#E0E0E0"},
+			Pattern: 1,
+		},
+	})
+	f.SetCellStyle(ikonDetailSheet, "A1", "M1", headerStyle)
+
+	f.SetColWidth(ikonDetailSheet, "A", "C", 20)
+	f.SetColWidth(ikonDetailSheet, "F", "F", 45)
+	f.SetColWidth(ikonDetailSheet, "G", "G", 18)
+	f.SetColWidth(ikonDetailSheet, "J", "M", 25)
+
+	if row > 2 {
+		f.AutoFilter(ikonDetailSheet, fmt.Sprintf("A1:M%d", row-1), nil)
+	}
+
+	return nil
+}
@@ -2,30 +2,42 @@ package processors
 
 import (
 	"fmt"
+	"math"
+	"regexp"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/xuri/excelize/v2"
 
 	"sending-stocks/models"
 )
 
+// ParseRuleID идентификатор замечаний, найденных самим парсером
+const ParseRuleID = "parse"
+
 // StockParser парсер Excel файлов
 type StockParser struct {
 	StartRow      int
-	PirelliBrands []string // список брендов для отчета Pirelli
+	PirelliBrands []string           // список брендов для отчета Pirelli
+	Validator     *Validator         // правила проверки позиций (может быть nil)
+	Duplicates    *DuplicateResolver // обработка дубликатов (может быть nil)
+	SKUNormalizer *SKUNormalizer     // нормализация кода производителя (nil - только цифры)
+	Clock         models.Clock       // часы в часовом поясе бизнеса
 }
 
 // NewStockParser создает новый парсер
-func NewStockParser(startRow int, pirelliBrands []string) *StockParser {
+func NewStockParser(startRow int, pirelliBrands []string, validator *Validator, duplicates *DuplicateResolver, skuNormalizer *SKUNormalizer, clock models.Clock) *StockParser {
 	return &StockParser{
 		StartRow:      startRow,
 		PirelliBrands: pirelliBrands,
+		Validator:     validator,
+		Duplicates:    duplicates,
+		SKUNormalizer: skuNormalizer,
+		Clock:         clock,
 	}
 }
 
-// Parse парсит Excel файл
+// Parse парсит первый лист Excel файла
 func (p *StockParser) Parse(file *excelize.File) (*models.ProcessedFile, error) {
 	// Получаем первый лист
 	sheets := file.GetSheetList()
@@ -33,24 +45,129 @@ func (p *StockParser) Parse(file *excelize.File) (*models.ProcessedFile, error)
 		return nil, fmt.Errorf("файл не содержит листов")
 	}
 
-	rows, err := file.GetRows(sheets[0])
-	if err != nil {
-		return nil, fmt.Errorf("ошибка чтения строк: %v", err)
+	return p.ParseSheets(file, sheets[:1])
+}
+
+// ParseSheets парсит указанные листы и объединяет позиции (у каждой позиции заполнен Sheet)
+func (p *StockParser) ParseSheets(file *excelize.File, sheets []string) (*models.ProcessedFile, error) {
+	if len(sheets) == 0 {
+		return nil, fmt.Errorf("не выбраны листы")
 	}
 
-	if len(rows) < p.StartRow {
-		return nil, fmt.Errorf("в файле недостаточно строк (минимум %d)", p.StartRow)
+	existing := make(map[string]bool)
+	for _, name := range file.GetSheetList() {
+		existing[name] = true
 	}
+	selected := make(map[string]bool, len(sheets))
+	for _, sheet := range sheets {
+		if !existing[sheet] {
+			return nil, fmt.Errorf("лист %q не найден", sheet)
+		}
+		// Повторно выбранный лист удвоил бы остатки при суммировании дубликатов
+		if selected[sheet] {
+			return nil, fmt.Errorf("лист %q выбран повторно", sheet)
+		}
+		selected[sheet] = true
+	}
+
+	result := p.newProcessedFile()
+	result.Sheets = sheets
 
-	result := &models.ProcessedFile{
-		Filename:     time.Now().Format("20060102_150405") + "_processed.json",
-		UploadDate:   time.Now().Format("2006-01-02 15:04:05"),
+	for _, sheet := range sheets {
+		if err := p.parseSheet(file, sheet, len(sheets) > 1, result); err != nil {
+			if len(sheets) > 1 {
+				return nil, fmt.Errorf("лист %s: %v", sheet, err)
+			}
+			return nil, err
+		}
+	}
+
+	result.Stats.TotalRows = result.Stats.ValidRows + result.Stats.InvalidRows
+
+	// Дубликаты по коду производителя / коду 1С
+	var duplicateFindings []models.ValidationFinding
+	result.AllItems, result.Merges, duplicateFindings = p.Duplicates.Resolve(result.AllItems)
+	for _, merge := range result.Merges {
+		result.Stats.DuplicateRows += len(merge.MergedRows)
+	}
+
+	p.finish(result, duplicateFindings)
+
+	return result, nil
+}
+
+// newProcessedFile создает пустой результат обработки
+func (p *StockParser) newProcessedFile() *models.ProcessedFile {
+	return &models.ProcessedFile{
+		UploadDate:   p.Clock.Now().Format("2006-01-02 15:04:05"),
 		PirelliItems: make([]models.StockItem, 0),
 		AllItems:     make([]models.StockItem, 0),
+		Findings:     make([]models.ValidationFinding, 0),
+		Merges:       make([]models.DuplicateMerge, 0),
+		ParseIssues:  make([]models.ValidationFinding, 0),
 		Stats: models.Stats{
-			Errors: make([]string, 0),
+			Errors:   make([]string, 0),
+			Warnings: make([]string, 0),
 		},
 	}
+}
+
+// finish отбирает позиции Pirelli и проверяет итоговые позиции правилами валидации.
+// extraFindings - уже найденные замечания (дубликаты), добавляются к результату проверки
+func (p *StockParser) finish(result *models.ProcessedFile, extraFindings []models.ValidationFinding) {
+	// Если это бренд из списка Pirelli, добавляем в отдельный список
+	for _, item := range result.AllItems {
+		if item.IsPirelli && item.Quantity > 0 && item.ManufacturerSKU != "" {
+			result.PirelliItems = append(result.PirelliItems, item)
+			result.Stats.PirelliCount++
+		}
+	}
+
+	// Правила валидации
+	result.Findings = p.Validator.Validate(result.AllItems)
+	result.Findings = append(result.Findings, extraFindings...)
+	for _, finding := range result.Findings {
+		if finding.Severity == models.SeverityError {
+			result.Stats.ValidationErrors++
+		} else {
+			result.Stats.ValidationWarnings++
+		}
+	}
+}
+
+// parseSheet парсит строки одного листа и добавляет позиции в результат
+func (p *StockParser) parseSheet(file *excelize.File, sheet string, multiSheet bool, result *models.ProcessedFile) error {
+	rows, err := file.GetRows(sheet)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения строк: %v", err)
+	}
+
+	// Сырые значения ячеек (без числового формата) для количества и цены
+	rawRows, err := file.GetRows(sheet, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return fmt.Errorf("ошибка чтения строк: %v", err)
+	}
+
+	if len(rows) < p.StartRow {
+		return fmt.Errorf("в файле недостаточно строк (минимум %d)", p.StartRow)
+	}
+
+	// Дата остатков и организация из шапки (берутся с первого листа, где они указаны)
+	reportDate, organization := parseReportHeader(rows[:p.StartRow-1], p.Clock.Location())
+	if result.ReportDate == "" && !reportDate.IsZero() {
+		result.ReportDate = reportDate.Format(ReportDateLayout)
+	}
+	if result.Organization == "" {
+		result.Organization = organization
+	}
+
+	// Подпись строки в сообщениях: при нескольких листах указываем лист
+	label := func(rowNum int) string {
+		if multiSheet {
+			return fmt.Sprintf("Лист %s, строка %d", sheet, rowNum)
+		}
+		return fmt.Sprintf("Строка %d", rowNum)
+	}
 
 	// Парсим строки
 	for i := p.StartRow - 1; i < len(rows); i++ {
@@ -61,33 +178,58 @@ func (p *StockParser) Parse(file *excelize.File) (*models.ProcessedFile, error)
 			continue
 		}
 
-		item, err := p.parseRow(row, i+1)
+		var rawRow []string
+		if i < len(rawRows) {
+			rawRow = rawRows[i]
+		}
+
+		item, issues, err := p.parseRow(row, rawRow, i+1)
+		item.Sheet = sheet
+		for j := range issues {
+			issues[j].Sheet = sheet
+		}
+		result.ParseIssues = append(result.ParseIssues, issues...)
 		if err != nil {
 			result.Stats.InvalidRows++
 			result.Stats.Errors = append(result.Stats.Errors,
-				fmt.Sprintf("Строка %d: %v", i+1, err))
+				fmt.Sprintf("%s: %v", label(i+1), err))
 			continue
 		}
 
+		for _, warning := range item.Warnings {
+			result.Stats.Warnings = append(result.Stats.Warnings,
+				fmt.Sprintf("%s: %s", label(i+1), warning))
+		}
+
 		result.Stats.ValidRows++
 		result.AllItems = append(result.AllItems, *item)
-
-		// Если это бренд из списка Pirelli, добавляем в отдельный список
-		if item.IsPirelli && item.Quantity > 0 && item.ManufacturerSKU != "" {
-			result.PirelliItems = append(result.PirelliItems, *item)
-			result.Stats.PirelliCount++
-		}
 	}
 
-	result.Stats.TotalRows = result.Stats.ValidRows + result.Stats.InvalidRows
-	return result, nil
+	return nil
 }
 
-// parseRow парсит одну строку Excel
-func (p *StockParser) parseRow(row []string, rowNum int) (*models.StockItem, error) {
+// parseRow парсит одну строку Excel.
+// row содержит отформатированные значения, rawRow - сырые значения ячеек (может быть короче или nil).
+// Возвращает также замечания парсера с привязкой к полю (для отчета о качестве данных)
+func (p *StockParser) parseRow(row []string, rawRow []string, rowNum int) (*models.StockItem, []models.ValidationFinding, error) {
 	item := &models.StockItem{
 		RowNum: rowNum,
 	}
+	issues := make([]models.ValidationFinding, 0)
+
+	addIssue := func(severity, field, value, message string) {
+		issues = append(issues, models.ValidationFinding{
+			RowNum:   rowNum,
+			RuleID:   ParseRuleID,
+			Severity: severity,
+			Field:    field,
+			Value:    value,
+			Message:  message,
+		})
+		if severity == models.SeverityWarning {
+			item.Warnings = append(item.Warnings, message)
+		}
+	}
 
 	// Столбец A (индекс 0) - наименование
 	if len(row) > 0 {
@@ -95,6 +237,14 @@ func (p *StockParser) parseRow(row []string, rowNum int) (*models.StockItem, err
 		item.IsYearOld = strings.Contains(strings.ToLower(item.Name), "год")
 	}
 
+	// Столбец B (индекс 1) - характеристика
+	if len(row) > 1 {
+		item.Characteristic = cleanString(row[1])
+	}
+
+	// Год выпуска / DOT из наименования или характеристики
+	item.ProductionYear, item.DOTWeek = extractProductionDate(p.Clock.Now().Year(), item.Name, item.Characteristic)
+
 	// Столбец C (индекс 2) - бренд + сезонность
 	if len(row) > 2 {
 		brandField := cleanString(row[2])
@@ -112,9 +262,10 @@ func (p *StockParser) parseRow(row []string, rowNum int) (*models.StockItem, err
 		item.Code1C = cleanCodeDigits(row[5])
 	}
 
-	// Столбец G (индекс 6) - код производителя
+	// Столбец G (индекс 6) - код производителя (исходный и приведенный к формату бренда)
 	if len(row) > 6 {
-		item.ManufacturerSKU = cleanCodeDigits(row[6])
+		item.RawManufacturerSKU = cleanString(row[6])
+		item.ManufacturerSKU = p.SKUNormalizer.Normalize(item.CleanBrand, item.RawManufacturerSKU)
 	}
 
 	// Столбец H (индекс 7) - типоразмер
@@ -124,17 +275,31 @@ func (p *StockParser) parseRow(row []string, rowNum int) (*models.StockItem, err
 
 	// Столбец I (индекс 8) - остаток
 	if len(row) > 8 {
-		quantity, err := strconv.Atoi(cleanDigits(row[8]))
-		if err == nil {
-			item.Quantity = quantity
+		quantity, ok, err := parseNumber(cellValue(row, rawRow, 8))
+		if err != nil {
+			addIssue(models.SeverityWarning, "quantity", row[8],
+				fmt.Sprintf("не удалось прочитать остаток %q", row[8]))
+		} else if ok {
+			item.RawQuantity = quantity
+			item.Quantity = int(math.Trunc(quantity))
+			if quantity < 0 {
+				addIssue(models.SeverityWarning, "quantity", row[8],
+					fmt.Sprintf("отрицательный остаток %s", formatNumber(quantity)))
+			}
+			if quantity != math.Trunc(quantity) {
+				addIssue(models.SeverityWarning, "quantity", row[8],
+					fmt.Sprintf("дробный остаток %s", formatNumber(quantity)))
+			}
 		}
 	}
 
 	// Столбец J (индекс 9) - цена
 	if len(row) > 9 {
-		priceStr := cleanPrice(row[9])
-		price, err := strconv.ParseFloat(priceStr, 64)
-		if err == nil {
+		price, ok, err := parseNumber(cellValue(row, rawRow, 9))
+		if err != nil {
+			addIssue(models.SeverityWarning, "price", row[9],
+				fmt.Sprintf("не удалось прочитать цену %q", row[9]))
+		} else if ok {
 			item.Price = price
 		}
 	}
@@ -143,16 +308,18 @@ func (p *StockParser) parseRow(row []string, rowNum int) (*models.StockItem, err
 	errors := make([]string, 0)
 	if item.Code1C == "" {
 		errors = append(errors, "отсутствует код 1С")
+		addIssue(models.SeverityError, "code_1c", "", "отсутствует код 1С")
 	}
 	if item.TireSize == "" {
 		errors = append(errors, "отсутствует типоразмер")
+		addIssue(models.SeverityError, "tire_size", "", "отсутствует типоразмер")
 	}
 
 	if len(errors) > 0 {
-		return item, fmt.Errorf(strings.Join(errors, "; "))
+		return item, issues, fmt.Errorf("%s", strings.Join(errors, "; "))
 	}
 
-	return item, nil
+	return item, issues, nil
 }
 
 // isPirelliBrand проверяет, входит ли бренд в список Pirelli
@@ -252,47 +419,109 @@ func cleanCodeDigits(s string) string {
 	return builder.String()
 }
 
-// cleanDigits оставляет только цифры (для количества)
-func cleanDigits(s string) string {
-	s = strings.TrimSpace(s)
-	var builder strings.Builder
-	for _, r := range s {
-		if r >= '0' && r <= '9' {
-			builder.WriteRune(r)
+var (
+	// DOT 1223 - 12 неделя 2023 года
+	dotPattern = regexp.MustCompile(`(?i)\bDOT\s*[:№#]?\s*(\d{2})(\d{2})\b`)
+	// 2022г, 2022 г., 2022 год
+	yearPattern = regexp.MustCompile(`(?:^|\D)(20\d{2})\s*(?:г\.?|год)`)
+	// (2021)
+	yearParenPattern = regexp.MustCompile(`\((20\d{2})\)`)
+)
+
+// extractProductionDate ищет год выпуска и неделю DOT в текстах (первое найденное значение).
+// Годы позже следующего за текущим считаются ошибкой распознавания
+func extractProductionDate(currentYear int, texts ...string) (year int, week int) {
+	maxYear := currentYear + 1
+
+	for _, text := range texts {
+		if m := dotPattern.FindStringSubmatch(text); m != nil {
+			w, _ := strconv.Atoi(m[1])
+			y, _ := strconv.Atoi(m[2])
+			if w >= 1 && w <= 53 && 2000+y <= maxYear {
+				return 2000 + y, w
+			}
 		}
 	}
-	return builder.String()
+
+	for _, text := range texts {
+		for _, pattern := range []*regexp.Regexp{yearPattern, yearParenPattern} {
+			if m := pattern.FindStringSubmatch(text); m != nil {
+				y, _ := strconv.Atoi(m[1])
+				if y <= maxYear {
+					return y, 0
+				}
+			}
+		}
+	}
+
+	return 0, 0
 }
 
-// cleanPrice очищает цену, извлекая число из строки
-// Удаляет все символы кроме цифр, последние две цифры отделяет точкой
-func cleanPrice(s string) string {
-	s = strings.TrimSpace(s)
-	if s == "" {
-		return "0"
+// cellValue возвращает сырое значение ячейки, если оно есть, иначе отформатированное
+func cellValue(row []string, rawRow []string, index int) string {
+	if index < len(rawRow) && strings.TrimSpace(rawRow[index]) != "" {
+		return rawRow[index]
 	}
+	if index < len(row) {
+		return row[index]
+	}
+	return ""
+}
 
-	// Оставляем только цифры
-	var digits strings.Builder
-	for _, r := range s {
-		if r >= '0' && r <= '9' {
-			digits.WriteRune(r)
+// parseNumber разбирает число из ячейки с учетом русского и английского формата
+// ("1 234,56", "1,234.56", "1234.5", "-4"). ok=false для пустой ячейки.
+func parseNumber(s string) (value float64, ok bool, err error) {
+	// Оставляем только цифры, разделители и знак
+	var builder strings.Builder
+	for _, r := range strings.TrimSpace(s) {
+		switch {
+		case r >= '0' && r <= '9', r == '.', r == ',':
+			builder.WriteRune(r)
+		case r == '-' || r == '−':
+			builder.WriteRune('-')
+		case (r == 'E' || r == 'e') && builder.Len() > 0:
+			// экспоненциальная запись из сырых значений Excel (1.5E-3)
+			builder.WriteRune('E')
 		}
 	}
 
-	priceStr := digits.String()
-	if priceStr == "" {
-		return "0"
+	clean := builder.String()
+	if clean == "" || clean == "-" {
+		return 0, false, nil
 	}
 
-	// Если длина меньше 3, это просто число без копеек
-	if len(priceStr) <= 2 {
-		return priceStr
+	lastComma := strings.LastIndex(clean, ",")
+	lastDot := strings.LastIndex(clean, ".")
+
+	switch {
+	case lastComma >= 0 && lastDot >= 0:
+		// Десятичный разделитель - последний из встретившихся
+		if lastComma > lastDot {
+			clean = strings.ReplaceAll(clean, ".", "")
+			clean = strings.Replace(clean, ",", ".", 1)
+		} else {
+			clean = strings.ReplaceAll(clean, ",", "")
+		}
+	case lastComma >= 0:
+		if strings.Count(clean, ",") > 1 {
+			clean = strings.ReplaceAll(clean, ",", "")
+		} else {
+			clean = strings.Replace(clean, ",", ".", 1)
+		}
+	case lastDot >= 0:
+		if strings.Count(clean, ".") > 1 {
+			clean = strings.ReplaceAll(clean, ".", "")
+		}
 	}
 
-	// Отделяем последние две цифры как копейки
-	mainPart := priceStr[:len(priceStr)-2]
-	centsPart := priceStr[len(priceStr)-2:]
+	value, err = strconv.ParseFloat(clean, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return value, true, nil
+}
 
-	return mainPart + "." + centsPart
+// formatNumber форматирует число без лишних нулей для сообщений
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
 }
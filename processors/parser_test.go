@@ -0,0 +1,50 @@
+package processors
+
+import "testing"
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		input   string
+		value   float64
+		ok      bool
+		wantErr bool
+	}{
+		{"4", 4, true, false},
+		{"1 234,56", 1234.56, true, false},
+		{"1\u00a0234,56", 1234.56, true, false}, // неразрывный пробел из 1С
+		{"1,234.56", 1234.56, true, false},
+		{"1.234,56", 1234.56, true, false},
+		{"1234.5", 1234.5, true, false},
+		// Одна запятая - десятичный разделитель, а не разделитель тысяч
+		{"1,5", 1.5, true, false},
+		{"1,234", 1.234, true, false},
+		{"1,234,567", 1234567, true, false},
+		{"1.234.567", 1234567, true, false},
+		// Экспонента из сырых значений Excel
+		{"1.5E-3", 0.0015, true, false},
+		{"2e3", 2000, true, false},
+		// Минус: ASCII и знак минус Unicode
+		{"-4", -4, true, false},
+		{"−4", -4, true, false},
+		{"12 шт", 12, true, false},
+		// Текст без цифр - пустое значение, не ошибка
+		{"", 0, false, false},
+		{"  ", 0, false, false},
+		{"нет", 0, false, false},
+		{"Text", 0, false, false},
+		{"-", 0, false, false},
+		{"1-2", 0, false, true},
+		{"1.5E", 0, false, true},
+	}
+
+	for _, tt := range tests {
+		value, ok, err := parseNumber(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseNumber(%q): ошибка %v, ожидалась ошибка: %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if value != tt.value || ok != tt.ok {
+			t.Errorf("parseNumber(%q) = %v, %v, ожидалось %v, %v", tt.input, value, ok, tt.value, tt.ok)
+		}
+	}
+}
@@ -12,17 +12,20 @@ import (
 // PirelliProcessor обработчик для Pirelli
 type PirelliProcessor struct {
 	CustomerCode string
+	Clock        models.Clock
 }
 
 // NewPirelliProcessor создает новый процессор
-func NewPirelliProcessor(customerCode string) *PirelliProcessor {
+func NewPirelliProcessor(customerCode string, clock models.Clock) *PirelliProcessor {
 	return &PirelliProcessor{
 		CustomerCode: customerCode,
+		Clock:        clock,
 	}
 }
 
-// CreateCSV создает CSV для отправки в Pirelli (стандартный формат без лишних запятых)
-func (p *PirelliProcessor) CreateCSV(items []models.StockItem, writer io.Writer) error {
+// CreateCSV создает CSV для отправки в Pirelli (стандартный формат без лишних запятых).
+// stockDate - дата остатков (колонка Stock Date)
+func (p *PirelliProcessor) CreateCSV(items []models.StockItem, writer io.Writer, stockDate time.Time) error {
 	csvWriter := csv.NewWriter(writer)
 	defer csvWriter.Flush()
 
@@ -39,8 +42,6 @@ func (p *PirelliProcessor) CreateCSV(items []models.StockItem, writer io.Writer)
 		return fmt.Errorf("ошибка записи заголовков: %v", err)
 	}
 
-	stockDate := time.Now().Format("20060102")
-
 	// Данные
 	for _, item := range items {
 		row := []string{
@@ -49,7 +50,7 @@ func (p *PirelliProcessor) CreateCSV(items []models.StockItem, writer io.Writer)
 			item.ManufacturerSKU,
 			item.Name,
 			fmt.Sprintf("%d", item.Quantity),
-			stockDate,
+			stockDate.Format("20060102"),
 		}
 		if err := csvWriter.Write(row); err != nil {
 			return fmt.Errorf("ошибка записи строки: %v", err)
@@ -59,18 +60,33 @@ func (p *PirelliProcessor) CreateCSV(items []models.StockItem, writer io.Writer)
 	return nil
 }
 
-// GenerateFilename генерирует имя файла для скачивания/сохранения (только дата)
-func (p *PirelliProcessor) GenerateFilename() string {
+// GenerateFilename генерирует имя файла для скачивания/сохранения (только дата остатков)
+func (p *PirelliProcessor) GenerateFilename(stockDate time.Time) string {
 	return fmt.Sprintf("IR_%s_%s.csv",
 		p.CustomerCode,
-		time.Now().Format("20060102"))
+		stockDate.Format("20060102"))
 }
 
 // GenerateFilenameWithTime генерирует имя файла с временем (для отладки)
 func (p *PirelliProcessor) GenerateFilenameWithTime() string {
 	return fmt.Sprintf("IR_%s_%s.csv",
 		p.CustomerCode,
-		time.Now().Format("20060102_150405"))
+		p.Clock.Now().Format("20060102_150405"))
+}
+
+// ExclusionReason возвращает причину, по которой позиция Pirelli не попадет в CSV
+// ("" - позиция попадает в CSV или не относится к Pirelli)
+func (p *PirelliProcessor) ExclusionReason(item models.StockItem) string {
+	if !item.IsPirelli {
+		return ""
+	}
+	if item.Quantity <= 0 {
+		return "нет остатка"
+	}
+	if item.ManufacturerSKU == "" {
+		return "нет кода производителя"
+	}
+	return ""
 }
 
 // Validate проверяет данные
@@ -36,6 +36,17 @@ func (p *PirelliExcelProcessor) isPirelliBrand(brand string) bool {
 	return false
 }
 
+// FilterItems позиции Pirelli/Formula с остатком (включая позиции без кода производителя)
+func (p *PirelliExcelProcessor) FilterItems(items []models.StockItem) []models.StockItem {
+	result := make([]models.StockItem, 0)
+	for _, item := range items {
+		if p.isPirelliBrand(item.CleanBrand) && item.Quantity > 0 {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
 // CreateExcelReport создает Excel отчет для Pirelli (включает все позиции, даже без кода производителя)
 func (p *PirelliExcelProcessor) CreateExcelReport(items []models.StockItem) (*excelize.File, error) {
 	f := excelize.NewFile()
@@ -63,15 +74,11 @@ func (p *PirelliExcelProcessor) CreateExcelReport(items []models.StockItem) (*ex
 	}
 
 	// Фильтруем позиции Pirelli/Formula (включаем все, даже без кода производителя)
-	pirelliItems := make([]models.StockItem, 0)
-	for _, item := range items {
-		if p.isPirelliBrand(item.CleanBrand) && item.Quantity > 0 {
-			pirelliItems = append(pirelliItems, item)
-		}
-	}
+	pirelliItems := p.FilterItems(items)
 
 	// Заполняем данные
 	row := 2
+	hasAged := false
 	for _, item := range pirelliItems {
 		// Season
 		season := ""
@@ -97,9 +104,19 @@ func (p *PirelliExcelProcessor) CreateExcelReport(items []models.StockItem) (*ex
 		// Quantity
 		f.SetCellValue("Pirelli Report", fmt.Sprintf("F%d", row), item.Quantity)
 
+		// Production year (только для отмеченного залежалого товара)
+		if item.AgedFlag {
+			f.SetCellValue("Pirelli Report", fmt.Sprintf("G%d", row), AgedLabel(item))
+			hasAged = true
+		}
+
 		row++
 	}
 
+	if hasAged {
+		f.SetCellValue("Pirelli Report", "G1", "Production year")
+	}
+
 	// Стили для заголовков
 	headerStyle, _ := f.NewStyle(&excelize.Style{
 		Font: &excelize.Font{
@@ -112,11 +129,15 @@ func (p *PirelliExcelProcessor) CreateExcelReport(items []models.StockItem) (*ex
 			Pattern: 1,
 		},
 	})
-	f.SetCellStyle("Pirelli Report", "A1", "F1", headerStyle)
+	lastCol := "F"
+	if hasAged {
+		lastCol = "G"
+	}
+	f.SetCellStyle("Pirelli Report", "A1", lastCol+"1", headerStyle)
 
 	// Устанавливаем ширину колонок
 	colWidths := map[string]float64{
-		"A": 10, "B": 15, "C": 15, "D": 15, "E": 50, "F": 10,
+		"A": 10, "B": 15, "C": 15, "D": 15, "E": 50, "F": 10, "G": 16,
 	}
 	for col, width := range colWidths {
 		f.SetColWidth("Pirelli Report", col, col, width)
@@ -125,7 +146,18 @@ func (p *PirelliExcelProcessor) CreateExcelReport(items []models.StockItem) (*ex
 	return f, nil
 }
 
-// GenerateFilename генерирует имя файла
-func (p *PirelliExcelProcessor) GenerateFilename() string {
-	return fmt.Sprintf("Pirelli_Report_%s.xlsx", time.Now().Format("20060102_150405"))
+// ExclusionReason возвращает причину, по которой позиция Pirelli/Formula не попадет в Excel отчет
+func (p *PirelliExcelProcessor) ExclusionReason(item models.StockItem) string {
+	if !p.isPirelliBrand(item.CleanBrand) {
+		return ""
+	}
+	if item.Quantity <= 0 {
+		return "нет остатка"
+	}
+	return ""
+}
+
+// GenerateFilename генерирует имя файла для отчета на дату остатков
+func (p *PirelliExcelProcessor) GenerateFilename(reportDate time.Time) string {
+	return fmt.Sprintf("Pirelli_Report_%s.xlsx", reportDate.Format("20060102"))
 }
@@ -0,0 +1,357 @@
+package processors
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+
+	"sending-stocks/models"
+)
+
+// ExclusionChecker описывает отчет бренда и способ узнать, почему позиция в него не попала
+type ExclusionChecker struct {
+	Report string
+	Reason func(item models.StockItem) string
+}
+
+// QualityReportProcessor размечает исходную ведомость замечаниями о качестве данных
+type QualityReportProcessor struct {
+	Checkers []ExclusionChecker
+	Clock    models.Clock
+}
+
+// NewQualityReportProcessor создает процессор отчета о качестве данных
+func NewQualityReportProcessor(checkers []ExclusionChecker, clock models.Clock) *QualityReportProcessor {
+	return &QualityReportProcessor{
+		Checkers: checkers,
+		Clock:    clock,
+	}
+}
+
+// Колонки исходной ведомости для полей позиции
+var qualityFieldColumns = map[string]string{
+	"name":                 "A",
+	"brand":                "C",
+	"clean_brand":          "C",
+	"season":               "C",
+	"code_1c":              "F",
+	"manufacturer_sku":     "G",
+	"raw_manufacturer_sku": "G",
+	"tire_size":            "H",
+	"quantity":             "I",
+	"raw_quantity":         "I",
+	"price":                "J",
+}
+
+const qualityLastColumn = "J"
+
+// qualitySummarySheet имя листа со сводкой исключенных строк
+const qualitySummarySheet = "Исключено из отчетов"
+
+// Annotate добавляет в исходный файл подсветку проблемных строк, комментарии к ячейкам
+// и лист со сводкой строк, не попавших в отчеты брендов.
+// source - имя исходного файла объединенного снимка (пусто для обычной обработки):
+// размечаются только замечания по этому файлу
+func (p *QualityReportProcessor) Annotate(f *excelize.File, processed *models.ProcessedFile, source string) error {
+	sheets := f.GetSheetList()
+	if len(sheets) == 0 {
+		return fmt.Errorf("файл не содержит листов")
+	}
+	// Замечания без листа (старые результаты обработки) относятся к первому листу
+	defaultSheet := sheets[0]
+
+	// Собираем замечания по ячейкам
+	issues := make([]models.ValidationFinding, 0, len(processed.ParseIssues)+len(processed.Findings))
+	issues = append(issues, processed.ParseIssues...)
+	issues = append(issues, processed.Findings...)
+
+	type cellNote struct {
+		severity string
+		lines    []string
+	}
+	type sheetNotes struct {
+		cells       map[string]*cellNote
+		rowSeverity map[int]string
+	}
+	bySheet := make(map[string]*sheetNotes)
+	sheetOrder := make([]string, 0)
+
+	for _, issue := range issues {
+		if issue.Source != source {
+			continue
+		}
+		sheet := issue.Sheet
+		if sheet == "" {
+			sheet = defaultSheet
+		}
+		sn, ok := bySheet[sheet]
+		if !ok {
+			sn = &sheetNotes{
+				cells:       make(map[string]*cellNote),
+				rowSeverity: make(map[int]string),
+			}
+			bySheet[sheet] = sn
+			sheetOrder = append(sheetOrder, sheet)
+		}
+
+		column, ok := qualityFieldColumns[issue.Field]
+		if !ok {
+			column = "A"
+		}
+		cell := fmt.Sprintf("%s%d", column, issue.RowNum)
+
+		note, ok := sn.cells[cell]
+		if !ok {
+			note = &cellNote{severity: models.SeverityWarning}
+			sn.cells[cell] = note
+		}
+		note.lines = append(note.lines, issue.Message)
+		if issue.Severity == models.SeverityError {
+			note.severity = models.SeverityError
+			sn.rowSeverity[issue.RowNum] = models.SeverityError
+		} else if sn.rowSeverity[issue.RowNum] == "" {
+			sn.rowSeverity[issue.RowNum] = models.SeverityWarning
+		}
+	}
+
+	for _, sheet := range sheetOrder {
+		sn := bySheet[sheet]
+		if idx, err := f.GetSheetIndex(sheet); err != nil || idx < 0 {
+			return fmt.Errorf("лист %q не найден в исходном файле", sheet)
+		}
+
+		// Подсвечиваем строки: ошибки - красным, предупреждения - желтым
+		for rowNum, severity := range sn.rowSeverity {
+			color := "#FFF2CC"
+			if severity == models.SeverityError {
+				color = "#F8CBAD"
+			}
+			if err := p.fillRow(f, sheet, rowNum, color); err != nil {
+				return err
+			}
+		}
+
+		// Комментарии к ячейкам
+		existing := make(map[string]string)
+		if comments, err := f.GetComments(sheet); err == nil {
+			for _, c := range comments {
+				existing[c.Cell] = commentText(c)
+			}
+		}
+
+		cells := make([]string, 0, len(sn.cells))
+		for cell := range sn.cells {
+			cells = append(cells, cell)
+		}
+		sort.Strings(cells)
+
+		for _, cell := range cells {
+			note := sn.cells[cell]
+			text := strings.Join(note.lines, "\n")
+			if old, ok := existing[cell]; ok {
+				if err := f.DeleteComment(sheet, cell); err != nil {
+					return fmt.Errorf("ошибка удаления комментария %s: %v", cell, err)
+				}
+				text = old + "\n" + text
+			}
+
+			if err := f.AddComment(sheet, excelize.Comment{
+				Cell:   cell,
+				Author: "Проверка остатков",
+				Paragraph: []excelize.RichTextRun{
+					{Text: text},
+				},
+				Width:  240,
+				Height: uint(40 + 15*len(note.lines)),
+			}); err != nil {
+				return fmt.Errorf("ошибка добавления комментария %s!%s: %v", sheet, cell, err)
+			}
+		}
+	}
+
+	return p.writeSummary(f, processed)
+}
+
+// fillRow заливает ячейки строки цветом, сохраняя остальное оформление
+func (p *QualityReportProcessor) fillRow(f *excelize.File, sheet string, rowNum int, color string) error {
+	styles := make(map[int]int)
+	for col := 'A'; col <= rune(qualityLastColumn[0]); col++ {
+		cell := fmt.Sprintf("%c%d", col, rowNum)
+
+		styleID, err := f.GetCellStyle(sheet, cell)
+		if err != nil {
+			return fmt.Errorf("ошибка чтения стиля %s: %v", cell, err)
+		}
+
+		newID, ok := styles[styleID]
+		if !ok {
+			style, err := f.GetStyle(styleID)
+			if err != nil || style == nil {
+				style = &excelize.Style{}
+			}
+			style.Fill = excelize.Fill{
+				Type:    "pattern",
+				Color:   []string{color},
+				Pattern: 1,
+			}
+			newID, err = f.NewStyle(style)
+			if err != nil {
+				return fmt.Errorf("ошибка создания стиля: %v", err)
+			}
+			styles[styleID] = newID
+		}
+
+		if err := f.SetCellStyle(sheet, cell, cell, newID); err != nil {
+			return fmt.Errorf("ошибка установки стиля %s: %v", cell, err)
+		}
+	}
+	return nil
+}
+
+// ReportExclusion строка, не попавшая в отчет бренда
+type ReportExclusion struct {
+	Report string
+	Item   models.StockItem
+	Reason string
+}
+
+// Exclusions возвращает список строк, не попавших в отчеты брендов, с причинами
+func (p *QualityReportProcessor) Exclusions(processed *models.ProcessedFile) []ReportExclusion {
+	result := make([]ReportExclusion, 0)
+
+	// Строки с ошибками парсера не попадают ни в один отчет
+	invalid := make(map[string][]string)
+	invalidRows := make([]models.StockItem, 0)
+	for _, issue := range processed.ParseIssues {
+		if issue.Severity != models.SeverityError {
+			continue
+		}
+		key := models.RowKey(issue.Source, issue.Sheet, issue.RowNum)
+		if _, ok := invalid[key]; !ok {
+			invalidRows = append(invalidRows, models.StockItem{Source: issue.Source, Sheet: issue.Sheet, RowNum: issue.RowNum})
+		}
+		invalid[key] = append(invalid[key], issue.Message)
+	}
+	for _, item := range invalidRows {
+		result = append(result, ReportExclusion{
+			Report: "Все отчеты",
+			Item:   item,
+			Reason: strings.Join(invalid[models.RowKey(item.Source, item.Sheet, item.RowNum)], "; "),
+		})
+	}
+
+	// Дубликаты, объединенные с первой строкой
+	for _, merge := range processed.Merges {
+		if merge.Policy == DuplicateReject {
+			continue
+		}
+		for i, rowNum := range merge.MergedRows {
+			sheet := ""
+			if i < len(merge.MergedSheets) {
+				sheet = merge.MergedSheets[i]
+			}
+			reason := fmt.Sprintf("дубликат кода %s, объединена со строкой %s", merge.Key, rowRef(merge.KeptSheet, merge.KeptRow, sheet))
+			if merge.Policy == DuplicateKeepFirst {
+				reason = fmt.Sprintf("дубликат кода %s, оставлена строка %s", merge.Key, rowRef(merge.KeptSheet, merge.KeptRow, sheet))
+			}
+			result = append(result, ReportExclusion{
+				Report: "Все отчеты",
+				Item:   models.StockItem{Source: merge.Source, Sheet: sheet, RowNum: rowNum, ManufacturerSKU: merge.Key, CleanBrand: merge.Brand},
+				Reason: reason,
+			})
+		}
+	}
+
+	for _, checker := range p.Checkers {
+		for _, item := range processed.AllItems {
+			if reason := checker.Reason(item); reason != "" {
+				result = append(result, ReportExclusion{
+					Report: checker.Report,
+					Item:   item,
+					Reason: reason,
+				})
+			}
+		}
+	}
+
+	return result
+}
+
+// writeSummary добавляет лист со сводкой исключенных строк
+func (p *QualityReportProcessor) writeSummary(f *excelize.File, processed *models.ProcessedFile) error {
+	if _, err := f.NewSheet(qualitySummarySheet); err != nil {
+		return fmt.Errorf("ошибка создания листа: %v", err)
+	}
+
+	headers := []string{
+		"Отчет", "Лист", "Строка", "Код 1С", "Код производителя", "Бренд", "Наименование", "Остаток", "Причина",
+	}
+	for i, header := range headers {
+		col := string(rune('A' + i))
+		f.SetCellValue(qualitySummarySheet, fmt.Sprintf("%s1", col), header)
+	}
+
+	row := 2
+	for _, exclusion := range p.Exclusions(processed) {
+		sheet := exclusion.Item.Sheet
+		if sheet == "" && len(processed.Sheets) > 0 {
+			sheet = processed.Sheets[0]
+		}
+		if exclusion.Item.Source != "" {
+			sheet = exclusion.Item.Source + ": " + sheet
+		}
+		f.SetCellValue(qualitySummarySheet, fmt.Sprintf("A%d", row), exclusion.Report)
+		f.SetCellValue(qualitySummarySheet, fmt.Sprintf("B%d", row), sheet)
+		f.SetCellValue(qualitySummarySheet, fmt.Sprintf("C%d", row), exclusion.Item.RowNum)
+		f.SetCellValue(qualitySummarySheet, fmt.Sprintf("D%d", row), exclusion.Item.Code1C)
+		f.SetCellValue(qualitySummarySheet, fmt.Sprintf("E%d", row), exclusion.Item.ManufacturerSKU)
+		f.SetCellValue(qualitySummarySheet, fmt.Sprintf("F%d", row), exclusion.Item.CleanBrand)
+		f.SetCellValue(qualitySummarySheet, fmt.Sprintf("G%d", row), exclusion.Item.Name)
+		f.SetCellValue(qualitySummarySheet, fmt.Sprintf("H%d", row), exclusion.Item.Quantity)
+		f.SetCellValue(qualitySummarySheet, fmt.Sprintf("I%d", row), exclusion.Reason)
+		row++
+	}
+
+	// Стили для заголовков
+	headerStyle, _ := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{
+			Bold: true,
+			Size: 12,
+		},
+		Fill: excelize.Fill{
+			Type:    "pattern",
+			Color:   []string{"#E0E0E0"},
+			Pattern: 1,
+		},
+	})
+	f.SetCellStyle(qualitySummarySheet, "A1", "I1", headerStyle)
+
+	// Устанавливаем ширину колонок
+	colWidths := map[string]float64{
+		"A": 18, "B": 20, "C": 8, "D": 12, "E": 18, "F": 18, "G": 50, "H": 10, "I": 45,
+	}
+	for col, width := range colWidths {
+		f.SetColWidth(qualitySummarySheet, col, col, width)
+	}
+
+	return nil
+}
+
+// commentText собирает текст существующего комментария
+func commentText(c excelize.Comment) string {
+	if len(c.Paragraph) == 0 {
+		return c.Text
+	}
+	var builder strings.Builder
+	for _, run := range c.Paragraph {
+		builder.WriteString(run.Text)
+	}
+	return builder.String()
+}
+
+// GenerateFilename генерирует имя файла
+func (p *QualityReportProcessor) GenerateFilename() string {
+	return fmt.Sprintf("Quality_Report_%s.xlsx", p.Clock.Now().Format("20060102_150405"))
+}
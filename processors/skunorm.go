@@ -0,0 +1,250 @@
+package processors
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// skuStep один шаг нормализации кода производителя
+type skuStep func(s string) string
+
+// brandSKUPipeline цепочка шагов для бренда
+type brandSKUPipeline struct {
+	Brand string `json:"brand"`
+	Spec  string `json:"spec"`
+	steps []skuStep
+}
+
+// SKUNormalizeConfig цепочки нормализации из JSON файла (SKU_NORMALIZE_FILE) - для регулярных
+// выражений с "|" или ";", которые нельзя записать в одну строку переменной окружения
+type SKUNormalizeConfig struct {
+	Default string             `json:"default"`
+	Brands  []brandSKUPipeline `json:"brands"`
+}
+
+// SKUNormalizer приводит исходный код производителя (столбец G) к формату,
+// который ожидает производитель бренда.
+//
+// Цепочка задается шагами через "|":
+//
+//	digits       - оставить только цифры
+//	alnum        - оставить буквы и цифры
+//	upper        - перевести в верхний регистр
+//	strip_zeros  - убрать ведущие нули
+//	pad:N        - дополнить ведущими нулями до N символов
+//	last:N       - взять последние N символов
+//	regex:EXPR   - взять первую группу (или все совпадение) регулярного выражения;
+//	               выражение занимает остаток цепочки, поэтому шаг regex - последний
+type SKUNormalizer struct {
+	DefaultSpec string
+	Brands      []brandSKUPipeline
+	defaults    []skuStep
+}
+
+// NewSKUNormalizer создает нормализатор.
+// defaultSpec - цепочка для всех брендов, brandSpecs - "Hankook=digits|last:7;Pirelli=alnum|upper"
+func NewSKUNormalizer(defaultSpec, brandSpecs string) (*SKUNormalizer, error) {
+	defaults, err := parseSKUPipeline(defaultSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &SKUNormalizer{
+		DefaultSpec: defaultSpec,
+		Brands:      make([]brandSKUPipeline, 0),
+		defaults:    defaults,
+	}
+
+	brands, err := splitBrandSpecs(brandSpecs)
+	if err != nil {
+		return nil, err
+	}
+	for _, bp := range brands {
+		if err := n.addBrand(bp.Brand, bp.Spec); err != nil {
+			return nil, err
+		}
+	}
+
+	return n, nil
+}
+
+// LoadSKUNormalizer создает нормализатор по цепочкам из JSON файла
+func LoadSKUNormalizer(path string) (*SKUNormalizer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать файл нормализации кодов: %v", err)
+	}
+	var config SKUNormalizeConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("ошибка разбора файла нормализации кодов: %v", err)
+	}
+
+	n, err := NewSKUNormalizer(config.Default, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, bp := range config.Brands {
+		if err := n.addBrand(bp.Brand, bp.Spec); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// addBrand добавляет цепочку бренда
+func (n *SKUNormalizer) addBrand(brand, spec string) error {
+	brand = strings.TrimSpace(brand)
+	if brand == "" {
+		return fmt.Errorf("не указан бренд для цепочки %q", spec)
+	}
+	steps, err := parseSKUPipeline(spec)
+	if err != nil {
+		return fmt.Errorf("бренд %s: %v", brand, err)
+	}
+	n.Brands = append(n.Brands, brandSKUPipeline{
+		Brand: brand,
+		Spec:  strings.TrimSpace(spec),
+		steps: steps,
+	})
+	return nil
+}
+
+// splitBrandSpecs разбирает "Бренд=шаги;Бренд=шаги". Цепочка с шагом regex занимает остаток
+// строки (в выражении допустимы ";" и "|"), поэтому такой бренд указывается последним
+func splitBrandSpecs(brandSpecs string) ([]brandSKUPipeline, error) {
+	result := make([]brandSKUPipeline, 0)
+	rest := brandSpecs
+	for strings.TrimSpace(rest) != "" {
+		part := rest
+		rest = ""
+		if semi := strings.Index(part, ";"); semi >= 0 {
+			regex := strings.Index(part, "regex:")
+			if regex < 0 || semi < regex {
+				part, rest = part[:semi], part[semi+1:]
+			}
+		}
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		brand, spec, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("неверный формат %q, ожидается Бренд=шаги", part)
+		}
+		result = append(result, brandSKUPipeline{Brand: brand, Spec: spec})
+	}
+	return result, nil
+}
+
+// parseSKUPipeline разбирает цепочку шагов; шаг regex забирает остаток цепочки
+func parseSKUPipeline(spec string) ([]skuStep, error) {
+	steps := make([]skuStep, 0)
+	rest := spec
+	for rest != "" {
+		part := strings.TrimLeft(rest, " \t")
+		if strings.HasPrefix(part, "regex:") {
+			rest = ""
+		} else {
+			part, rest, _ = strings.Cut(part, "|")
+		}
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, arg, _ := strings.Cut(part, ":")
+		switch name {
+		case "digits":
+			steps = append(steps, cleanCodeDigits)
+		case "alnum":
+			steps = append(steps, func(s string) string {
+				var builder strings.Builder
+				for _, r := range s {
+					if unicode.IsLetter(r) || unicode.IsDigit(r) {
+						builder.WriteRune(r)
+					}
+				}
+				return builder.String()
+			})
+		case "upper":
+			steps = append(steps, strings.ToUpper)
+		case "strip_zeros":
+			steps = append(steps, func(s string) string {
+				trimmed := strings.TrimLeft(s, "0")
+				if trimmed == "" && s != "" {
+					return "0"
+				}
+				return trimmed
+			})
+		case "pad", "last":
+			n, err := strconv.Atoi(arg)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("шаг %q: ожидается положительное число", part)
+			}
+			if name == "pad" {
+				steps = append(steps, func(s string) string {
+					if s == "" {
+						return s
+					}
+					for len([]rune(s)) < n {
+						s = "0" + s
+					}
+					return s
+				})
+			} else {
+				steps = append(steps, func(s string) string {
+					runes := []rune(s)
+					if len(runes) <= n {
+						return s
+					}
+					return string(runes[len(runes)-n:])
+				})
+			}
+		case "regex":
+			re, err := regexp.Compile(arg)
+			if err != nil {
+				return nil, fmt.Errorf("шаг %q: %v", part, err)
+			}
+			steps = append(steps, func(s string) string {
+				m := re.FindStringSubmatch(s)
+				switch {
+				case m == nil:
+					return ""
+				case len(m) > 1:
+					return m[1]
+				default:
+					return m[0]
+				}
+			})
+		default:
+			return nil, fmt.Errorf("неизвестный шаг нормализации %q", part)
+		}
+	}
+	return steps, nil
+}
+
+// Normalize приводит исходный код к формату бренда
+func (n *SKUNormalizer) Normalize(brand, raw string) string {
+	s := strings.TrimSpace(raw)
+	if n == nil {
+		return cleanCodeDigits(s)
+	}
+
+	steps := n.defaults
+	for _, bp := range n.Brands {
+		if matchesBrand(brand, []string{bp.Brand}) {
+			steps = bp.steps
+			break
+		}
+	}
+
+	for _, step := range steps {
+		s = step(s)
+	}
+	return s
+}
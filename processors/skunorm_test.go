@@ -0,0 +1,98 @@
+package processors
+
+import "testing"
+
+func TestSKUNormalizerSteps(t *testing.T) {
+	tests := []struct {
+		spec string
+		raw  string
+		want string
+	}{
+		{"digits", " 1012-345 A ", "1012345"},
+		{"alnum", "ab-12 /c", "ab12c"},
+		{"alnum", "шк-12", "шк12"},
+		{"upper", "ab12c", "AB12C"},
+		{"strip_zeros", "000123", "123"},
+		{"strip_zeros", "0000", "0"},
+		{"strip_zeros", "", ""},
+		{"pad:7", "12345", "0012345"},
+		{"pad:3", "12345", "12345"},
+		{"pad:5", "", ""},
+		{"last:4", "1234567", "4567"},
+		{"last:10", "1234567", "1234567"},
+		{"regex:^(\\d+)-", "1012-A", "1012"},
+		{"regex:\\d{3}", "ab1234", "123"},
+		{"regex:^\\d+$", "12A", ""},
+		// Шаги выполняются по порядку
+		{"digits|strip_zeros|pad:6", "A-0012-3", "000123"},
+		{"alnum|upper|last:5", "ab-cd-123", "CD123"},
+		// Выражение regex занимает остаток цепочки вместе с "|"
+		{"upper|regex:^(A|B)\\d", "b7", "B"},
+		{" digits | last:2 ", "1234", "34"},
+		{"", " 12-34 ", "12-34"},
+	}
+
+	for _, tt := range tests {
+		n, err := NewSKUNormalizer(tt.spec, "")
+		if err != nil {
+			t.Errorf("цепочка %q: %v", tt.spec, err)
+			continue
+		}
+		if got := n.Normalize("Pirelli", tt.raw); got != tt.want {
+			t.Errorf("цепочка %q: %q -> %q, ожидалось %q", tt.spec, tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestSKUNormalizerInvalidSpec(t *testing.T) {
+	tests := []struct {
+		defaultSpec string
+		brandSpecs  string
+	}{
+		{"lower", ""},
+		{"pad:0", ""},
+		{"last:x", ""},
+		{"regex:(", ""},
+		{"digits", "Hankook"},
+		{"digits", "=digits"},
+		{"digits", "Hankook=pad"},
+	}
+
+	for _, tt := range tests {
+		if _, err := NewSKUNormalizer(tt.defaultSpec, tt.brandSpecs); err == nil {
+			t.Errorf("цепочка %q, бренды %q: ошибка не возвращена", tt.defaultSpec, tt.brandSpecs)
+		}
+	}
+}
+
+func TestSKUNormalizerBrands(t *testing.T) {
+	n, err := NewSKUNormalizer("digits", "Hankook=digits|last:7;Pirelli=alnum|upper;Nokian=regex:^T(\\d+);x")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		brand string
+		raw   string
+		want  string
+	}{
+		{"Hankook", "1 012 345 678", "2345678"},
+		{"HANKOOK", "1012345678", "2345678"},
+		{"Pirelli", "ab-12", "AB12"},
+		// regex последнего бренда забирает остаток строки вместе с ";"
+		{"Nokian", "T429;x", "429"},
+		{"Cordiant", "ab-12", "12"},
+		{"", "ab-12", "12"},
+	}
+	for _, tt := range tests {
+		if got := n.Normalize(tt.brand, tt.raw); got != tt.want {
+			t.Errorf("%s: %q -> %q, ожидалось %q", tt.brand, tt.raw, got, tt.want)
+		}
+	}
+
+	// Без нормализатора код очищается до цифр
+	var none *SKUNormalizer
+	if got := none.Normalize("Pirelli", " 12-34 "); got != "1234" {
+		t.Errorf("без нормализатора: %q", got)
+	}
+}
@@ -0,0 +1,266 @@
+package processors
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"sending-stocks/models"
+)
+
+// TemplateData данные для заполнения Excel шаблона производителя
+type TemplateData struct {
+	Report   string             // отчет (pirelli, ikon, hankook)
+	Date     time.Time          // дата остатков
+	Company  string             // организация
+	Items    []models.StockItem // позиции отчета
+	Total    int                // сумма остатков позиций
+	Count    int                // количество позиций
+	Values   map[string]int     // значения отчета по идентификаторам (колонки Ikon)
+	FirstRow int                // первая строка повторяемого блока после заполнения
+	LastRow  int                // последняя строка повторяемого блока после заполнения
+}
+
+// NewTemplateData заполняет итоги по позициям отчета
+func NewTemplateData(report string, date time.Time, company string, items []models.StockItem, values map[string]int) TemplateData {
+	total := 0
+	for _, item := range items {
+		total += item.Quantity
+	}
+	return TemplateData{
+		Report:  report,
+		Date:    date,
+		Company: company,
+		Items:   items,
+		Total:   total,
+		Count:   len(items),
+		Values:  values,
+	}
+}
+
+// templateRow данные строки повторяемого блока: общие данные и текущая позиция
+type templateRow struct {
+	TemplateData
+	Item  models.StockItem
+	Index int // номер позиции с 1
+}
+
+// templateFuncs функции, доступные в ячейках шаблона
+var templateFuncs = template.FuncMap{
+	"rim": RimDiameter,
+	"season": func(item models.StockItem) string {
+		return hankookSeason(item)
+	},
+	"date": func(t time.Time, layout string) string {
+		return t.Format(layout)
+	},
+}
+
+// templateCell ячейка шаблона с подстановками
+type templateCell struct {
+	Col  int
+	Row  int
+	Text string
+}
+
+// sheetTemplate ячейки листа с подстановками; repeatRow - строка, повторяемая для каждой позиции
+// (содержит .Item), 0 - такой строки нет
+type sheetTemplate struct {
+	Cells     []templateCell
+	RepeatRow int
+}
+
+// scanTemplate находит ячейки с подстановками {{...}} на листе
+func scanTemplate(f *excelize.File, sheet string) (*sheetTemplate, error) {
+	rows, err := f.GetRows(sheet, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, err
+	}
+
+	st := &sheetTemplate{}
+	for r, row := range rows {
+		for c, value := range row {
+			if !strings.Contains(value, "{{") {
+				continue
+			}
+			st.Cells = append(st.Cells, templateCell{Col: c + 1, Row: r + 1, Text: value})
+			if strings.Contains(value, ".Item") && st.RepeatRow != r+1 {
+				if st.RepeatRow != 0 {
+					return nil, fmt.Errorf("лист %s: позиции (.Item) используются в строках %d и %d, допускается одна строка",
+						sheet, st.RepeatRow, r+1)
+				}
+				st.RepeatRow = r + 1
+			}
+		}
+	}
+	return st, nil
+}
+
+// parseCellTemplate разбирает подстановки ячейки
+func parseCellTemplate(cell string, text string) (*template.Template, error) {
+	tmpl, err := template.New(cell).Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("ячейка %s: %v", cell, err)
+	}
+	return tmpl, nil
+}
+
+// ValidateTemplate проверяет шаблон: синтаксис подстановок и поля, на которые они ссылаются
+// (пробное заполнение одной пустой позицией)
+func ValidateTemplate(f *excelize.File) error {
+	sample := NewTemplateData("", time.Now(), "", []models.StockItem{{}}, map[string]int{})
+	found := false
+	for _, sheet := range f.GetSheetList() {
+		st, err := scanTemplate(f, sheet)
+		if err != nil {
+			return err
+		}
+		for _, cell := range st.Cells {
+			found = true
+			name, _ := excelize.CoordinatesToCellName(cell.Col, cell.Row)
+			tmpl, err := parseCellTemplate(name, cell.Text)
+			if err != nil {
+				return fmt.Errorf("лист %s: %v", sheet, err)
+			}
+			var data interface{} = sample
+			if cell.Row == st.RepeatRow {
+				data = templateRow{TemplateData: sample, Item: sample.Items[0], Index: 1}
+			}
+			if err := tmpl.Execute(&bytes.Buffer{}, data); err != nil {
+				return fmt.Errorf("лист %s, ячейка %s: %v", sheet, name, err)
+			}
+		}
+	}
+	if !found {
+		return fmt.Errorf("в шаблоне нет подстановок {{...}}")
+	}
+	return nil
+}
+
+// RenderTemplate заполняет открытый шаблон: строка с .Item повторяется для каждой позиции
+// (с сохранением стилей), остальные подстановки заполняются общими данными.
+// Ячейка шаблона, начинающаяся с "=", записывается как формула (например =SUM(E{{.FirstRow}}:E{{.LastRow}}))
+func RenderTemplate(f *excelize.File, data TemplateData) error {
+	for _, sheet := range f.GetSheetList() {
+		st, err := scanTemplate(f, sheet)
+		if err != nil {
+			return err
+		}
+		if len(st.Cells) == 0 {
+			continue
+		}
+
+		// Сдвиг строк ниже повторяемого блока
+		shift := 0
+		sheetData := data
+		if st.RepeatRow > 0 {
+			shift = len(data.Items) - 1
+			sheetData.FirstRow = st.RepeatRow
+			sheetData.LastRow = st.RepeatRow + shift
+			if len(data.Items) == 0 {
+				if err := f.RemoveRow(sheet, st.RepeatRow); err != nil {
+					return err
+				}
+				sheetData.LastRow = st.RepeatRow - 1
+			} else if shift > 0 {
+				if err := f.InsertRows(sheet, st.RepeatRow+1, shift); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, cell := range st.Cells {
+			name, _ := excelize.CoordinatesToCellName(cell.Col, cell.Row)
+			tmpl, err := parseCellTemplate(name, cell.Text)
+			if err != nil {
+				return fmt.Errorf("лист %s: %v", sheet, err)
+			}
+
+			if cell.Row != st.RepeatRow {
+				row := cell.Row
+				if st.RepeatRow > 0 && row > st.RepeatRow {
+					row += shift
+				}
+				if err := renderCell(f, sheet, cell.Col, row, cell.Text, tmpl, sheetData); err != nil {
+					return err
+				}
+				continue
+			}
+
+			// Повторяемая строка: стиль и высота переносятся на все строки блока
+			style, _ := f.GetCellStyle(sheet, name)
+			height, _ := f.GetRowHeight(sheet, cell.Row)
+			for i, item := range data.Items {
+				row := cell.Row + i
+				if i > 0 {
+					target, _ := excelize.CoordinatesToCellName(cell.Col, row)
+					f.SetCellStyle(sheet, target, target, style)
+					f.SetRowHeight(sheet, row, height)
+				}
+				rowData := templateRow{TemplateData: sheetData, Item: item, Index: i + 1}
+				if err := renderCell(f, sheet, cell.Col, row, cell.Text, tmpl, rowData); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// numericFields числовые поля: ячейка из одной такой подстановки записывается числом, остальные -
+// текстом (коды производителя с ведущими нулями не превращаются в числа)
+var numericFields = map[string]bool{
+	"Quantity": true, "RawQuantity": true, "Price": true, "RowNum": true, "ProductionYear": true, "DOTWeek": true,
+	"Total": true, "Count": true, "Index": true, "FirstRow": true, "LastRow": true,
+}
+
+// isNumericCell проверяет, что ячейка - одна подстановка числового поля ({{.Item.Quantity}}, {{.Values.total}})
+func isNumericCell(text string) bool {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "{{") || !strings.HasSuffix(text, "}}") || strings.Count(text, "{{") != 1 {
+		return false
+	}
+	field := strings.Trim(strings.TrimSpace(text[2:len(text)-2]), "- ")
+	if !strings.HasPrefix(field, ".") || strings.ContainsAny(field, " |()") {
+		return false
+	}
+	if strings.HasPrefix(field, ".Values.") {
+		return true
+	}
+	return numericFields[field[strings.LastIndex(field, ".")+1:]]
+}
+
+// renderCell записывает результат подстановки: формулу (текст шаблона начинается с "="), число (одна
+// подстановка числового поля) или текст. Данные из ведомости, начинающиеся с "=", остаются текстом
+func renderCell(f *excelize.File, sheet string, col, row int, text string, tmpl *template.Template, data interface{}) error {
+	cell, _ := excelize.CoordinatesToCellName(col, row)
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return fmt.Errorf("лист %s, ячейка %s: %v", sheet, cell, err)
+	}
+	value := buf.String()
+
+	if strings.HasPrefix(text, "=") {
+		// Текст подстановки не должен остаться кэшированным значением формулы
+		if err := f.SetCellValue(sheet, cell, nil); err != nil {
+			return err
+		}
+		return f.SetCellFormula(sheet, cell, value)
+	}
+
+	if isNumericCell(text) {
+		if n, err := strconv.Atoi(value); err == nil {
+			return f.SetCellValue(sheet, cell, n)
+		}
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return f.SetCellValue(sheet, cell, n)
+		}
+	}
+	return f.SetCellValue(sheet, cell, value)
+}
@@ -0,0 +1,36 @@
+package processors
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"sending-stocks/models"
+)
+
+// rimPattern посадочный диаметр в типоразмере или наименовании: R16, ZR17, R 17.5, R15C
+var rimPattern = regexp.MustCompile(`(?i)(?:^|[\s/\d])Z?R\s?(\d{2}(?:[.,]5)?)C?(?:$|[\s/)])`)
+
+// RimDiameter посадочный диаметр позиции ("R16", "R17.5") по типоразмеру, а если его нет - по наименованию.
+// Пустая строка - диаметр не определен
+func RimDiameter(item models.StockItem) string {
+	for _, text := range []string{item.TireSize, item.Name} {
+		if m := rimPattern.FindStringSubmatch(text); m != nil {
+			return "R" + strings.Replace(m[1], ",", ".", 1)
+		}
+	}
+	return ""
+}
+
+// rimLess порядок диаметров: по возрастанию числа, неопределенный диаметр - последним
+func rimLess(a, b string) bool {
+	if a == "" || b == "" {
+		return b == "" && a != ""
+	}
+	x, _ := strconv.ParseFloat(strings.TrimPrefix(a, "R"), 64)
+	y, _ := strconv.ParseFloat(strings.TrimPrefix(b, "R"), 64)
+	if x != y {
+		return x < y
+	}
+	return a < b
+}
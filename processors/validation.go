@@ -0,0 +1,275 @@
+package processors
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"sending-stocks/models"
+)
+
+// ValidationRule правило проверки позиции, задается в конфигурации (JSON)
+//
+// Пример:
+//
+//	{"id": "pirelli-sku", "severity": "error", "brands": ["Pirelli", "Formula"],
+//	 "field": "manufacturer_sku", "check": "length", "value": "7",
+//	 "message": "код Pirelli должен состоять из 7 символов"}
+type ValidationRule struct {
+	ID       string   `json:"id"`
+	Severity string   `json:"severity"` // error или warning
+	Brands   []string `json:"brands"`   // пусто - правило для всех брендов
+	Field    string   `json:"field"`    // имя поля StockItem как в JSON (manufacturer_sku, price, ...)
+	Check    string   `json:"check"`    // required, length, min_length, max_length, regex, min, max
+	Value    string   `json:"value"`    // параметр проверки
+	Message  string   `json:"message"`  // текст для пользователя
+
+	re *regexp.Regexp
+}
+
+// Validator выполняет правила валидации над позициями
+type Validator struct {
+	Rules []ValidationRule
+}
+
+// NewValidator создает валидатор и проверяет корректность правил
+func NewValidator(rules []ValidationRule) (*Validator, error) {
+	for i := range rules {
+		rule := &rules[i]
+
+		if rule.Severity == "" {
+			rule.Severity = models.SeverityWarning
+		}
+		if rule.Severity != models.SeverityError && rule.Severity != models.SeverityWarning {
+			return nil, fmt.Errorf("правило %s: неизвестный уровень %q", rule.ID, rule.Severity)
+		}
+
+		if _, ok := stockItemField(models.StockItem{}, rule.Field); !ok {
+			return nil, fmt.Errorf("правило %s: неизвестное поле %q", rule.ID, rule.Field)
+		}
+
+		switch rule.Check {
+		case "required":
+		case "length", "min_length", "max_length":
+			if _, err := strconv.Atoi(rule.Value); err != nil {
+				return nil, fmt.Errorf("правило %s: значение %q не является числом", rule.ID, rule.Value)
+			}
+		case "min", "max":
+			if _, err := strconv.ParseFloat(rule.Value, 64); err != nil {
+				return nil, fmt.Errorf("правило %s: значение %q не является числом", rule.ID, rule.Value)
+			}
+		case "regex":
+			re, err := regexp.Compile(rule.Value)
+			if err != nil {
+				return nil, fmt.Errorf("правило %s: неверное регулярное выражение: %v", rule.ID, err)
+			}
+			rule.re = re
+		default:
+			return nil, fmt.Errorf("правило %s: неизвестная проверка %q", rule.ID, rule.Check)
+		}
+	}
+
+	return &Validator{Rules: rules}, nil
+}
+
+// LoadValidationRules читает список правил из JSON файла
+func LoadValidationRules(path string) ([]ValidationRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать файл правил: %v", err)
+	}
+
+	var rules []ValidationRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("ошибка разбора файла правил: %v", err)
+	}
+	return rules, nil
+}
+
+// DefaultValidationRules правила по умолчанию, если файл правил не задан
+func DefaultValidationRules(pirelliBrands, cordiantBrands []string) []ValidationRule {
+	return []ValidationRule{
+		{
+			ID:       "price-zero",
+			Severity: models.SeverityWarning,
+			Field:    "price",
+			Check:    "min",
+			Value:    "0.01",
+			Message:  "не указана цена",
+		},
+		{
+			ID:       "pirelli-sku",
+			Severity: models.SeverityWarning,
+			Brands:   pirelliBrands,
+			Field:    "manufacturer_sku",
+			Check:    "required",
+			Message:  "нет кода Pirelli, позиция не попадет в CSV",
+		},
+		{
+			ID:       "cordiant-sku",
+			Severity: models.SeverityWarning,
+			Brands:   cordiantBrands,
+			Field:    "manufacturer_sku",
+			Check:    "required",
+			Message:  "нет кода Cordiant, позиция не попадет в отчет",
+		},
+	}
+}
+
+// Validate проверяет позиции и возвращает список замечаний
+func (v *Validator) Validate(items []models.StockItem) []models.ValidationFinding {
+	findings := make([]models.ValidationFinding, 0)
+	if v == nil {
+		return findings
+	}
+
+	for _, item := range items {
+		for _, rule := range v.Rules {
+			if len(rule.Brands) > 0 && !matchesBrand(item.CleanBrand, rule.Brands) {
+				continue
+			}
+
+			value, _ := stockItemField(item, rule.Field)
+			if rule.passes(value) {
+				continue
+			}
+
+			message := rule.Message
+			if message == "" {
+				message = fmt.Sprintf("поле %s не прошло проверку %s %s", rule.Field, rule.Check, rule.Value)
+			}
+
+			findings = append(findings, models.ValidationFinding{
+				Source:          item.Source,
+				Sheet:           item.Sheet,
+				RowNum:          item.RowNum,
+				RuleID:          rule.ID,
+				Severity:        rule.Severity,
+				Field:           rule.Field,
+				Value:           value,
+				Message:         message,
+				Code1C:          item.Code1C,
+				ManufacturerSKU: item.ManufacturerSKU,
+				Brand:           item.CleanBrand,
+			})
+		}
+	}
+
+	return findings
+}
+
+// passes проверяет значение поля по правилу
+func (r *ValidationRule) passes(value string) bool {
+	switch r.Check {
+	case "required":
+		return strings.TrimSpace(value) != ""
+	case "length", "min_length", "max_length":
+		// Пустое значение проверяется правилом required
+		if value == "" {
+			return true
+		}
+		limit, _ := strconv.Atoi(r.Value)
+		length := utf8.RuneCountInString(value)
+		switch r.Check {
+		case "length":
+			return length == limit
+		case "min_length":
+			return length >= limit
+		default:
+			return length <= limit
+		}
+	case "regex":
+		if value == "" {
+			return true
+		}
+		return r.re.MatchString(value)
+	case "min", "max":
+		limit, _ := strconv.ParseFloat(r.Value, 64)
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return false
+		}
+		if r.Check == "min" {
+			return number >= limit
+		}
+		return number <= limit
+	}
+	return true
+}
+
+// stockItemField возвращает значение поля позиции по имени из JSON
+func stockItemField(item models.StockItem, field string) (string, bool) {
+	switch field {
+	case "name":
+		return item.Name, true
+	case "brand":
+		return item.Brand, true
+	case "clean_brand":
+		return item.CleanBrand, true
+	case "season":
+		return item.Season, true
+	case "code_1c":
+		return item.Code1C, true
+	case "manufacturer_sku":
+		return item.ManufacturerSKU, true
+	case "raw_manufacturer_sku":
+		return item.RawManufacturerSKU, true
+	case "tire_size":
+		return item.TireSize, true
+	case "quantity":
+		return strconv.Itoa(item.Quantity), true
+	case "raw_quantity":
+		return formatNumber(item.RawQuantity), true
+	case "price":
+		return formatNumber(item.Price), true
+	case "characteristic":
+		return item.Characteristic, true
+	case "source":
+		return item.Source, true
+	case "sheet":
+		return item.Sheet, true
+	case "row_num":
+		return strconv.Itoa(item.RowNum), true
+	case "rim":
+		return RimDiameter(item), true
+	case "production_year":
+		if item.ProductionYear == 0 {
+			return "", true
+		}
+		return strconv.Itoa(item.ProductionYear), true
+	}
+	return "", false
+}
+
+// matchesBrand проверяет, относится ли бренд к списку (вхождение без учета регистра)
+func matchesBrand(brand string, brands []string) bool {
+	brandLower := strings.ToLower(strings.TrimSpace(brand))
+	if brandLower == "" {
+		return false
+	}
+	for _, b := range brands {
+		bLower := strings.ToLower(strings.TrimSpace(b))
+		if bLower == "" {
+			continue
+		}
+		if strings.Contains(brandLower, bLower) || strings.Contains(bLower, brandLower) {
+			return true
+		}
+	}
+	return false
+}
+
+// BlockingFindings возвращает ошибки валидации, относящиеся к указанным строкам (ключи models.RowKey)
+func BlockingFindings(findings []models.ValidationFinding, rows map[string]bool) []models.ValidationFinding {
+	result := make([]models.ValidationFinding, 0)
+	for _, f := range findings {
+		if f.Severity == models.SeverityError && rows[models.RowKey(f.Source, f.Sheet, f.RowNum)] {
+			result = append(result, f)
+		}
+	}
+	return result
+}
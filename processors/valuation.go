@@ -0,0 +1,429 @@
+package processors
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"sending-stocks/models"
+)
+
+// valuationUnknown подпись группы, если значение не определено
+const valuationUnknown = "не указан"
+
+// ValuationGroup стоимость остатков группы (бренд, сезон, диаметр или склад)
+type ValuationGroup struct {
+	Name             string  `json:"name"`
+	Positions        int     `json:"positions"`         // строк ведомости с остатком
+	Quantity         int     `json:"quantity"`          // остаток, шт
+	UnpricedQuantity int     `json:"unpriced_quantity"` // остаток без цены, шт (не входит в среднюю цену)
+	Value            float64 `json:"value"`             // стоимость остатка
+	AveragePrice     float64 `json:"average_price"`     // средняя цена единицы с ценой
+	Share            float64 `json:"share"`             // доля в общей стоимости, %
+}
+
+// ValuationSKU стоимость остатка одного кода товара
+type ValuationSKU struct {
+	ManufacturerSKU string  `json:"manufacturer_sku"`
+	Code1C          string  `json:"code_1c"`
+	Brand           string  `json:"brand"`
+	Name            string  `json:"name"`
+	TireSize        string  `json:"tire_size"`
+	Quantity        int     `json:"quantity"`
+	AveragePrice    float64 `json:"average_price"`
+	Value           float64 `json:"value"`
+	Share           float64 `json:"share"`
+}
+
+// Valuation оценка остатков снимка по цене из ведомости (столбец J)
+type Valuation struct {
+	StockDate   string           `json:"stock_date"`
+	Total       ValuationGroup   `json:"total"`
+	ByBrand     []ValuationGroup `json:"by_brand"`
+	BySeason    []ValuationGroup `json:"by_season"`
+	ByRim       []ValuationGroup `json:"by_rim"`
+	ByWarehouse []ValuationGroup `json:"by_warehouse"` // лист ведомости (у объединенного снимка - файл и лист)
+	TopSKUs     []ValuationSKU   `json:"top_skus"`
+}
+
+// ValuationProcessor формирует внутренний отчет о стоимости остатков
+type ValuationProcessor struct {
+	TopSKUs int // сколько самых дорогих по остатку кодов показывать
+}
+
+// NewValuationProcessor создает процессор оценки остатков
+func NewValuationProcessor(topSKUs int) (*ValuationProcessor, error) {
+	if topSKUs <= 0 {
+		return nil, fmt.Errorf("количество кодов в топе должно быть положительным: %d", topSKUs)
+	}
+	return &ValuationProcessor{
+		TopSKUs: topSKUs,
+	}, nil
+}
+
+// valuationAcc накопитель группы
+type valuationAcc struct {
+	group  ValuationGroup
+	priced int // остаток с ценой
+}
+
+func (a *valuationAcc) add(quantity int, price float64) {
+	a.group.Quantity += quantity
+	if price > 0 {
+		a.group.Value += float64(quantity) * price
+		a.priced += quantity
+	} else {
+		a.group.UnpricedQuantity += quantity
+	}
+}
+
+func (a *valuationAcc) result(totalValue float64) ValuationGroup {
+	g := a.group
+	if a.priced > 0 {
+		g.AveragePrice = roundMoney(g.Value / float64(a.priced))
+	}
+	if totalValue > 0 {
+		g.Share = roundMoney(g.Value / totalValue * 100)
+	}
+	g.Value = roundMoney(g.Value)
+	return g
+}
+
+// valuationGroups накопители по ключу группы в порядке появления
+type valuationGroups struct {
+	keys []string
+	accs map[string]*valuationAcc
+}
+
+func (g *valuationGroups) get(key string) *valuationAcc {
+	if g.accs == nil {
+		g.accs = make(map[string]*valuationAcc)
+	}
+	acc, ok := g.accs[key]
+	if !ok {
+		acc = &valuationAcc{group: ValuationGroup{Name: key}}
+		g.accs[key] = acc
+		g.keys = append(g.keys, key)
+	}
+	return acc
+}
+
+// results группы по убыванию стоимости (less - свой порядок)
+func (g *valuationGroups) results(totalValue float64, less func(a, b string) bool) []ValuationGroup {
+	result := make([]ValuationGroup, 0, len(g.keys))
+	for _, key := range g.keys {
+		result = append(result, g.accs[key].result(totalValue))
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if less != nil {
+			return less(result[i].Name, result[j].Name)
+		}
+		return result[i].Value > result[j].Value
+	})
+	return result
+}
+
+// valuationParts остаток позиции по строкам-источникам, каждая со своей ценой: у сложенных дубликатов
+// и объединенных ведомостей филиалов цена одной строки не подходит для остатка других складов
+func valuationParts(item models.StockItem) []models.StockSource {
+	if len(item.Sources) == 0 {
+		return []models.StockSource{stockSource(item)}
+	}
+
+	parts := slices.Clone(item.Sources)
+	// В снимках, сохраненных до появления цены источника, цена есть только у позиции
+	if !slices.ContainsFunc(parts, func(src models.StockSource) bool { return src.Price != 0 }) {
+		for i := range parts {
+			parts[i].Price = item.Price
+		}
+	}
+	return parts
+}
+
+// Calculate оценивает остатки: учитываются позиции с положительным остатком, позиции без цены
+// входят в количество, но не в стоимость и среднюю цену
+func (p *ValuationProcessor) Calculate(items []models.StockItem, stockDate time.Time) *Valuation {
+	var total valuationAcc
+	var brands, seasons, rims, warehouses valuationGroups
+	type skuAcc struct {
+		sku    ValuationSKU
+		priced int
+	}
+	var skuKeys []string
+	skus := make(map[string]*skuAcc)
+
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			continue
+		}
+
+		rim := RimDiameter(item)
+		if rim == "" {
+			rim = valuationUnknown
+		}
+		parts := valuationParts(item)
+		for _, acc := range []*valuationAcc{
+			&total,
+			brands.get(valuationName(item.CleanBrand)),
+			seasons.get(valuationName(item.Season)),
+			rims.get(rim),
+		} {
+			for _, part := range parts {
+				acc.add(part.Quantity, part.Price)
+			}
+			acc.group.Positions++
+		}
+
+		// Остаток объединенной позиции распределяется по складам источников целиком, как и в итогах выше,
+		// чтобы склады в сумме давали итог; позицией склада считается только источник с остатком
+		for _, part := range parts {
+			acc := warehouses.get(warehouseName(part.Source, part.Sheet))
+			acc.add(part.Quantity, part.Price)
+			if part.Quantity > 0 {
+				acc.group.Positions++
+			}
+		}
+
+		key := item.ManufacturerSKU
+		if key == "" {
+			key = "1C:" + item.Code1C
+		}
+		s, ok := skus[key]
+		if !ok {
+			s = &skuAcc{sku: ValuationSKU{
+				ManufacturerSKU: item.ManufacturerSKU,
+				Code1C:          item.Code1C,
+				Brand:           item.CleanBrand,
+				Name:            item.Name,
+				TireSize:        item.TireSize,
+			}}
+			skus[key] = s
+			skuKeys = append(skuKeys, key)
+		}
+		for _, part := range parts {
+			s.sku.Quantity += part.Quantity
+			if part.Price > 0 {
+				s.sku.Value += float64(part.Quantity) * part.Price
+				s.priced += part.Quantity
+			}
+		}
+	}
+
+	totalValue := total.group.Value
+	v := &Valuation{
+		StockDate:   stockDate.Format(ReportDateLayout),
+		Total:       total.result(totalValue),
+		ByBrand:     brands.results(totalValue, nil),
+		BySeason:    seasons.results(totalValue, nil),
+		ByRim:       rims.results(totalValue, valuationRimLess),
+		ByWarehouse: warehouses.results(totalValue, nil),
+		TopSKUs:     make([]ValuationSKU, 0, p.TopSKUs),
+	}
+	v.Total.Name = "Итого"
+
+	top := make([]ValuationSKU, 0, len(skuKeys))
+	for _, key := range skuKeys {
+		s := skus[key]
+		if s.sku.Value <= 0 {
+			continue
+		}
+		sku := s.sku
+		sku.AveragePrice = roundMoney(sku.Value / float64(s.priced))
+		if totalValue > 0 {
+			sku.Share = roundMoney(sku.Value / totalValue * 100)
+		}
+		top = append(top, sku)
+	}
+	sort.SliceStable(top, func(i, j int) bool {
+		return top[i].Value > top[j].Value
+	})
+	for i := 0; i < len(top) && i < p.TopSKUs; i++ {
+		top[i].Value = roundMoney(top[i].Value)
+		v.TopSKUs = append(v.TopSKUs, top[i])
+	}
+
+	return v
+}
+
+// CreateReport создает книгу: сводка и листы по брендам, сезонам, диаметрам, складам и топ кодов
+func (p *ValuationProcessor) CreateReport(v *Valuation) (*excelize.File, error) {
+	f := excelize.NewFile()
+
+	headerStyle, _ := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{
+			Bold: true,
+			Size: 12,
+		},
+		Fill: excelize.Fill{
+			Type:    "pattern",
+			Color:   []string{"#E0E0E0"},
+			Pattern: 1,
+		},
+	})
+	totalStyle, _ := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{
+			Bold: true,
+		},
+		Fill: excelize.Fill{
+			Type:    "pattern",
+			Color:   []string{"#F2F2F2"},
+			Pattern: 1,
+		},
+	})
+	moneyFormat := "#,##0.00"
+	moneyStyle, _ := f.NewStyle(&excelize.Style{CustomNumFmt: &moneyFormat})
+	totalMoneyStyle, _ := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{
+			Bold: true,
+		},
+		Fill: excelize.Fill{
+			Type:    "pattern",
+			Color:   []string{"#F2F2F2"},
+			Pattern: 1,
+		},
+		CustomNumFmt: &moneyFormat,
+	})
+
+	// Сводка
+	const summary = "Оценка"
+	f.SetSheetName("Sheet1", summary)
+	rows := [][]interface{}{
+		{"Дата остатков", v.StockDate},
+		{"Позиций с остатком", v.Total.Positions},
+		{"Остаток, шт", v.Total.Quantity},
+		{"Остаток без цены, шт", v.Total.UnpricedQuantity},
+		{"Стоимость остатка", v.Total.Value},
+		{"Средняя цена единицы", v.Total.AveragePrice},
+	}
+	for i, row := range rows {
+		f.SetCellValue(summary, fmt.Sprintf("A%d", i+1), row[0])
+		f.SetCellValue(summary, fmt.Sprintf("B%d", i+1), row[1])
+	}
+	f.SetCellStyle(summary, "A1", fmt.Sprintf("A%d", len(rows)), totalStyle)
+	f.SetCellStyle(summary, "B5", "B6", moneyStyle)
+	f.SetColWidth(summary, "A", "A", 26)
+	f.SetColWidth(summary, "B", "B", 18)
+
+	groupSheets := []struct {
+		name    string
+		caption string
+		groups  []ValuationGroup
+	}{
+		{"Бренды", "Бренд", v.ByBrand},
+		{"Сезоны", "Сезон", v.BySeason},
+		{"Диаметры", "Диаметр", v.ByRim},
+		{"Склады", "Склад", v.ByWarehouse},
+	}
+	for _, gs := range groupSheets {
+		f.NewSheet(gs.name)
+		headers := []string{gs.caption, "Позиций", "Остаток", "Без цены", "Стоимость", "Средняя цена", "Доля, %"}
+		for i, header := range headers {
+			f.SetCellValue(gs.name, fmt.Sprintf("%s1", string(rune('A'+i))), header)
+		}
+		f.SetCellStyle(gs.name, "A1", "G1", headerStyle)
+
+		row := 2
+		for _, g := range gs.groups {
+			f.SetCellValue(gs.name, fmt.Sprintf("A%d", row), g.Name)
+			f.SetCellValue(gs.name, fmt.Sprintf("B%d", row), g.Positions)
+			f.SetCellValue(gs.name, fmt.Sprintf("C%d", row), g.Quantity)
+			f.SetCellValue(gs.name, fmt.Sprintf("D%d", row), g.UnpricedQuantity)
+			f.SetCellValue(gs.name, fmt.Sprintf("E%d", row), g.Value)
+			f.SetCellValue(gs.name, fmt.Sprintf("F%d", row), g.AveragePrice)
+			f.SetCellValue(gs.name, fmt.Sprintf("G%d", row), g.Share)
+			row++
+		}
+		f.SetCellStyle(gs.name, "E2", fmt.Sprintf("F%d", row), moneyStyle)
+
+		// Итог листа
+		f.SetCellValue(gs.name, fmt.Sprintf("A%d", row), "ИТОГО")
+		for _, col := range []string{"B", "C", "D", "E"} {
+			f.SetCellFormula(gs.name, fmt.Sprintf("%s%d", col, row), fmt.Sprintf("=SUM(%s2:%s%d)", col, col, row-1))
+		}
+		f.SetCellValue(gs.name, fmt.Sprintf("F%d", row), v.Total.AveragePrice)
+		f.SetCellStyle(gs.name, fmt.Sprintf("A%d", row), fmt.Sprintf("G%d", row), totalStyle)
+		f.SetCellStyle(gs.name, fmt.Sprintf("E%d", row), fmt.Sprintf("F%d", row), totalMoneyStyle)
+
+		colWidths := map[string]float64{"A": 30, "B": 10, "C": 10, "D": 10, "E": 16, "F": 14, "G": 10}
+		for col, width := range colWidths {
+			f.SetColWidth(gs.name, col, col, width)
+		}
+	}
+
+	// Топ кодов по стоимости остатка
+	const topSheet = "Топ SKU"
+	f.NewSheet(topSheet)
+	headers := []string{"Код производителя", "Код 1С", "Бренд", "Наименование", "Типоразмер", "Остаток", "Средняя цена", "Стоимость", "Доля, %"}
+	for i, header := range headers {
+		f.SetCellValue(topSheet, fmt.Sprintf("%s1", string(rune('A'+i))), header)
+	}
+	f.SetCellStyle(topSheet, "A1", "I1", headerStyle)
+	for i, sku := range v.TopSKUs {
+		row := i + 2
+		f.SetCellValue(topSheet, fmt.Sprintf("A%d", row), sku.ManufacturerSKU)
+		f.SetCellValue(topSheet, fmt.Sprintf("B%d", row), sku.Code1C)
+		f.SetCellValue(topSheet, fmt.Sprintf("C%d", row), sku.Brand)
+		f.SetCellValue(topSheet, fmt.Sprintf("D%d", row), sku.Name)
+		f.SetCellValue(topSheet, fmt.Sprintf("E%d", row), sku.TireSize)
+		f.SetCellValue(topSheet, fmt.Sprintf("F%d", row), sku.Quantity)
+		f.SetCellValue(topSheet, fmt.Sprintf("G%d", row), sku.AveragePrice)
+		f.SetCellValue(topSheet, fmt.Sprintf("H%d", row), sku.Value)
+		f.SetCellValue(topSheet, fmt.Sprintf("I%d", row), sku.Share)
+	}
+	if len(v.TopSKUs) > 0 {
+		f.SetCellStyle(topSheet, "G2", fmt.Sprintf("H%d", len(v.TopSKUs)+1), moneyStyle)
+	}
+	colWidths := map[string]float64{"A": 18, "B": 12, "C": 16, "D": 50, "E": 15, "F": 10, "G": 14, "H": 16, "I": 10}
+	for col, width := range colWidths {
+		f.SetColWidth(topSheet, col, col, width)
+	}
+
+	f.SetActiveSheet(0)
+	return f, nil
+}
+
+// GenerateFilename генерирует имя файла по дате остатков
+func (p *ValuationProcessor) GenerateFilename(stockDate time.Time) string {
+	return fmt.Sprintf("Stock_Valuation_%s.xlsx", stockDate.Format("20060102"))
+}
+
+// valuationName подпись группы; пустое значение - «не указан»
+func valuationName(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return valuationUnknown
+	}
+	return value
+}
+
+// warehouseName склад позиции: лист ведомости, у объединенного снимка - файл у пользователя и лист
+func warehouseName(source, sheet string) string {
+	switch {
+	case source != "" && sheet != "":
+		return source + " / " + sheet
+	case source != "":
+		return source
+	default:
+		return valuationName(sheet)
+	}
+}
+
+// valuationRimLess порядок диаметров по возрастанию, «не указан» - последним
+func valuationRimLess(a, b string) bool {
+	if a == valuationUnknown {
+		a = ""
+	}
+	if b == valuationUnknown {
+		b = ""
+	}
+	return rimLess(a, b)
+}
+
+// roundMoney округляет сумму до копеек
+func roundMoney(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,87 @@
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"sending-stocks/models"
+)
+
+func TestValuationPricesEachSource(t *testing.T) {
+	resolver, err := NewDuplicateResolver(DuplicateSum, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Один код на двух складах по разной цене: остаток складывается в первую строку
+	items, _, _ := resolver.Resolve([]models.StockItem{
+		{Sheet: "Москва", RowNum: 2, CleanBrand: "Pirelli", Season: "зима", ManufacturerSKU: "123", Quantity: 4, Price: 5000},
+		{Sheet: "Тверь", RowNum: 3, CleanBrand: "Pirelli", Season: "зима", ManufacturerSKU: "123", Quantity: 2, Price: 6000},
+		{Sheet: "Тверь", RowNum: 4, CleanBrand: "Pirelli", Season: "зима", ManufacturerSKU: "123", Quantity: 1},
+	})
+	if len(items) != 1 || items[0].Quantity != 7 {
+		t.Fatalf("дубликаты не сложены: %+v", items)
+	}
+
+	p, err := NewValuationProcessor(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := p.Calculate(items, time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC))
+
+	if v.Total.Quantity != 7 || v.Total.UnpricedQuantity != 1 || v.Total.Value != 32000 {
+		t.Errorf("итог: %+v, ожидалось 7 шт на 32000, 1 шт без цены", v.Total)
+	}
+	if v.Total.AveragePrice != 5333.33 {
+		t.Errorf("средняя цена %v, ожидалось 5333.33", v.Total.AveragePrice)
+	}
+	if len(v.TopSKUs) != 1 || v.TopSKUs[0].Value != 32000 {
+		t.Errorf("топ кодов: %+v", v.TopSKUs)
+	}
+
+	warehouses := make(map[string]ValuationGroup)
+	for _, g := range v.ByWarehouse {
+		warehouses[g.Name] = g
+	}
+	if g := warehouses["Москва"]; g.Quantity != 4 || g.Value != 20000 {
+		t.Errorf("склад Москва: %+v", g)
+	}
+	if g := warehouses["Тверь"]; g.Quantity != 3 || g.Value != 12000 || g.UnpricedQuantity != 1 {
+		t.Errorf("склад Тверь: %+v", g)
+	}
+}
+
+func TestValuationWarehousesSumToTotal(t *testing.T) {
+	// Объединенная позиция: на одном складе пересорт (минус), в сумме остаток положительный
+	items := []models.StockItem{
+		{Source: "msk.xlsx", Sheet: "Склад", CleanBrand: "Pirelli", ManufacturerSKU: "123", Quantity: 3, Price: 5000,
+			Sources: []models.StockSource{
+				{Source: "msk.xlsx", Sheet: "Склад", RowNum: 2, Quantity: 5, Price: 5000},
+				{Source: "tver.xlsx", Sheet: "Склад", RowNum: 7, Quantity: -2, Price: 5000},
+			}},
+		{Source: "tver.xlsx", Sheet: "Склад", CleanBrand: "Pirelli", ManufacturerSKU: "456", Quantity: 4, Price: 1000},
+	}
+
+	p, err := NewValuationProcessor(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := p.Calculate(items, time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC))
+
+	var quantity int
+	var value float64
+	for _, g := range v.ByWarehouse {
+		quantity += g.Quantity
+		value += g.Value
+	}
+	if quantity != v.Total.Quantity || value != v.Total.Value {
+		t.Errorf("склады: %d шт на %v, итог: %d шт на %v", quantity, value, v.Total.Quantity, v.Total.Value)
+	}
+
+	warehouses := make(map[string]ValuationGroup)
+	for _, g := range v.ByWarehouse {
+		warehouses[g.Name] = g
+	}
+	if g := warehouses["tver.xlsx / Склад"]; g.Quantity != 2 || g.Positions != 1 {
+		t.Errorf("склад tver.xlsx: %+v", g)
+	}
+}
@@ -3,52 +3,109 @@ package services
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"sending-stocks/models"
 )
 
+// ErrCordiantUnreachable сервер API Cordiant не ответил (ошибка сети, таймаут)
+var ErrCordiantUnreachable = errors.New("ошибка подключения к Cordiant")
+
+// cordiantAuthErrorCodes коды ошибок API Cordiant, означающие недействительный токен
+var cordiantAuthErrorCodes = []string{"invalid_token", "token_expired", "token_invalid", "unauthorized"}
+
 // CordiantAPIService клиент для API Cordiant
 type CordiantAPIService struct {
 	BaseURL    string
-	Token      string
+	Token      string // статический токен (может быть пустым, если заданы логин и пароль)
 	Login      string
 	Password   string
+	AuthAction string        // действие API для получения токена по логину и паролю
+	TokenTTL   time.Duration // срок жизни полученного токена, если API его не сообщает
 	HTTPClient *http.Client
+	Clock      models.Clock
+
+	mu             sync.Mutex
+	staticRejected bool      // статический токен отклонен API - дальше только по логину
+	session        string    // токен, полученный по логину и паролю
+	sessionExpires time.Time // когда полученный токен нужно обновить
 }
 
 // NewCordiantAPIService создает новый клиент
-func NewCordiantAPIService(baseURL, token, login, password string) *CordiantAPIService {
+func NewCordiantAPIService(baseURL, token, login, password, authAction string, tokenTTL time.Duration, clock models.Clock) *CordiantAPIService {
 	return &CordiantAPIService{
-		BaseURL:  baseURL,
-		Token:    token,
-		Login:    login,
-		Password: password,
+		BaseURL:    baseURL,
+		Token:      token,
+		Login:      login,
+		Password:   password,
+		AuthAction: authAction,
+		TokenTTL:   tokenTTL,
 		HTTPClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		Clock: clock,
 	}
 }
 
 // SendReport отправляет отчет в Cordiant
 func (s *CordiantAPIService) SendReport(fileBase64 string, year, month string) (*models.CordiantResponse, error) {
+	return s.call("importProcess", fileBase64, year, month)
+}
+
+// ConfirmOverwrite повторяет импорт с подтверждением перезаписи остатков периода
+// (функцией, которую API вернуло в ответе на SendReport)
+func (s *CordiantAPIService) ConfirmOverwrite(function, fileBase64 string, year, month string) (*models.CordiantResponse, error) {
+	if function == "" {
+		return nil, fmt.Errorf("API не вернуло функцию подтверждения перезаписи")
+	}
+	return s.call(function, fileBase64, year, month)
+}
+
+// call выполняет действие API Cordiant с файлом остатков за период.
+// Если API отклонил токен, токен получается заново по логину и паролю и запрос повторяется один раз
+func (s *CordiantAPIService) call(action, fileBase64 string, year, month string) (*models.CordiantResponse, error) {
+	token, err := s.token()
+	if err != nil {
+		return nil, err
+	}
+
+	response, rejected, err := s.doCall(token, action, fileBase64, year, month)
+	if err != nil || !rejected || !s.canLogin() {
+		return response, err
+	}
+
+	log.Printf("Cordiant: токен отклонен, получаем новый по логину")
+	s.invalidate(token)
+	token, err = s.token()
+	if err != nil {
+		return nil, fmt.Errorf("токен отклонен, новый получить не удалось: %v", err)
+	}
+	response, _, err = s.doCall(token, action, fileBase64, year, month)
+	return response, err
+}
+
+// doCall отправляет запрос с токеном; rejected - API отказал в доступе по токену
+func (s *CordiantAPIService) doCall(token, action, fileBase64 string, year, month string) (response *models.CordiantResponse, rejected bool, err error) {
 	// Формируем запрос
 	request := models.CordiantRequest{
 		Year:   year,
 		Month:  month,
-		Token:  s.Token,
-		Action: "importProcess",
+		Token:  token,
+		Action: action,
 		File:   fileBase64,
 	}
 
 	// Сериализуем в JSON
 	jsonData, err := json.Marshal(request)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка сериализации запроса: %v", err)
+		return nil, false, fmt.Errorf("ошибка сериализации запроса: %v", err)
 	}
 
 	// Логируем запрос (без содержимого файла)
@@ -56,7 +113,7 @@ func (s *CordiantAPIService) SendReport(fileBase64 string, year, month string) (
 	log.Printf("URL: %s", s.BaseURL)
 	log.Printf("Year: %s", year)
 	log.Printf("Month: %s", month)
-	log.Printf("Token: %s... (скрыт)", s.Token[:20])
+	log.Printf("Token: %s (скрыт)", maskToken(token))
 	log.Printf("Action: %s", request.Action)
 	log.Printf("File size (base64): %d байт", len(fileBase64))
 	log.Println("===============================")
@@ -64,7 +121,7 @@ func (s *CordiantAPIService) SendReport(fileBase64 string, year, month string) (
 	// Создаем HTTP запрос
 	req, err := http.NewRequest("POST", s.BaseURL, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return nil, fmt.Errorf("ошибка создания запроса: %v", err)
+		return nil, false, fmt.Errorf("ошибка создания запроса: %v", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -73,14 +130,14 @@ func (s *CordiantAPIService) SendReport(fileBase64 string, year, month string) (
 	// Выполняем запрос
 	resp, err := s.HTTPClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка выполнения запроса: %v", err)
+		return nil, false, fmt.Errorf("ошибка выполнения запроса: %v", err)
 	}
 	defer resp.Body.Close()
 
 	// Читаем ответ
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка чтения ответа: %v", err)
+		return nil, false, fmt.Errorf("ошибка чтения ответа: %v", err)
 	}
 
 	// Логируем ответ
@@ -92,11 +149,14 @@ func (s *CordiantAPIService) SendReport(fileBase64 string, year, month string) (
 	// Пробуем распарсить как универсальный объект
 	var rawResponse map[string]interface{}
 	if err := json.Unmarshal(body, &rawResponse); err != nil {
-		return nil, fmt.Errorf("ошибка парсинга ответа: %v", err)
+		if isAuthError(resp.StatusCode, "") {
+			return &models.CordiantResponse{Message: fmt.Sprintf("Доступ запрещен (HTTP %d)", resp.StatusCode)}, true, nil
+		}
+		return nil, false, fmt.Errorf("ошибка парсинга ответа: %v", err)
 	}
 
 	// Создаем структуру для ответа
-	response := &models.CordiantResponse{
+	response = &models.CordiantResponse{
 		Success: false,
 		Message: "Неизвестный формат ответа",
 		Data:    rawResponse,
@@ -108,7 +168,7 @@ func (s *CordiantAPIService) SendReport(fileBase64 string, year, month string) (
 			code, _ := errMap["code"].(string)
 			message, _ := errMap["message"].(string)
 			response.Message = fmt.Sprintf("Ошибка %s: %s", code, message)
-			return response, nil
+			return response, isAuthError(resp.StatusCode, code), nil
 		}
 	}
 
@@ -119,7 +179,7 @@ func (s *CordiantAPIService) SendReport(fileBase64 string, year, month string) (
 			if dataStr == "failure" {
 				response.Success = false
 				response.Message = "Ошибка обработки запроса"
-				return response, nil
+				return response, false, nil
 			}
 		}
 
@@ -129,6 +189,10 @@ func (s *CordiantAPIService) SendReport(fileBase64 string, year, month string) (
 			var dataObj CordiantResponseData
 			if err := json.Unmarshal(dataBytes, &dataObj); err == nil {
 				response.Data = dataObj
+				response.HavePrevRecords = dataObj.IsHavePrevRecords
+				response.ConfirmFunction = dataObj.Function
+				response.ErrorLines = dataObj.ErrorFileStrings
+				response.Warnings = dataObj.Warnings
 
 				// Формируем сообщение на основе статуса
 				if dataObj.Status == "success" {
@@ -145,24 +209,201 @@ func (s *CordiantAPIService) SendReport(fileBase64 string, year, month string) (
 						errorMsg += "\n\nПредупреждения:\n" + formatWarnings(dataObj.Warnings)
 					}
 					if len(dataObj.ErrorFileStrings) > 0 {
-						errorMsg += "\n\nСтроки с ошибками: " + formatIntSlice(dataObj.ErrorFileStrings)
+						errorMsg += fmt.Sprintf("\n\nОтклонено строк файла: %d", len(dataObj.ErrorFileStrings))
 					}
 					response.Message = errorMsg
 				}
-				return response, nil
+				return response, false, nil
 			}
 		}
 	}
 
-	return response, nil
+	return response, false, nil
+}
+
+// canLogin заданы ли логин и пароль для получения токена
+func (s *CordiantAPIService) canLogin() bool {
+	return s.Login != "" && s.Password != "" && s.AuthAction != ""
 }
 
-// ValidateToken проверяет валидность токена
-func (s *CordiantAPIService) ValidateToken() error {
+// token возвращает действующий токен: статический, пока API его принимает,
+// иначе полученный по логину и паролю (из кэша до истечения срока)
+func (s *CordiantAPIService) token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Token != "" && !s.staticRejected {
+		return s.Token, nil
+	}
+	if !s.canLogin() {
+		if s.Token != "" {
+			return "", fmt.Errorf("токен Cordiant отклонен, логин и пароль не заданы")
+		}
+		return "", fmt.Errorf("не заданы ни токен, ни логин и пароль Cordiant")
+	}
+
+	if s.session != "" && s.Clock.Now().Before(s.sessionExpires) {
+		return s.session, nil
+	}
+
+	token, expires, err := s.login()
+	if err != nil {
+		return "", err
+	}
+	s.session = token
+	s.sessionExpires = expires
+	log.Printf("Cordiant: получен токен по логину %s, действует до %s", s.Login, expires.Format("02.01.2006 15:04"))
+	return token, nil
+}
+
+// invalidate помечает токен недействительным после отказа API
+func (s *CordiantAPIService) invalidate(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if token == s.Token {
+		s.staticRejected = true
+	}
+	if token == s.session {
+		s.session = ""
+	}
+}
+
+// login получает токен по логину и паролю. Срок действия - из ответа (expires_in, секунды),
+// иначе TokenTTL; обновляем за минуту до истечения
+func (s *CordiantAPIService) login() (string, time.Time, error) {
+	jsonData, _ := json.Marshal(map[string]string{
+		"action":   s.AuthAction,
+		"login":    s.Login,
+		"password": s.Password,
+	})
+
+	resp, err := s.HTTPClient.Post(s.BaseURL, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("%w: %w", ErrCordiantUnreachable, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("ошибка чтения ответа авторизации: %v", err)
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return "", time.Time{}, fmt.Errorf("авторизация Cordiant: HTTP %d, неверный формат ответа", resp.StatusCode)
+	}
+
+	if errMap, ok := raw["error"].(map[string]interface{}); ok {
+		code, _ := errMap["code"].(string)
+		message, _ := errMap["message"].(string)
+		return "", time.Time{}, fmt.Errorf("авторизация Cordiant отклонена: %s %s", code, message)
+	}
+
+	// Токен и срок ищем в корне ответа и в data
+	fields := raw
+	if data, ok := raw["data"].(map[string]interface{}); ok {
+		fields = data
+	}
+	token, _ := fields["token"].(string)
+	if token == "" {
+		token, _ = raw["token"].(string)
+	}
+	if token == "" {
+		return "", time.Time{}, fmt.Errorf("авторизация Cordiant: в ответе нет токена (HTTP %d)", resp.StatusCode)
+	}
+
+	ttl := s.TokenTTL
+	if seconds, ok := fields["expires_in"].(float64); ok && seconds > 0 {
+		ttl = time.Duration(seconds) * time.Second
+	}
+	if ttl > 2*time.Minute {
+		ttl -= time.Minute
+	}
+	return token, s.Clock.Now().Add(ttl), nil
+}
+
+// CordiantStatus результат проверки подключения к API Cordiant
+type CordiantStatus struct {
+	Reachable     bool   `json:"reachable"`     // сервер API отвечает
+	Authenticated bool   `json:"authenticated"` // логин и пароль приняты (токен получен)
+	TokenSource   string `json:"token_source"`  // static, session или пусто
+	ExpiresAt     string `json:"expires_at,omitempty"`
+	Message       string `json:"message"`
+}
+
+// CheckConnection проверяет доступность API и учетные данные. При заданных логине и пароле
+// токен запрашивается заново; статический токен без отправки отчета проверить нельзя
+func (s *CordiantAPIService) CheckConnection() CordiantStatus {
+	if s.canLogin() {
+		token, expires, err := s.login()
+		if err != nil {
+			return CordiantStatus{
+				Reachable: !errors.Is(err, ErrCordiantUnreachable),
+				Message:   err.Error(),
+			}
+		}
+
+		s.mu.Lock()
+		s.session = token
+		s.sessionExpires = expires
+		s.mu.Unlock()
+
+		return CordiantStatus{
+			Reachable:     true,
+			Authenticated: true,
+			TokenSource:   "session",
+			ExpiresAt:     expires.Format("2006-01-02 15:04:05"),
+			Message:       "Подключение и учетные данные в порядке",
+		}
+	}
+
+	status := CordiantStatus{TokenSource: "static"}
 	if s.Token == "" {
-		return fmt.Errorf("токен не может быть пустым")
+		status.TokenSource = ""
+		status.Message = "Не заданы ни токен, ни логин и пароль"
+		return status
+	}
+
+	resp, err := s.HTTPClient.Get(s.BaseURL)
+	if err != nil {
+		status.Message = fmt.Sprintf("API недоступен: %v", err)
+		return status
 	}
-	return nil
+	resp.Body.Close()
+
+	status.Reachable = true
+	s.mu.Lock()
+	rejected := s.staticRejected
+	s.mu.Unlock()
+	if rejected {
+		status.Message = "API доступен, статический токен был отклонен; задайте логин и пароль"
+	} else {
+		status.Message = "API доступен; статический токен проверяется только при отправке отчета"
+	}
+	return status
+}
+
+// isAuthError определяет отказ в доступе по токену: HTTP 401/403 или код ошибки токена.
+// Прочие ошибки (в том числе с «доступом» в тексте) токен не отменяют
+func isAuthError(httpStatus int, code string) bool {
+	if httpStatus == http.StatusUnauthorized || httpStatus == http.StatusForbidden {
+		return true
+	}
+	for _, authCode := range cordiantAuthErrorCodes {
+		if strings.EqualFold(code, authCode) {
+			return true
+		}
+	}
+	return false
+}
+
+// maskToken скрывает токен в логах, оставляя первые символы
+func maskToken(token string) string {
+	if len(token) <= 6 {
+		return "***"
+	}
+	return token[:6] + "..."
 }
 
 // Вспомогательная функция для форматирования предупреждений
@@ -174,18 +415,6 @@ func formatWarnings(warnings []string) string {
 	return result
 }
 
-// Вспомогательная функция для форматирования списка чисел
-func formatIntSlice(ints []int) string {
-	result := ""
-	for i, v := range ints {
-		if i > 0 {
-			result += ", "
-		}
-		result += fmt.Sprintf("%d", v)
-	}
-	return result
-}
-
 // CordiantResponseData структура для успешного ответа с data объектом
 type CordiantResponseData struct {
 	Status              string   `json:"status"`
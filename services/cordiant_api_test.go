@@ -0,0 +1,176 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"sending-stocks/models"
+)
+
+// testCordiantAPI API Cordiant: выдает токены session-1, session-2... по логину и принимает
+// только выданные токены
+type testCordiantAPI struct {
+	mu        sync.Mutex
+	logins    int
+	calls     []string // токены запросов импорта по порядку
+	valid     map[string]bool
+	rejectAll bool                        // не принимать никакие токены
+	reject    func(w http.ResponseWriter) // ответ на отклоненный токен
+}
+
+func (a *testCordiantAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req map[string]string
+	json.NewDecoder(r.Body).Decode(&req)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if req["action"] == "auth" {
+		a.logins++
+		token := "session-" + strconv.Itoa(a.logins)
+		a.valid[token] = true
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"token": token, "expires_in": 3600},
+		})
+		return
+	}
+
+	a.calls = append(a.calls, req["token"])
+	if a.rejectAll || !a.valid[req["token"]] {
+		a.reject(w)
+		return
+	}
+	w.Write([]byte(`{"data": {"status": "success", "message": "Импорт выполнен"}}`))
+}
+
+func (a *testCordiantAPI) stats() (int, []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.logins, append([]string(nil), a.calls...)
+}
+
+func newTestCordiant(t *testing.T, reject func(w http.ResponseWriter)) (*testCordiantAPI, *CordiantAPIService, *httptest.Server) {
+	t.Helper()
+	api := &testCordiantAPI{valid: map[string]bool{}, reject: reject}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	clock := models.FixedClock{Time: time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)}
+	service := NewCordiantAPIService(server.URL, "static", "user", "secret", "auth", time.Hour, clock)
+	return api, service, server
+}
+
+func TestCordiantAPITokenRefresh(t *testing.T) {
+	api, service, _ := newTestCordiant(t, func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+
+	// Статический токен отклонен: токен по логину и один повтор
+	response, err := service.SendReport("", "2026", "10")
+	if err != nil || !response.Success {
+		t.Fatalf("отправка: %+v, %v", response, err)
+	}
+	logins, calls := api.stats()
+	if logins != 1 || !slices.Equal(calls, []string{"static", "session-1"}) {
+		t.Errorf("после отказа: входов %d, токены %v", logins, calls)
+	}
+
+	// Полученный токен используется до истечения срока, статический больше не пробуется
+	service.Clock = models.FixedClock{Time: service.Clock.Now().Add(58 * time.Minute)}
+	if _, err := service.SendReport("", "2026", "10"); err != nil {
+		t.Fatal(err)
+	}
+	logins, calls = api.stats()
+	if logins != 1 || calls[len(calls)-1] != "session-1" {
+		t.Errorf("до истечения: входов %d, токены %v", logins, calls)
+	}
+
+	// За минуту до истечения токен получается заново
+	service.Clock = models.FixedClock{Time: service.Clock.Now().Add(time.Minute)}
+	if _, err := service.SendReport("", "2026", "10"); err != nil {
+		t.Fatal(err)
+	}
+	logins, calls = api.stats()
+	if logins != 2 || calls[len(calls)-1] != "session-2" {
+		t.Errorf("после истечения: входов %d, токены %v", logins, calls)
+	}
+}
+
+func TestCordiantAPIRetriesOnce(t *testing.T) {
+	api, service, _ := newTestCordiant(t, func(w http.ResponseWriter) {
+		w.Write([]byte(`{"error": {"code": "invalid_token", "message": "Токен недействителен"}}`))
+	})
+	api.rejectAll = true
+
+	response, err := service.SendReport("", "2026", "10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Success {
+		t.Error("отклоненный запрос считается успешным")
+	}
+	logins, calls := api.stats()
+	if logins != 1 || !slices.Equal(calls, []string{"static", "session-1"}) {
+		t.Errorf("повтор не один: входов %d, токены %v", logins, calls)
+	}
+}
+
+func TestCordiantAPIOtherErrorsKeepToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		reject func(w http.ResponseWriter)
+		retry  bool
+	}{
+		{"HTTP 403", func(w http.ResponseWriter) { w.WriteHeader(http.StatusForbidden) }, true},
+		{"код токена", func(w http.ResponseWriter) {
+			w.Write([]byte(`{"error": {"code": "TOKEN_EXPIRED", "message": "Срок токена истек"}}`))
+		}, true},
+		{"доступ в тексте", func(w http.ResponseWriter) {
+			w.Write([]byte(`{"error": {"code": "warehouse", "message": "Нет доступа к складу"}}`))
+		}, false},
+		{"access в коде", func(w http.ResponseWriter) {
+			w.Write([]byte(`{"error": {"code": "period_access", "message": "Period is closed"}}`))
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, service, _ := newTestCordiant(t, tt.reject)
+			if _, err := service.SendReport("", "2026", "10"); err != nil {
+				t.Fatal(err)
+			}
+			logins, calls := api.stats()
+			if retried := logins == 1 && len(calls) == 2; retried != tt.retry {
+				t.Errorf("повтор по логину %v, ожидалось %v (входов %d, токены %v)", retried, tt.retry, logins, calls)
+			}
+
+			service.mu.Lock()
+			rejected := service.staticRejected
+			service.mu.Unlock()
+			if rejected != tt.retry {
+				t.Errorf("статический токен отклонен: %v, ожидалось %v", rejected, tt.retry)
+			}
+		})
+	}
+}
+
+func TestCordiantAPICheckConnection(t *testing.T) {
+	_, service, server := newTestCordiant(t, func(w http.ResponseWriter) {})
+
+	status := service.CheckConnection()
+	if !status.Reachable || !status.Authenticated || status.TokenSource != "session" {
+		t.Errorf("доступный API: %+v", status)
+	}
+
+	server.Close()
+	status = service.CheckConnection()
+	if status.Reachable || status.Authenticated {
+		t.Errorf("недоступный API: %+v", status)
+	}
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"sending-stocks/models"
+	"sending-stocks/processors"
+)
+
+// CustomReportStore хранит определения пользовательских отчетов в JSON файле
+type CustomReportStore struct {
+	Path  string
+	Clock models.Clock
+
+	mu sync.Mutex
+}
+
+// NewCustomReportStore создает хранилище пользовательских отчетов
+func NewCustomReportStore(path string, clock models.Clock) *CustomReportStore {
+	return &CustomReportStore{
+		Path:  path,
+		Clock: clock,
+	}
+}
+
+// List возвращает все определения отчетов
+func (s *CustomReportStore) List() ([]models.CustomReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+// Get возвращает определение отчета по идентификатору
+func (s *CustomReportStore) Get(id string) (*models.CustomReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reports, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	for i := range reports {
+		if reports[i].ID == id {
+			return &reports[i], nil
+		}
+	}
+	return nil, ErrUnknownID
+}
+
+// Save проверяет и сохраняет определение: без ID - новый отчет, с ID - замена существующего
+func (s *CustomReportStore) Save(report *models.CustomReport) error {
+	if err := processors.ValidateCustomReport(report); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reports, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	now := s.Clock.Now().Format("2006-01-02 15:04:05")
+	report.UpdatedAt = now
+
+	if report.ID == "" {
+		report.ID = NewID()
+		report.CreatedAt = now
+		reports = append(reports, *report)
+		return s.store(reports)
+	}
+
+	for i := range reports {
+		if reports[i].ID == report.ID {
+			report.CreatedAt = reports[i].CreatedAt
+			reports[i] = *report
+			return s.store(reports)
+		}
+	}
+	return ErrUnknownID
+}
+
+// Delete удаляет определение отчета
+func (s *CustomReportStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reports, err := s.load()
+	if err != nil {
+		return err
+	}
+	for i := range reports {
+		if reports[i].ID == id {
+			reports = append(reports[:i], reports[i+1:]...)
+			return s.store(reports)
+		}
+	}
+	return ErrUnknownID
+}
+
+func (s *CustomReportStore) load() ([]models.CustomReport, error) {
+	reports := make([]models.CustomReport, 0)
+	data, err := os.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return reports, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения пользовательских отчетов: %v", err)
+	}
+	if err := json.Unmarshal(data, &reports); err != nil {
+		return nil, fmt.Errorf("ошибка разбора пользовательских отчетов: %v", err)
+	}
+	return reports, nil
+}
+
+func (s *CustomReportStore) store(reports []models.CustomReport) error {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0755); err != nil {
+		return fmt.Errorf("ошибка создания каталога пользовательских отчетов: %v", err)
+	}
+	data, _ := json.MarshalIndent(reports, "", "  ")
+	if err := os.WriteFile(s.Path, data, 0644); err != nil {
+		return fmt.Errorf("ошибка записи пользовательских отчетов: %v", err)
+	}
+	return nil
+}
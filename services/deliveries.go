@@ -0,0 +1,110 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"sending-stocks/models"
+)
+
+// Способы передачи отчета
+const (
+	DeliveryAPI      = "api"
+	DeliverySFTP     = "sftp"
+	DeliveryEmail    = "email"
+	DeliveryDownload = "download"
+)
+
+// DeliveryLog журнал отправок отчетов (JSON файл вне каталогов загрузок, не очищается вместе с ними)
+type DeliveryLog struct {
+	Path  string
+	Clock models.Clock
+
+	mu sync.Mutex
+}
+
+// NewDeliveryLog создает журнал отправок
+func NewDeliveryLog(path string, clock models.Clock) *DeliveryLog {
+	return &DeliveryLog{
+		Path:  path,
+		Clock: clock,
+	}
+}
+
+// Record дописывает отправку в журнал. Отправка считается корректировкой, если дата остатков
+// раньше текущей даты или за эту дату отчет уже был успешно отправлен через API или SFTP
+// (скачивание файла само по себе отправкой производителю не считается)
+func (l *DeliveryLog) Record(delivery *models.Delivery) error {
+	now := l.Clock.Now()
+	delivery.ID = NewID()
+	delivery.SentAt = now.Format("2006-01-02 15:04:05")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	deliveries, err := l.load()
+	if err != nil {
+		return err
+	}
+
+	delivery.Correction = delivery.StockDate < now.Format("2006-01-02")
+	for i := len(deliveries) - 1; i >= 0; i-- {
+		prev := deliveries[i]
+		if prev.Success && prev.Channel != DeliveryDownload && prev.Report == delivery.Report && prev.StockDate == delivery.StockDate {
+			delivery.Correction = true
+			delivery.CorrectionOf = prev.ID
+			break
+		}
+	}
+
+	deliveries = append(deliveries, *delivery)
+	return l.store(deliveries)
+}
+
+// Deliveries возвращает записи журнала отчета (пусто - всех отчетов), новые первыми
+func (l *DeliveryLog) Deliveries(report string) ([]models.Delivery, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	deliveries, err := l.load()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]models.Delivery, 0, len(deliveries))
+	for i := len(deliveries) - 1; i >= 0; i-- {
+		if report == "" || deliveries[i].Report == report {
+			result = append(result, deliveries[i])
+		}
+	}
+	return result, nil
+}
+
+func (l *DeliveryLog) load() ([]models.Delivery, error) {
+	deliveries := make([]models.Delivery, 0)
+	data, err := os.ReadFile(l.Path)
+	if os.IsNotExist(err) {
+		return deliveries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения журнала отправок: %v", err)
+	}
+	if err := json.Unmarshal(data, &deliveries); err != nil {
+		return nil, fmt.Errorf("ошибка разбора журнала отправок: %v", err)
+	}
+	return deliveries, nil
+}
+
+func (l *DeliveryLog) store(deliveries []models.Delivery) error {
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0755); err != nil {
+		return fmt.Errorf("ошибка создания каталога журнала отправок: %v", err)
+	}
+	data, _ := json.MarshalIndent(deliveries, "", "  ")
+	if err := os.WriteFile(l.Path, data, 0644); err != nil {
+		return fmt.Errorf("ошибка записи журнала отправок: %v", err)
+	}
+	return nil
+}
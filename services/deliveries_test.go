@@ -0,0 +1,48 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sending-stocks/models"
+)
+
+func TestDeliveryLogRecordCorrection(t *testing.T) {
+	msk := time.FixedZone("MSK", 3*60*60)
+	// В UTC еще 31 декабря, текущая дата берется по часам бизнеса
+	clock := models.FixedClock{Time: time.Date(2027, 1, 1, 0, 30, 0, 0, msk)}
+	log := NewDeliveryLog(filepath.Join(t.TempDir(), "deliveries.json"), clock)
+
+	record := func(report, channel, stockDate string, success bool) *models.Delivery {
+		t.Helper()
+		d := &models.Delivery{Report: report, Channel: channel, StockDate: stockDate, Success: success}
+		if err := log.Record(d); err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	if d := record("pirelli_csv", DeliveryAPI, "2026-12-31", true); !d.Correction || d.CorrectionOf != "" {
+		t.Errorf("отправка за прошлую дату: Correction = %v, CorrectionOf = %q", d.Correction, d.CorrectionOf)
+	}
+
+	if d := record("pirelli_csv", DeliveryDownload, "2027-01-01", true); d.Correction {
+		t.Error("скачивание за текущую дату записано как корректировка")
+	}
+	if d := record("pirelli_csv", DeliveryAPI, "2027-01-01", false); d.Correction {
+		t.Error("отправка после скачивания записана как корректировка")
+	}
+
+	first := record("pirelli_csv", DeliverySFTP, "2027-01-01", true)
+	if first.Correction {
+		t.Error("первая успешная отправка после неуспешной записана как корректировка")
+	}
+	if d := record("pirelli_csv", DeliveryAPI, "2027-01-01", true); !d.Correction || d.CorrectionOf != first.ID {
+		t.Errorf("повторная отправка: Correction = %v, CorrectionOf = %q, ожидалось %q", d.Correction, d.CorrectionOf, first.ID)
+	}
+
+	if d := record("cordiant", DeliveryAPI, "2027-01-01", true); d.Correction {
+		t.Error("отправка другого отчета записана как корректировка")
+	}
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+
+	"sending-stocks/processors"
+)
+
+// ReportTemplate загруженный шаблон отчета
+type ReportTemplate struct {
+	Report    string `json:"report"`
+	Size      int64  `json:"size"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// TemplateStore хранит Excel шаблоны производителей: по одному файлу <отчет>.xlsx на отчет
+type TemplateStore struct {
+	Dir     string
+	Reports []string     // отчеты, для которых можно загрузить шаблон
+	Uploads *UploadStore // ограничения на содержимое архива, как у загружаемых ведомостей
+}
+
+// NewTemplateStore создает хранилище шаблонов
+func NewTemplateStore(dir string, reports []string, uploads *UploadStore) *TemplateStore {
+	return &TemplateStore{
+		Dir:     dir,
+		Reports: reports,
+		Uploads: uploads,
+	}
+}
+
+// known проверяет, что для отчета можно загрузить шаблон (имя отчета используется как имя файла)
+func (s *TemplateStore) known(report string) bool {
+	for _, r := range s.Reports {
+		if r == report {
+			return true
+		}
+	}
+	return false
+}
+
+// path путь к шаблону отчета
+func (s *TemplateStore) path(report string) string {
+	return filepath.Join(s.Dir, report+".xlsx")
+}
+
+// Save проверяет шаблон и сохраняет его вместо предыдущего
+func (s *TemplateStore) Save(report string, data []byte) error {
+	if !s.known(report) {
+		return fmt.Errorf("для отчета %q шаблоны не поддерживаются (доступны: %s)", report, strings.Join(s.Reports, ", "))
+	}
+
+	// Шаблон проверяется до разбора: excelize сам распаковывает архив почти без ограничений
+	if err := s.Uploads.InspectData(data); err != nil {
+		return err
+	}
+	f, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("файл не является книгой Excel: %v", err)
+	}
+	defer f.Close()
+	if err := processors.ValidateTemplate(f); err != nil {
+		return fmt.Errorf("ошибка в шаблоне: %v", err)
+	}
+
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return fmt.Errorf("ошибка создания каталога шаблонов: %v", err)
+	}
+	tmp := s.path(report) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("ошибка сохранения шаблона: %v", err)
+	}
+	return os.Rename(tmp, s.path(report))
+}
+
+// Open открывает шаблон отчета; nil без ошибки - шаблон не загружен
+func (s *TemplateStore) Open(report string) (*excelize.File, error) {
+	if !s.known(report) {
+		return nil, nil
+	}
+	f, err := excelize.OpenFile(s.path(report))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия шаблона %s: %v", report, err)
+	}
+	return f, nil
+}
+
+// Delete удаляет шаблон, после чего отчет снова формируется стандартным способом
+func (s *TemplateStore) Delete(report string) error {
+	if !s.known(report) {
+		return ErrUnknownID
+	}
+	err := os.Remove(s.path(report))
+	if os.IsNotExist(err) {
+		return ErrUnknownID
+	}
+	return err
+}
+
+// List возвращает загруженные шаблоны
+func (s *TemplateStore) List() []ReportTemplate {
+	templates := make([]ReportTemplate, 0)
+	for _, report := range s.Reports {
+		info, err := os.Stat(s.path(report))
+		if err != nil {
+			continue
+		}
+		templates = append(templates, ReportTemplate{
+			Report:    report,
+			Size:      info.Size(),
+			UpdatedAt: info.ModTime().Format("2006-01-02 15:04:05"),
+		})
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Report < templates[j].Report })
+	return templates
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sending-stocks/models"
+)
+
+// ErrUnknownID запрошенный идентификатор не соответствует ни одной записи
+var ErrUnknownID = errors.New("неизвестный идентификатор")
+
+// NewID генерирует непрозрачный идентификатор записи (32 шестнадцатеричных символа)
+func NewID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("ошибка генерации идентификатора: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// ValidID проверяет формат идентификатора, чтобы он не мог оказаться путем
+func ValidID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// ResultStore хранит результаты обработки под серверными идентификаторами
+type ResultStore struct {
+	Dir string
+}
+
+// NewResultStore создает хранилище результатов обработки
+func NewResultStore(dir string) *ResultStore {
+	return &ResultStore{
+		Dir: dir,
+	}
+}
+
+// Save присваивает результату идентификатор (если его нет) и сохраняет его
+func (s *ResultStore) Save(processed *models.ProcessedFile) error {
+	if processed.ID == "" {
+		processed.ID = NewID()
+	}
+	processed.Filename = processed.ID + ".json"
+
+	data, _ := json.MarshalIndent(processed, "", "  ")
+	if err := os.WriteFile(filepath.Join(s.Dir, processed.Filename), data, 0644); err != nil {
+		return fmt.Errorf("ошибка сохранения результата: %v", err)
+	}
+	return nil
+}
+
+// Load возвращает результат обработки по идентификатору
+func (s *ResultStore) Load(id string) (*models.ProcessedFile, error) {
+	if !ValidID(id) {
+		return nil, ErrUnknownID
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.Dir, id+".json"))
+	if os.IsNotExist(err) {
+		return nil, ErrUnknownID
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения результата: %v", err)
+	}
+
+	var processed models.ProcessedFile
+	if err := json.Unmarshal(data, &processed); err != nil {
+		return nil, fmt.Errorf("ошибка чтения данных: %v", err)
+	}
+	if processed.ID != id {
+		return nil, ErrUnknownID
+	}
+	return &processed, nil
+}
+
+// SnapshotDate дата остатков снимка: из шапки ведомости, иначе дата обработки
+func SnapshotDate(processed *models.ProcessedFile) string {
+	if processed.ReportDate != "" {
+		return processed.ReportDate
+	}
+	if len(processed.UploadDate) >= 10 {
+		return processed.UploadDate[:10]
+	}
+	return ""
+}
+
+// FindByDate возвращает последний обработанный снимок остатков на дату (ГГГГ-ММ-ДД)
+func (s *ResultStore) FindByDate(date string) (*models.ProcessedFile, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения каталога результатов: %v", err)
+	}
+
+	var found *models.ProcessedFile
+	for _, entry := range entries {
+		id := strings.TrimSuffix(entry.Name(), ".json")
+		if entry.IsDir() || id == entry.Name() || !ValidID(id) {
+			continue
+		}
+		processed, err := s.Load(id)
+		if err != nil || SnapshotDate(processed) != date {
+			continue
+		}
+		if found == nil || processed.UploadDate > found.UploadDate {
+			found = processed
+		}
+	}
+
+	if found == nil {
+		return nil, ErrUnknownID
+	}
+	return found, nil
+}
@@ -0,0 +1,301 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"sending-stocks/models"
+)
+
+// SFTPTarget SFTP сервер производителя или дистрибьютора для одного отчета
+//
+// Пример:
+//
+//	{"name": "ikon", "report": "ikon", "host": "sftp.ikon.ru", "user": "semisotnov",
+//	 "key_file": "/etc/stock/ikon_ed25519", "host_key": "SHA256:...",
+//	 "path": "/incoming/{{.Date.Format \"2006-01\"}}", "filename": "stock_{{.Date.Format \"20060102\"}}.xlsx"}
+type SFTPTarget struct {
+	Name        string `json:"name"`                   // идентификатор получателя
+	Report      string `json:"report"`                 // отчет: pirelli_csv, pirelli_excel, ikon, hankook, cordiant_csv, invrpt:<отчет>, custom:<id>
+	Host        string `json:"host"`                   // адрес сервера
+	Port        int    `json:"port,omitempty"`         // порт (по умолчанию 22)
+	User        string `json:"user"`                   // пользователь
+	KeyFile     string `json:"key_file"`               // закрытый ключ для входа (авторизация только по ключу)
+	HostKey     string `json:"host_key,omitempty"`     // отпечаток ключа сервера SHA256:...
+	KnownHosts  string `json:"known_hosts,omitempty"`  // или файл known_hosts
+	Path        string `json:"path"`                   // каталог на сервере (шаблон)
+	Filename    string `json:"filename,omitempty"`     // имя файла (шаблон, пусто - имя файла отчета)
+	TimeoutSecs int    `json:"timeout_secs,omitempty"` // таймаут подключения (по умолчанию 30)
+
+	path     *template.Template
+	filename *template.Template
+	signer   ssh.Signer
+	hostKey  ssh.HostKeyCallback
+}
+
+// SFTPFileData данные для шаблонов каталога и имени файла
+type SFTPFileData struct {
+	Name     string    // получатель
+	Report   string    // отчет
+	Date     time.Time // дата остатков
+	Filename string    // имя файла отчета по умолчанию
+}
+
+// SFTPUpload результат выкладки файла
+type SFTPUpload struct {
+	Target     string `json:"target"`
+	RemotePath string `json:"remote_path"`
+	Size       int64  `json:"size"`
+	SHA256     string `json:"sha256"`
+}
+
+// SFTPService выкладывает файлы отчетов на SFTP серверы
+type SFTPService struct {
+	Targets []SFTPTarget
+	Clock   models.Clock
+}
+
+// LoadSFTPTargets читает список SFTP получателей из JSON файла
+func LoadSFTPTargets(path string) ([]SFTPTarget, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать файл SFTP получателей: %v", err)
+	}
+	var targets []SFTPTarget
+	if err := json.Unmarshal(data, &targets); err != nil {
+		return nil, fmt.Errorf("ошибка разбора файла SFTP получателей: %v", err)
+	}
+	return targets, nil
+}
+
+// NewSFTPService проверяет получателей (шаблоны, ключи, проверку ключа сервера) и создает сервис
+func NewSFTPService(targets []SFTPTarget, clock models.Clock) (*SFTPService, error) {
+	names := make(map[string]bool, len(targets))
+	for i := range targets {
+		t := &targets[i]
+		if t.Name == "" || t.Report == "" || t.Host == "" || t.User == "" {
+			return nil, fmt.Errorf("получатель %d: нужны name, report, host и user", i+1)
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("получатель %s: имя повторяется", t.Name)
+		}
+		names[t.Name] = true
+		if t.Port == 0 {
+			t.Port = 22
+		}
+		if t.TimeoutSecs == 0 {
+			t.TimeoutSecs = 30
+		}
+
+		var err error
+		if t.path, err = template.New("path").Parse(t.Path); err != nil {
+			return nil, fmt.Errorf("получатель %s: шаблон path: %v", t.Name, err)
+		}
+		if t.filename, err = template.New("filename").Parse(t.Filename); err != nil {
+			return nil, fmt.Errorf("получатель %s: шаблон filename: %v", t.Name, err)
+		}
+
+		key, err := os.ReadFile(t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("получатель %s: не удалось прочитать ключ: %v", t.Name, err)
+		}
+		if t.signer, err = ssh.ParsePrivateKey(key); err != nil {
+			return nil, fmt.Errorf("получатель %s: ошибка разбора ключа: %v", t.Name, err)
+		}
+
+		switch {
+		case t.HostKey != "":
+			t.hostKey = fingerprintCallback(t.HostKey)
+		case t.KnownHosts != "":
+			if t.hostKey, err = knownhosts.New(t.KnownHosts); err != nil {
+				return nil, fmt.Errorf("получатель %s: ошибка чтения known_hosts: %v", t.Name, err)
+			}
+		default:
+			return nil, fmt.Errorf("получатель %s: укажите host_key или known_hosts для проверки сервера", t.Name)
+		}
+	}
+
+	return &SFTPService{
+		Targets: targets,
+		Clock:   clock,
+	}, nil
+}
+
+// fingerprintCallback проверяет ключ сервера по отпечатку SHA256
+func fingerprintCallback(fingerprint string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if got := ssh.FingerprintSHA256(key); got != fingerprint {
+			return fmt.Errorf("ключ сервера %s не совпадает: %s", hostname, got)
+		}
+		return nil
+	}
+}
+
+// Target возвращает получателя по имени
+func (s *SFTPService) Target(name string) (*SFTPTarget, error) {
+	for i := range s.Targets {
+		if s.Targets[i].Name == name {
+			return &s.Targets[i], nil
+		}
+	}
+	return nil, ErrUnknownID
+}
+
+// RemotePath каталог и имя файла на сервере получателя
+func (t *SFTPTarget) RemotePath(date time.Time, defaultFilename string) (string, error) {
+	data := SFTPFileData{Name: t.Name, Report: t.Report, Date: date, Filename: defaultFilename}
+
+	var dir, name bytes.Buffer
+	if err := t.path.Execute(&dir, data); err != nil {
+		return "", fmt.Errorf("шаблон path: %v", err)
+	}
+	if err := t.filename.Execute(&name, data); err != nil {
+		return "", fmt.Errorf("шаблон filename: %v", err)
+	}
+	filename := strings.TrimSpace(name.String())
+	if filename == "" {
+		filename = defaultFilename
+	}
+	if strings.ContainsAny(filename, "/\\") {
+		return "", fmt.Errorf("имя файла %q не должно содержать каталогов", filename)
+	}
+	return path.Join("/", dir.String(), filename), nil
+}
+
+// Upload выкладывает файл: запись во временный файл, переименование и проверка
+// (размер и контрольная сумма прочитанного обратно файла)
+func (s *SFTPService) Upload(name string, data []byte, defaultFilename string, date time.Time) (*SFTPUpload, error) {
+	target, err := s.Target(name)
+	if err != nil {
+		return nil, fmt.Errorf("SFTP получатель %q не настроен", name)
+	}
+	remotePath, err := target.RemotePath(date, defaultFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &ssh.ClientConfig{
+		User:            target.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(target.signer)},
+		HostKeyCallback: target.hostKey,
+		Timeout:         time.Duration(target.TimeoutSecs) * time.Second,
+	}
+	conn, err := ssh.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(target.Port)), config)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подключения к %s: %v", target.Host, err)
+	}
+	defer conn.Close()
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запуска SFTP: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.MkdirAll(path.Dir(remotePath)); err != nil {
+		return nil, fmt.Errorf("ошибка создания каталога %s: %v", path.Dir(remotePath), err)
+	}
+
+	// Получатель не должен увидеть недописанный файл
+	tmpPath := path.Join(path.Dir(remotePath), "."+path.Base(remotePath)+".part")
+	if err := writeRemote(client, tmpPath, data); err != nil {
+		client.Remove(tmpPath)
+		return nil, err
+	}
+	if err := client.PosixRename(tmpPath, remotePath); err != nil {
+		if err := replaceRemote(client, tmpPath, remotePath); err != nil {
+			client.Remove(tmpPath)
+			return nil, err
+		}
+	}
+
+	// Проверка выложенного файла
+	sum := sha256.Sum256(data)
+	upload := &SFTPUpload{
+		Target:     name,
+		RemotePath: remotePath,
+		Size:       int64(len(data)),
+		SHA256:     hex.EncodeToString(sum[:]),
+	}
+	info, err := client.Stat(remotePath)
+	if err != nil {
+		return nil, fmt.Errorf("файл %s не найден после выкладки: %v", remotePath, err)
+	}
+	if info.Size() != upload.Size {
+		return nil, fmt.Errorf("размер файла %s на сервере %d, ожидалось %d", remotePath, info.Size(), upload.Size)
+	}
+	remote, err := client.Open(remotePath)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения %s для проверки: %v", remotePath, err)
+	}
+	defer remote.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, remote); err != nil {
+		return nil, fmt.Errorf("ошибка чтения %s для проверки: %v", remotePath, err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != upload.SHA256 {
+		return nil, fmt.Errorf("контрольная сумма файла %s на сервере не совпадает", remotePath)
+	}
+
+	return upload, nil
+}
+
+// replaceRemote заменяет файл на сервере без posix-rename (обычный SFTP rename не перезаписывает
+// существующий файл). Прежний файл получателя переносится в сторону и удаляется только после
+// успешного переименования, при ошибке он возвращается на место
+func replaceRemote(client *sftp.Client, tmpPath, remotePath string) error {
+	backupPath := path.Join(path.Dir(remotePath), "."+path.Base(remotePath)+".old")
+	_, err := client.Stat(remotePath)
+	hasPrevious := err == nil
+	if hasPrevious {
+		client.Remove(backupPath)
+		if err := client.Rename(remotePath, backupPath); err != nil {
+			return fmt.Errorf("ошибка переименования %s: %v", remotePath, err)
+		}
+	}
+
+	if err := client.Rename(tmpPath, remotePath); err != nil {
+		if hasPrevious {
+			if restoreErr := client.Rename(backupPath, remotePath); restoreErr != nil {
+				return fmt.Errorf("ошибка переименования %s: %v (прежний файл остался в %s: %v)", tmpPath, err, backupPath, restoreErr)
+			}
+		}
+		return fmt.Errorf("ошибка переименования %s: %v", tmpPath, err)
+	}
+
+	if hasPrevious {
+		client.Remove(backupPath)
+	}
+	return nil
+}
+
+// writeRemote записывает файл на сервер
+func writeRemote(client *sftp.Client, remotePath string, data []byte) error {
+	f, err := client.OpenFile(remotePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("ошибка создания %s: %v", remotePath, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("ошибка записи %s: %v", remotePath, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("ошибка записи %s: %v", remotePath, err)
+	}
+	return nil
+}
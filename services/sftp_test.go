@@ -0,0 +1,290 @@
+package services
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"sending-stocks/models"
+)
+
+// testSFTPServer SFTP сервер в памяти на локальном порту
+type testSFTPServer struct {
+	Port     int
+	HostKey  string // отпечаток ключа сервера SHA256:...
+	KeyFile  string // закрытый ключ клиента
+	handlers sftp.Handlers
+
+	mu         sync.Mutex
+	failRename func(from, to string) bool // отказ в переименовании (rename и posix-rename)
+	corrupt    bool                       // портить записываемые данные
+}
+
+// testSFTPCmd команды файловой системы с управляемыми отказами. posix-rename не реализован,
+// поэтому сервер выполняет его как обычный rename, который не перезаписывает файл
+type testSFTPCmd struct {
+	srv  *testSFTPServer
+	next sftp.FileCmder
+}
+
+func (c testSFTPCmd) Filecmd(r *sftp.Request) error {
+	c.srv.mu.Lock()
+	fail := c.srv.failRename
+	c.srv.mu.Unlock()
+	if (r.Method == "Rename" || r.Method == "PosixRename") && fail != nil && fail(r.Filepath, r.Target) {
+		return os.ErrPermission
+	}
+	return c.next.Filecmd(r)
+}
+
+// testSFTPWriter записывает данные с измененным последним байтом (тот же размер, другая сумма)
+type testSFTPWriter struct {
+	srv  *testSFTPServer
+	next sftp.FileWriter
+}
+
+func (w testSFTPWriter) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	wa, err := w.next.Filewrite(r)
+	if err != nil {
+		return nil, err
+	}
+	w.srv.mu.Lock()
+	defer w.srv.mu.Unlock()
+	if !w.srv.corrupt {
+		return wa, nil
+	}
+	return corruptWriterAt{wa}, nil
+}
+
+type corruptWriterAt struct {
+	io.WriterAt
+}
+
+func (w corruptWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	data := bytes.Clone(p)
+	if len(data) > 0 {
+		data[len(data)-1] ^= 0xFF
+	}
+	return w.WriterAt.WriteAt(data, off)
+}
+
+func startTestSFTPServer(t *testing.T) *testSFTPServer {
+	t.Helper()
+
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientPub, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKey, err := ssh.NewPublicKey(clientPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(clientPriv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	srv := &testSFTPServer{
+		Port:    ln.Addr().(*net.TCPAddr).Port,
+		HostKey: ssh.FingerprintSHA256(hostSigner.PublicKey()),
+		KeyFile: keyFile,
+	}
+	mem := sftp.InMemHandler()
+	srv.handlers = sftp.Handlers{
+		FileGet:  mem.FileGet,
+		FilePut:  testSFTPWriter{srv: srv, next: mem.FilePut},
+		FileCmd:  testSFTPCmd{srv: srv, next: mem.FileCmd},
+		FileList: mem.FileList,
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn, config)
+		}
+	}()
+	return srv
+}
+
+func (s *testSFTPServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			for req := range requests {
+				req.Reply(req.Type == "subsystem", nil)
+				if req.Type == "subsystem" {
+					server := sftp.NewRequestServer(channel, s.handlers)
+					server.Serve()
+					server.Close()
+				}
+			}
+		}()
+	}
+}
+
+// open открывает файл на сервере напрямую через обработчики
+func (s *testSFTPServer) open(name string) (io.ReaderAt, error) {
+	req := sftp.NewRequest("Get", name)
+	req.Flags = 0x01 // SSH_FXF_READ
+	return s.handlers.FileGet.Fileread(req)
+}
+
+// read читает файл с сервера
+func (s *testSFTPServer) read(t *testing.T, name string) string {
+	t.Helper()
+	r, err := s.open(name)
+	if err != nil {
+		t.Fatalf("файл %s: %v", name, err)
+	}
+	data, err := io.ReadAll(io.NewSectionReader(r, 0, 1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func (s *testSFTPServer) set(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn()
+}
+
+func TestSFTPServiceUpload(t *testing.T) {
+	srv := startTestSFTPServer(t)
+	clock := models.FixedClock{Time: time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)}
+
+	service, err := NewSFTPService([]SFTPTarget{{
+		Name:     "ikon",
+		Report:   "ikon",
+		Host:     "127.0.0.1",
+		Port:     srv.Port,
+		User:     "stocks",
+		KeyFile:  srv.KeyFile,
+		HostKey:  srv.HostKey,
+		Path:     `/incoming/{{.Date.Format "2006-01"}}`,
+		Filename: `stock_{{.Date.Format "20060102"}}.xlsx`,
+	}}, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const remotePath = "/incoming/2026-10/stock_20261018.xlsx"
+
+	upload, err := service.Upload("ikon", []byte("first"), "Ikon.xlsx", clock.Now())
+	if err != nil {
+		t.Fatalf("выкладка: %v", err)
+	}
+	if upload.RemotePath != remotePath || upload.Size != 5 {
+		t.Errorf("выкладка: %+v", upload)
+	}
+	if got := srv.read(t, remotePath); got != "first" {
+		t.Errorf("на сервере %q", got)
+	}
+
+	// Сервер без posix-rename: прежний файл заменяется через переименование в сторону
+	if _, err := service.Upload("ikon", []byte("second"), "Ikon.xlsx", clock.Now()); err != nil {
+		t.Fatalf("перезапись: %v", err)
+	}
+	if got := srv.read(t, remotePath); got != "second" {
+		t.Errorf("после перезаписи на сервере %q", got)
+	}
+
+	// Неудачное переименование не должно лишить получателя прежнего файла
+	srv.set(func() {
+		srv.failRename = func(from, to string) bool { return strings.HasSuffix(from, ".part") }
+	})
+	if _, err := service.Upload("ikon", []byte("third"), "Ikon.xlsx", clock.Now()); err == nil {
+		t.Error("ошибка переименования не возвращена")
+	}
+	if got := srv.read(t, remotePath); got != "second" {
+		t.Errorf("после ошибки переименования на сервере %q, ожидался прежний файл", got)
+	}
+	srv.set(func() { srv.failRename = nil })
+
+	// Файл, испорченный при записи, обнаруживается по контрольной сумме
+	srv.set(func() { srv.corrupt = true })
+	_, err = service.Upload("ikon", []byte("fourth"), "Ikon.xlsx", clock.Now())
+	if err == nil || !strings.Contains(err.Error(), "контрольная сумма") {
+		t.Errorf("испорченный файл: %v", err)
+	}
+	srv.set(func() { srv.corrupt = false })
+}
+
+func TestSFTPServiceRejectsHostKey(t *testing.T) {
+	srv := startTestSFTPServer(t)
+	other := startTestSFTPServer(t)
+	clock := models.FixedClock{Time: time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)}
+
+	service, err := NewSFTPService([]SFTPTarget{{
+		Name:    "ikon",
+		Report:  "ikon",
+		Host:    "127.0.0.1",
+		Port:    srv.Port,
+		User:    "stocks",
+		KeyFile: srv.KeyFile,
+		HostKey: other.HostKey,
+		Path:    "/incoming",
+	}}, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.Upload("ikon", []byte("data"), "Ikon.xlsx", clock.Now()); err == nil {
+		t.Fatal("подключение к серверу с чужим ключом не отклонено")
+	}
+	if _, err := srv.open("/incoming/Ikon.xlsx"); err == nil {
+		t.Error("файл выложен на сервер с чужим ключом")
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"net/smtp"
 	"strings"
 	"time"
+
+	"sending-stocks/models"
 )
 
 // SMTPService сервис для отправки email
@@ -17,16 +19,18 @@ type SMTPService struct {
 	Username string
 	Password string
 	From     string
+	Clock    models.Clock // дата письма в часовом поясе бизнеса
 }
 
 // NewSMTPService создает новый SMTP сервис
-func NewSMTPService(host string, port int, username, password, from string) *SMTPService {
+func NewSMTPService(host string, port int, username, password, from string, clock models.Clock) *SMTPService {
 	return &SMTPService{
 		Host:     host,
 		Port:     port,
 		Username: username,
 		Password: password,
 		From:     from,
+		Clock:    clock,
 	}
 }
 
@@ -37,7 +41,8 @@ func (s *SMTPService) SendEmail(to []string, subject, body string, attachment []
 	}
 
 	// Формируем границу для multipart
-	boundary := "boundary_" + time.Now().Format("20060102150405")
+	now := s.Clock.Now()
+	boundary := "boundary_" + now.Format("20060102150405")
 
 	// Создаем буфер для письма
 	var buf bytes.Buffer
@@ -46,6 +51,7 @@ func (s *SMTPService) SendEmail(to []string, subject, body string, attachment []
 	buf.WriteString(fmt.Sprintf("From: %s\r\n", s.From))
 	buf.WriteString(fmt.Sprintf("To: %s\r\n", strings.Join(to, ", ")))
 	buf.WriteString(fmt.Sprintf("Subject: %s\r\n", subject))
+	buf.WriteString(fmt.Sprintf("Date: %s\r\n", now.Format(time.RFC1123Z)))
 	buf.WriteString("MIME-Version: 1.0\r\n")
 	buf.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=\"%s\"\r\n", boundary))
 	buf.WriteString("\r\n")
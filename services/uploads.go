@@ -0,0 +1,276 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+
+	"sending-stocks/models"
+)
+
+// Ошибки проверки загружаемого файла (отказ по вине клиента)
+var (
+	ErrUploadTooLarge = errors.New("файл превышает допустимый размер")
+	ErrUploadInvalid  = errors.New("файл не является книгой Excel (XLSX)")
+)
+
+// uploadIndexFile журнал загрузок в каталоге загрузок
+const uploadIndexFile = "uploads.json"
+
+// UploadStore сохраняет загруженные файлы, проверяет их содержимое и ведет журнал загрузок
+type UploadStore struct {
+	Dir             string
+	MaxSize         int64 // максимальный размер файла, байт
+	MaxUnzippedSize int64 // максимальный суммарный размер распакованного содержимого, байт
+	MaxEntries      int   // максимальное число файлов внутри архива
+	Clock           models.Clock
+
+	mu sync.Mutex
+}
+
+// NewUploadStore создает хранилище загрузок
+func NewUploadStore(dir string, maxSize, maxUnzippedSize int64, maxEntries int, clock models.Clock) *UploadStore {
+	return &UploadStore{
+		Dir:             dir,
+		MaxSize:         maxSize,
+		MaxUnzippedSize: maxUnzippedSize,
+		MaxEntries:      maxEntries,
+		Clock:           clock,
+	}
+}
+
+// Save сохраняет файл под безопасным именем, проверяет его и записывает в журнал.
+// Если файл с тем же содержимым уже загружался, возвращает и предыдущую запись
+func (s *UploadStore) Save(originalName string, src io.Reader) (*models.UploadRecord, *models.UploadRecord, error) {
+	tmp, err := os.CreateTemp(s.Dir, ".upload-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка создания файла: %v", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(src, s.MaxSize+1))
+	tmp.Close()
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка сохранения файла: %v", err)
+	}
+	if size > s.MaxSize {
+		return nil, nil, fmt.Errorf("%w (максимум %d МБ)", ErrUploadTooLarge, s.MaxSize>>20)
+	}
+
+	if err := s.Inspect(tmpPath); err != nil {
+		return nil, nil, err
+	}
+
+	// Браузеры под Windows могут прислать полный путь
+	originalName = originalName[strings.LastIndexAny(originalName, `/\`)+1:]
+
+	now := s.Clock.Now()
+	record := &models.UploadRecord{
+		ID:           NewID(),
+		Filename:     fmt.Sprintf("%s_%s", now.Format("20060102_150405"), SanitizeFilename(originalName)),
+		OriginalName: originalName,
+		Size:         size,
+		SHA256:       hex.EncodeToString(hash.Sum(nil)),
+		UploadedAt:   now.Format("2006-01-02 15:04:05"),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.load()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Имя уже занято (две загрузки в одну секунду) - добавляем номер
+	base := strings.TrimSuffix(record.Filename, ".xlsx")
+	for i := 2; fileExists(filepath.Join(s.Dir, record.Filename)); i++ {
+		record.Filename = fmt.Sprintf("%s_%d.xlsx", base, i)
+	}
+
+	if err := os.Rename(tmpPath, filepath.Join(s.Dir, record.Filename)); err != nil {
+		return nil, nil, fmt.Errorf("ошибка сохранения файла: %v", err)
+	}
+
+	var previous *models.UploadRecord
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].SHA256 == record.SHA256 && fileExists(filepath.Join(s.Dir, records[i].Filename)) {
+			prev := records[i]
+			previous = &prev
+			break
+		}
+	}
+
+	records = append(records, *record)
+	if err := s.store(records); err != nil {
+		return nil, nil, err
+	}
+
+	return record, previous, nil
+}
+
+// Inspect проверяет, что файл - настоящий OOXML архив без признаков zip-бомбы
+func (s *UploadStore) Inspect(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения файла: %v", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("ошибка чтения файла: %v", err)
+	}
+	return s.inspectArchive(f, info.Size())
+}
+
+// InspectData проверяет книгу, полученную в памяти (например, шаблон отчета), теми же ограничениями,
+// что и загружаемые ведомости
+func (s *UploadStore) InspectData(data []byte) error {
+	return s.inspectArchive(bytes.NewReader(data), int64(len(data)))
+}
+
+// inspectArchive проверяет сигнатуру, число файлов и фактический размер распакованного содержимого
+func (s *UploadStore) inspectArchive(r io.ReaderAt, size int64) error {
+	header := make([]byte, 4)
+	if _, err := r.ReadAt(header, 0); err != nil || !bytes.Equal(header, []byte("PK\x03\x04")) {
+		return fmt.Errorf("%w: неверная сигнатура", ErrUploadInvalid)
+	}
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUploadInvalid, err)
+	}
+
+	if s.MaxEntries > 0 && len(zr.File) > s.MaxEntries {
+		return fmt.Errorf("%w: слишком много файлов в архиве (%d, максимум %d)", ErrUploadInvalid, len(zr.File), s.MaxEntries)
+	}
+
+	hasContentTypes, hasWorkbook := false, false
+	var total int64
+	for _, entry := range zr.File {
+		switch entry.Name {
+		case "[Content_Types].xml":
+			hasContentTypes = true
+		case "xl/workbook.xml":
+			hasWorkbook = true
+		}
+
+		// Распаковываем фактически, не доверяя размерам из заголовков архива
+		rc, err := entry.Open()
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrUploadInvalid, entry.Name, err)
+		}
+		n, err := io.Copy(io.Discard, io.LimitReader(rc, s.MaxUnzippedSize-total+1))
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrUploadInvalid, entry.Name, err)
+		}
+		total += n
+		if total > s.MaxUnzippedSize {
+			return fmt.Errorf("%w: распакованное содержимое больше %d МБ", ErrUploadInvalid, s.MaxUnzippedSize>>20)
+		}
+	}
+
+	if !hasContentTypes || !hasWorkbook {
+		return fmt.Errorf("%w: нет описания книги", ErrUploadInvalid)
+	}
+	return nil
+}
+
+// Resolve возвращает запись журнала и путь к файлу по идентификатору загрузки
+func (s *UploadStore) Resolve(id string) (*models.UploadRecord, string, error) {
+	if !ValidID(id) {
+		return nil, "", ErrUnknownID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.load()
+	if err != nil {
+		return nil, "", err
+	}
+	for _, record := range records {
+		if record.ID != id {
+			continue
+		}
+		path := filepath.Join(s.Dir, record.Filename)
+		if !fileExists(path) {
+			return nil, "", ErrUnknownID
+		}
+		return &record, path, nil
+	}
+	return nil, "", ErrUnknownID
+}
+
+// Records возвращает журнал загрузок
+func (s *UploadStore) Records() ([]models.UploadRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+func (s *UploadStore) load() ([]models.UploadRecord, error) {
+	records := make([]models.UploadRecord, 0)
+	data, err := os.ReadFile(filepath.Join(s.Dir, uploadIndexFile))
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения журнала загрузок: %v", err)
+	}
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("ошибка разбора журнала загрузок: %v", err)
+	}
+	return records, nil
+}
+
+func (s *UploadStore) store(records []models.UploadRecord) error {
+	data, _ := json.MarshalIndent(records, "", "  ")
+	if err := os.WriteFile(filepath.Join(s.Dir, uploadIndexFile), data, 0644); err != nil {
+		return fmt.Errorf("ошибка записи журнала загрузок: %v", err)
+	}
+	return nil
+}
+
+// SanitizeFilename оставляет в имени файла только буквы, цифры, дефис и подчеркивание (расширение - .xlsx)
+func SanitizeFilename(name string) string {
+	name = name[strings.LastIndexAny(name, `/\`)+1:]
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+
+	var builder strings.Builder
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_':
+			builder.WriteRune(r)
+		case r == '.' || unicode.IsSpace(r):
+			builder.WriteRune('_')
+		}
+	}
+
+	clean := strings.Trim(builder.String(), "_")
+	if runes := []rune(clean); len(runes) > 80 {
+		clean = string(runes[:80])
+	}
+	if clean == "" {
+		clean = "upload"
+	}
+	return clean + ".xlsx"
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
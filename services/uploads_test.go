@@ -0,0 +1,115 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testArchive собирает zip архив; entries - имя и содержимое по порядку
+func testArchive(t *testing.T, entries ...[2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		w, err := zw.Create(entry[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(entry[1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// lyingArchive архив книги с записью, размер которой в заголовке занижен
+func lyingArchive(t *testing.T, size int) []byte {
+	t.Helper()
+	data := make([]byte, size)
+	var compressed bytes.Buffer
+	fw, _ := flate.NewWriter(&compressed, flate.BestCompression)
+	fw.Write(data)
+	fw.Close()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"[Content_Types].xml", "xl/workbook.xml"} {
+		w, _ := zw.Create(name)
+		w.Write([]byte("<xml/>"))
+	}
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "xl/worksheets/sheet1.xml",
+		Method:             zip.Deflate,
+		CRC32:              crc32.ChecksumIEEE(data),
+		CompressedSize64:   uint64(compressed.Len()),
+		UncompressedSize64: 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(compressed.Bytes())
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUploadStoreInspect(t *testing.T) {
+	workbook := [][2]string{{"[Content_Types].xml", "<xml/>"}, {"xl/workbook.xml", "<xml/>"}}
+	manyEntries := append([][2]string{}, workbook...)
+	for i := 0; i < 10; i++ {
+		manyEntries = append(manyEntries, [2]string{fmt.Sprintf("xl/media/image%d.png", i), "png"})
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		valid   bool
+		message string // фрагмент текста ошибки
+	}{
+		{"книга", testArchive(t, workbook...), true, ""},
+		{"не архив", []byte("Наименование;Остаток\n"), false, "неверная сигнатура"},
+		{"обрезанный архив", testArchive(t, workbook...)[:30], false, ""},
+		{"архив без книги", testArchive(t, [2]string{"readme.txt", "text"}), false, "нет описания книги"},
+		{"много файлов", testArchive(t, manyEntries...), false, "слишком много файлов"},
+		{"zip-бомба", testArchive(t, append(workbook, [2]string{"xl/worksheets/sheet1.xml", strings.Repeat("0", 2<<20)})...), false, "распакованное содержимое"},
+		// Размер из заголовка не используется: запись распаковывается и отклоняется
+		{"заниженный размер в заголовке", lyingArchive(t, 2<<20), false, ""},
+	}
+
+	store := NewUploadStore(t.TempDir(), 10<<20, 1<<20, 10, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "upload.xlsx")
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			for method, err := range map[string]error{
+				"Inspect":     store.Inspect(path),
+				"InspectData": store.InspectData(tt.data),
+			} {
+				if tt.valid {
+					if err != nil {
+						t.Errorf("%s: %v", method, err)
+					}
+					continue
+				}
+				if !errors.Is(err, ErrUploadInvalid) {
+					t.Errorf("%s: %v, ожидалась ErrUploadInvalid", method, err)
+				} else if !strings.Contains(err.Error(), tt.message) {
+					t.Errorf("%s: %v, ожидалось %q", method, err, tt.message)
+				}
+			}
+		})
+	}
+}